@@ -3,66 +3,48 @@ package main
 import (
 	"context"
 	"fmt"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/barasher/go-exiftool"
 	vaultApi "github.com/hashicorp/vault/api"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/extractor"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/keyservice"
 	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/middleware"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/notifier"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/objectstore"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/scanner"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/compliance"
 	"github.com/mirzahilmi/modalrakyat-hardened/internal/knowyourcustomer"
 	"github.com/mirzahilmi/modalrakyat-hardened/internal/utility"
 	"github.com/rs/zerolog/log"
 )
 
 func setup(ctx context.Context) (func() error, error) {
-	// deprecated, but whatever. thanks to https://github.com/minio/docs/issues/406#issuecomment-1246316964
-	resolver := aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
-		return aws.Endpoint{
-			PartitionID:       "aws",
-			URL:               cfg.S3.URL,
-			SigningRegion:     cfg.S3.DefaultRegion,
-			HostnameImmutable: true,
-		}, nil
-	})
-	s3client := s3.NewFromConfig(aws.Config{
-		Region: cfg.S3.DefaultRegion,
-		Credentials: credentials.NewStaticCredentialsProvider(
-			cfg.S3.AccessKeyId,
-			cfg.S3.SecretAccessKey,
-			"",
-		),
-		EndpointResolver: resolver,
-	}, func(o *s3.Options) {
-		o.UsePathStyle = true
-	})
-	s3presignedClient := s3.NewPresignClient(s3client)
-
-	exif, err := exiftool.NewExiftool()
+	objects, err := objectstore.New(ctx, cfg.S3)
 	if err != nil {
 		return nil, err
 	}
 
-	vaultConfig := vaultApi.DefaultConfig()
-	vaultConfig.Address = cfg.Vault.URL
-	vault, err := vaultApi.NewClient(vaultConfig)
+	exif, err := exiftool.NewExiftool()
 	if err != nil {
 		return nil, err
 	}
-	vault.SetToken(cfg.Vault.Token)
 
-	pgxConfig, err := pgxpool.ParseConfig(cfg.PostgreSQL.ConnectionURL)
+	keyservice, err := newKeyService()
 	if err != nil {
-		log.Fatal().Err(err).Msg(fmt.Sprintf("timescaledb: failed to parse dsn uri %s", cfg.PostgreSQL.ConnectionURL))
+		return nil, err
 	}
-	// pgxConfig.ConnConfig.Tracer = pgxlogger.NewTraceLogger()
-	pool, err := pgxpool.NewWithConfig(ctx, pgxConfig)
+	fieldCipher, err := keyservice.NewFieldCipher(ctx, cfg.FieldEncryption)
 	if err != nil {
-		log.Fatal().Err(err).Msg(fmt.Sprintf("timescaledb: cannot start connection with %s", cfg.PostgreSQL.ConnectionURL))
+		return nil, err
 	}
 
-	middleware := middleware.NewMiddleware(api, cfg)
+	pool := newPool(ctx)
+
+	middleware := middleware.NewMiddleware(api, cfg, pool)
+	api.UseMiddleware(middleware.NewRequestInfo())
+	middleware.StartIdempotencySweeper(ctx)
 
 	utility.RegisterHandler(ctx, api, middleware)
 	knowyourcustomer.RegisterHandler(
@@ -70,12 +52,21 @@ func setup(ctx context.Context) (func() error, error) {
 		api,
 		middleware,
 		cfg,
-		s3client,
-		s3presignedClient,
+		objects,
 		exif,
-		vault,
+		keyservice,
+		fieldCipher,
+		scanner.New(cfg.Scanner),
+		extractor.NewTesseract(
+			cfg.Extraction.TesseractPath,
+			cfg.Extraction.PdftotextPath,
+			cfg.Extraction.Languages,
+			time.Duration(cfg.Extraction.Timeout)*time.Second,
+		),
+		notifier.New(cfg.Notifier),
 		pool,
 	)
+	compliance.RegisterHandler(ctx, api, middleware, cfg, keyservice, pool)
 
 	return func() error {
 		if err := exif.Close(); err != nil {
@@ -84,3 +75,27 @@ func setup(ctx context.Context) (func() error, error) {
 		return nil
 	}, nil
 }
+
+func newKeyService() (keyservice.KeyService, error) {
+	vaultConfig := vaultApi.DefaultConfig()
+	vaultConfig.Address = cfg.Vault.URL
+	vault, err := vaultApi.NewClient(vaultConfig)
+	if err != nil {
+		return keyservice.KeyService{}, err
+	}
+	vault.SetToken(cfg.Vault.Token)
+	return keyservice.New(vault, cfg.Vault), nil
+}
+
+func newPool(ctx context.Context) *pgxpool.Pool {
+	pgxConfig, err := pgxpool.ParseConfig(cfg.PostgreSQL.ConnectionURL)
+	if err != nil {
+		log.Fatal().Err(err).Msg(fmt.Sprintf("timescaledb: failed to parse dsn uri %s", cfg.PostgreSQL.ConnectionURL))
+	}
+	// pgxConfig.ConnConfig.Tracer = pgxlogger.NewTraceLogger()
+	pool, err := pgxpool.NewWithConfig(ctx, pgxConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg(fmt.Sprintf("timescaledb: cannot start connection with %s", cfg.PostgreSQL.ConnectionURL))
+	}
+	return pool
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"github.com/danielgtaylor/huma/v2/adapters/humachi"
 	"github.com/danielgtaylor/huma/v2/humacli"
 	"github.com/go-chi/chi/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
 	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
 	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
 	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/logging"
@@ -27,8 +29,9 @@ type options struct {
 }
 
 var (
-	api huma.API
-	cfg config.Config
+	api      huma.API
+	cfg      config.Config
+	closeApp func() error
 )
 
 func main() {
@@ -45,8 +48,6 @@ func main() {
 		if err := json.NewDecoder(bytes.NewBuffer(configBytes)).Decode(&cfg); err != nil {
 			log.Fatal().Err(err).Msg("config: failed to parse config raw bytes to struct")
 		}
-		ctx := context.Background()
-
 		oapi := huma.DefaultConfig("ModelRakyat - OpenAPI 3.0", "1.0.0")
 		oapi.DocsPath = ""
 		oapi.Info.Description = constant.OAPI_SPEC_DESCRIPTION
@@ -84,10 +85,6 @@ func main() {
 		}
 
 		api = humachi.New(router, oapi)
-		close, err := setup(ctx)
-		if err != nil {
-			log.Fatal().Err(err).Msg("app: failed to setup")
-		}
 
 		addr := fmt.Sprintf(":%d", cfg.Port)
 		server := http.Server{
@@ -113,17 +110,33 @@ func main() {
 			if err := server.Shutdown(ctx); err != nil {
 				log.Fatal().Err(err).Msg("http: failed to shutdown")
 			}
-			if err := close(); err != nil {
+			if err := closeApp(); err != nil {
 				log.Fatal().Err(err).Msg("http: failed to shutdown")
 			}
 			log.Info().Msg("http: shut down complete")
 		})
 	})
 
+	// only serving sets the app up, with its connections and background
+	// workers, the other commands open what they need themselves
+	cli.Root().PreRun = func(cmd *cobra.Command, args []string) {
+		var err error
+		closeApp, err = setup(cmd.Context())
+		if err != nil {
+			log.Fatal().Err(err).Msg("app: failed to setup")
+		}
+	}
+
 	cli.Root().AddCommand(&cobra.Command{
 		Use:   "spec",
 		Short: "Print the OpenAPI specification",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			closeSpec, err := setup(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer closeSpec()
+
 			var spec []byte
 			if len(args) == 1 && args[0] == "legacy" {
 				raw, err := api.OpenAPI().DowngradeYAML()
@@ -144,5 +157,60 @@ func main() {
 		},
 	})
 
+	cli.Root().AddCommand(&cobra.Command{
+		Use:   "field-keys",
+		Short: "Generate the wrapped keys for fieldEncryption",
+		Long:  "Prints a fresh Vault-wrapped encryption and blind index key pair to paste into the configuration. Only Vault is contacted.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keyservice, err := newKeyService()
+			if err != nil {
+				return err
+			}
+			keys, err := keyservice.GenerateDataKeys(cmd.Context(), 2)
+			if err != nil {
+				return err
+			}
+			encoded, err := json.MarshalIndent(config.FieldEncryption{
+				Enabled:       true,
+				EncryptionKey: keys[0].CiphertextEncoded,
+				IndexKey:      keys[1].CiphertextEncoded,
+			}, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(encoded))
+
+			return nil
+		},
+	})
+
+	auditCommand := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the audit log",
+	}
+	auditCommand.AddCommand(&cobra.Command{
+		Use:   "verify",
+		Short: "Check the audit log hash chain for gaps and edits",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pool := newPool(cmd.Context())
+			defer pool.Close()
+
+			report, err := audit.Verify(cmd.Context(), pool)
+			if err != nil {
+				return err
+			}
+			for _, problem := range report.Problems {
+				fmt.Printf("event %d: %s\n", problem.Seq, problem.Reason)
+			}
+			fmt.Printf("%d events, head %d %s\n", report.Events, report.HeadSeq, hex.EncodeToString(report.HeadHash))
+			if !report.Ok() {
+				return fmt.Errorf("audit log failed verification with %d problems", len(report.Problems))
+			}
+
+			return nil
+		},
+	})
+	cli.Root().AddCommand(auditCommand)
+
 	cli.Run()
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/extractor"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/imaging"
+	"github.com/oklog/ulid/v2"
+)
+
+// Prints the download watermark ULID hidden in a leaked document copy, to be
+// looked up in the document_watermarks table.
+func main() {
+	args := os.Args[1:]
+	if len(args) != 1 {
+		log.Fatalln("usage: watermark <image|pdf>")
+	}
+	raw, err := os.ReadFile(args[0])
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if extractor.IsPdf(raw) {
+		i := bytes.LastIndex(raw, []byte(constant.PDF_WATERMARK_COMMENT))
+		if i < 0 {
+			log.Fatalln("no watermark comment found")
+		}
+		encoded := raw[i+len(constant.PDF_WATERMARK_COMMENT):]
+		id, err := ulid.ParseStrict(string(encoded[:min(len(encoded), ulid.EncodedSize)]))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println(id.String())
+		return
+	}
+	img, err := imaging.Decode(raw)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	payload, err := imaging.ExtractIdentifier(img)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var id ulid.ULID
+	if err := id.UnmarshalBinary(payload); err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Println(id.String())
+}
@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/rs/zerolog/log"
+)
+
+// OutcomeOf maps a handler error onto an event outcome.
+func OutcomeOf(err error) string {
+	if err == nil {
+		return constant.AUDIT_OUTCOME_SUCCESS
+	}
+	var status huma.StatusError
+	if errors.As(err, &status) {
+		switch status.GetStatus() {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return constant.AUDIT_OUTCOME_DENIED
+		case http.StatusNotFound:
+			return constant.AUDIT_OUTCOME_NOT_FOUND
+		}
+	}
+	return constant.AUDIT_OUTCOME_FAILURE
+}
+
+// RecordAccess records the outcome of a read-only handler, meant to be
+// deferred with its named error. Access is refused when the event cannot be
+// recorded, a failed attempt is still answered with its own error.
+func RecordAccess(ctx context.Context, db Beginner, event *Event, err error) error {
+	event.Outcome = OutcomeOf(err)
+	auditErr := Append(ctx, db, *event)
+	if auditErr == nil {
+		return err
+	}
+	log.Error().Err(auditErr).Str("action", event.Action).Msg("audit: failed to record event")
+	if err != nil {
+		return err
+	}
+	return huma.Error503ServiceUnavailable("access cannot be audited right now")
+}
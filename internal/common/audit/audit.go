@@ -0,0 +1,168 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/middleware"
+	"github.com/oklog/ulid/v2"
+)
+
+// chainLock is the advisory lock key serializing appends, so every event is
+// chained onto the committed head.
+const chainLock = "audit_events"
+
+var genesisHash = make([]byte, sha256.Size)
+
+// Event is what a caller reports. The subject and request details are taken
+// from the context when left empty.
+type Event struct {
+	Action     string
+	Subject    string
+	DocumentId string
+	CaseId     string
+	Outcome    string
+	Purpose    string
+	Detail     map[string]any
+}
+
+// Record is a stored event. Its JSON encoding, with fields in this order, is
+// what gets hashed.
+type Record struct {
+	Seq         int64     `json:"seq"`
+	Id          string    `json:"id"`
+	Action      string    `json:"action"`
+	Subject     string    `json:"subject"`
+	ClientIp    string    `json:"clientIp"`
+	UserAgent   string    `json:"userAgent"`
+	OperationId string    `json:"operationId"`
+	DocumentId  string    `json:"documentId"`
+	CaseId      string    `json:"caseId"`
+	Outcome     string    `json:"outcome"`
+	Purpose     string    `json:"purpose"`
+	Detail      string    `json:"detail"`
+	CreatedAt   time.Time `json:"createdAt"`
+	PrevHash    []byte    `json:"prevHash"`
+	Hash        []byte    `json:"-"`
+}
+
+// computeHash is SHA256 over the canonical encoding of the record, which
+// embeds the previous hash and so the whole chain before it.
+func (r Record) computeHash() ([]byte, error) {
+	r.CreatedAt = r.CreatedAt.UTC()
+	encoded, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(encoded)
+	return digest[:], nil
+}
+
+// Beginner is satisfied by a pool, and by a transaction, in which case the
+// event is written in a savepoint of it and commits or rolls back with it.
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Append chains event onto the log. Concurrent appends wait on each other
+// until the appending transaction ends, keep those transactions short. The
+// wait is on a lock shared by every append, so within a transaction Append
+// comes after every other statement, right before the commit. A transaction
+// taking row locks after appending could otherwise deadlock with one holding
+// those rows while waiting to append.
+func Append(ctx context.Context, db Beginner, event Event) error {
+	if event.Subject == "" {
+		if principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken); ok {
+			event.Subject = principal.Subject
+		}
+	}
+	info := middleware.RequestInfoFrom(ctx)
+
+	record := Record{
+		Id:          ulid.Make().String(),
+		Action:      event.Action,
+		Subject:     event.Subject,
+		ClientIp:    info.ClientIp,
+		UserAgent:   info.UserAgent,
+		OperationId: info.OperationId,
+		DocumentId:  event.DocumentId,
+		CaseId:      event.CaseId,
+		Outcome:     event.Outcome,
+		Purpose:     event.Purpose,
+		// the column has microsecond precision, the hash must survive a round trip
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if len(event.Detail) > 0 {
+		detail, err := json.Marshal(event.Detail)
+		if err != nil {
+			return err
+		}
+		record.Detail = string(detail)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, chainLock); err != nil {
+		return err
+	}
+	err = tx.QueryRow(ctx, `
+		SELECT seq, hash
+		FROM audit_events
+		ORDER BY seq DESC
+		LIMIT 1`,
+	).Scan(&record.Seq, &record.PrevHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		record.Seq, record.PrevHash = 0, genesisHash
+	} else if err != nil {
+		return err
+	}
+	record.Seq++
+
+	record.Hash, err = record.computeHash()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO audit_events (
+			seq, id, action, subject, client_ip, user_agent, operation_id,
+			document_id, case_id, outcome, purpose, detail, created_at, prev_hash, hash
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		record.Seq,
+		record.Id,
+		record.Action,
+		nullable(record.Subject),
+		nullable(record.ClientIp),
+		nullable(record.UserAgent),
+		nullable(record.OperationId),
+		nullable(record.DocumentId),
+		nullable(record.CaseId),
+		record.Outcome,
+		nullable(record.Purpose),
+		nullable(record.Detail),
+		record.CreatedAt,
+		record.PrevHash,
+		record.Hash,
+	); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
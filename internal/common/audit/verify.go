@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxProblems bounds the report, past that the log is not worth reading on.
+const maxProblems = 100
+
+type Problem struct {
+	Seq    int64
+	Reason string
+}
+
+// Report summarizes a verification pass. HeadSeq and HeadHash should be kept
+// somewhere outside the database: truncating the tail of the log leaves a
+// valid chain, which only a comparison with an earlier head reveals.
+type Report struct {
+	Events   int64
+	HeadSeq  int64
+	HeadHash []byte
+	Problems []Problem
+}
+
+func (r Report) Ok() bool {
+	return len(r.Problems) == 0
+}
+
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Verify walks the whole log in order, checking that sequence numbers have no
+// gaps, that each event points at the hash of the one before and that every
+// hash still matches its row.
+func Verify(ctx context.Context, q Querier) (Report, error) {
+	rows, err := q.Query(ctx, `
+		SELECT seq, id, action, subject, client_ip, user_agent, operation_id,
+			document_id, case_id, outcome, purpose, detail, created_at, prev_hash, hash
+		FROM audit_events
+		ORDER BY seq`)
+	if err != nil {
+		return Report{}, err
+	}
+	defer rows.Close()
+
+	report := Report{}
+	problem := func(seq int64, format string, args ...any) {
+		if len(report.Problems) < maxProblems {
+			report.Problems = append(report.Problems, Problem{seq, fmt.Sprintf(format, args...)})
+		}
+	}
+
+	expectedSeq, expectedPrev := int64(1), genesisHash
+	for rows.Next() {
+		var (
+			record   Record
+			nullable [8]*string
+		)
+		if err := rows.Scan(
+			&record.Seq,
+			&record.Id,
+			&record.Action,
+			&nullable[0],
+			&nullable[1],
+			&nullable[2],
+			&nullable[3],
+			&nullable[4],
+			&nullable[5],
+			&record.Outcome,
+			&nullable[6],
+			&nullable[7],
+			&record.CreatedAt,
+			&record.PrevHash,
+			&record.Hash,
+		); err != nil {
+			return Report{}, err
+		}
+		for i, field := range []*string{
+			&record.Subject,
+			&record.ClientIp,
+			&record.UserAgent,
+			&record.OperationId,
+			&record.DocumentId,
+			&record.CaseId,
+			&record.Purpose,
+			&record.Detail,
+		} {
+			if nullable[i] != nil {
+				*field = *nullable[i]
+			}
+		}
+		report.Events++
+
+		if record.Seq != expectedSeq {
+			problem(record.Seq, "sequence gap, expected %d", expectedSeq)
+		}
+		if !bytes.Equal(record.PrevHash, expectedPrev) {
+			problem(record.Seq, "previous hash does not match the hash of event %d", record.Seq-1)
+		}
+		hash, err := record.computeHash()
+		if err != nil {
+			return Report{}, err
+		}
+		if !bytes.Equal(hash, record.Hash) {
+			problem(record.Seq, "hash does not match the event content")
+		}
+
+		expectedSeq, expectedPrev = record.Seq+1, record.Hash
+		report.HeadSeq, report.HeadHash = record.Seq, record.Hash
+	}
+	if err := rows.Err(); err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
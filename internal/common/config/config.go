@@ -5,9 +5,26 @@ type Config struct {
 	IsDevelopment   bool
 	ShutdownTimeout int64
 	Oidc            Oidc
+	Roles           Roles
 	S3              S3
 	Vault           Vault
 	PostgreSQL      PostgreSQL
+	Variants        Variants
+	Watermark       Watermark
+	Scanner         Scanner
+	Queue           Queue
+	Extraction      Extraction
+	Duplicates      Duplicates
+	FieldEncryption FieldEncryption
+	Access          Access
+	Retention       Retention
+	Consent         Consent
+	Export          Export
+	Notifier        Notifier
+	Links           Links
+	Uploads         Uploads
+	Tus             Tus
+	Idempotency     Idempotency
 }
 
 type Oidc struct {
@@ -15,12 +32,44 @@ type Oidc struct {
 	ClientId string
 }
 
+// Roles names the OIDC token roles granting privileged access.
+type Roles struct {
+	Reviewer   string
+	Compliance string
+}
+
 type S3 struct {
 	AccessKeyId,
 	SecretAccessKey,
 	DefaultRegion,
 	DefaultBucket,
 	URL string
+	// Backend picks where objects are stored: s3, the default, filesystem
+	// under Directory, or memory, which loses everything on restart.
+	Backend   string
+	Directory string
+	// SessionToken goes with temporary static keys. Without AccessKeyId,
+	// credentials come from WebIdentityTokenFile exchanged for RoleArn, or
+	// from the SDK default chain reading Profile out of CredentialsFile.
+	SessionToken         string
+	Profile              string
+	CredentialsFile      string
+	RoleArn              string
+	WebIdentityTokenFile string
+	// URL is addressed path style unless VirtualHostedStyle is set, and
+	// CaBundle is a PEM file trusted on top of the system roots.
+	VirtualHostedStyle bool
+	CaBundle           string
+	// Checksums is when_required, the default that Garage accepts, or
+	// when_supported.
+	Checksums string
+	// MaxAttempts and MaxBackoff, in seconds, tune retries. Timeout is in
+	// seconds and bounds every operation, OperationTimeouts overrides it by
+	// operation name, e.g. GetObject, with 0 for no bound.
+	MaxAttempts       int
+	MaxBackoff        int64
+	Timeout           int64
+	OperationTimeouts map[string]int64
 }
 
 type Vault struct {
@@ -28,8 +77,158 @@ type Vault struct {
 	Token           string
 	TransitBasePath string
 	TransitKey      string
+	// HmacKey is the transit key fingerprints are keyed with, kept apart from
+	// the encryption key as rotating it invalidates every stored fingerprint.
+	HmacKey string
+	// SigningKey is an asymmetric transit key, e.g. ed25519, signing audit
+	// export manifests.
+	SigningKey string
 }
 
 type PostgreSQL struct {
 	ConnectionURL string
 }
+
+type Variants struct {
+	Enabled          bool
+	MaxDimension     int
+	PreviewDimension int
+	PreviewWatermark string
+}
+
+// Watermark decides which downloads are handed out as traceable copies.
+// Callers holding any of Roles receive a visible overlay and/or an invisible
+// identifier linked to a document_watermarks row.
+type Watermark struct {
+	Roles     []string
+	Visible   bool
+	Invisible bool
+}
+
+// Scanner configures the content scanner invoked on uploads before they are
+// encrypted. Timeout is in seconds. With FailOpen, uploads proceed as
+// unscanned when the scanner cannot be reached, otherwise they are refused.
+type Scanner struct {
+	Enabled  bool
+	Network  string
+	Address  string
+	Timeout  int64
+	FailOpen bool
+}
+
+// Queue tunes the reviewer work queue. LeaseDuration is in seconds, after
+// which an undecided claim returns to the queue.
+type Queue struct {
+	LeaseDuration        int64
+	MaxClaimsPerReviewer int
+}
+
+// Extraction configures the asynchronous field extraction run after upload.
+// Timeout is in seconds, must be positive, and bounds a single extraction
+// attempt.
+type Extraction struct {
+	Enabled       bool
+	Workers       int
+	MaxAttempts   int
+	Timeout       int64
+	TesseractPath string
+	PdftotextPath string
+	Languages     string
+}
+
+// Duplicates configures the detection of document images reused across
+// subjects. MaxDistance is the number of differing perceptual hash bits still
+// considered the same picture, at most 3.
+type Duplicates struct {
+	Enabled     bool
+	MaxDistance int
+}
+
+// FieldEncryption holds the Vault-wrapped keys sealing searchable columns and
+// deriving their blind indexes, as printed by the field-keys command.
+type FieldEncryption struct {
+	Enabled       bool
+	EncryptionKey string
+	IndexKey      string
+}
+
+// Access lists the purposes a caller may state when reading a document of
+// another subject. Such reads are refused without one of them, leaving
+// Purposes empty lifts the requirement.
+type Access struct {
+	Purposes []string
+}
+
+// Retention schedules documents for deletion Days after upload by kind, with
+// Default covering kinds not listed. Zero keeps documents indefinitely. Every
+// Interval seconds, the purge worker crypto-shreds up to BatchSize expired
+// documents not under legal hold. Documents left without a retention, such as
+// those predating it, are scheduled from their upload when the worker starts.
+type Retention struct {
+	Enabled   bool
+	Interval  int64
+	BatchSize int
+	Default   int64
+	Kinds     map[string]int64
+}
+
+// Consent configures the processing consent uploads are made under. Consents
+// are only granted for the current NoticeVersion of the privacy notice. With
+// Required, uploads must reference an active consent of the uploader. On
+// withdrawal, OnWithdrawal either retains the documents uploaded under it or
+// expires them, for the purge worker to crypto-shred even with Retention
+// disabled. Documents under legal hold are purged once released.
+type Consent struct {
+	Required      bool
+	NoticeVersion string
+	OnWithdrawal  string
+}
+
+// Export configures data subject access exports. Built archives are kept for
+// Ttl seconds, and a build is attempted at most MaxAttempts times.
+type Export struct {
+	Enabled     bool
+	Ttl         int64
+	MaxAttempts int
+}
+
+// Notifier delivers customer notifications, such as an export being ready,
+// as JSON POSTs to WebhookUrl. Timeout is in seconds.
+type Notifier struct {
+	Enabled    bool
+	WebhookUrl string
+	Timeout    int64
+}
+
+// Links configures download links, which stay redeemable once for Ttl
+// seconds. BaseUrl is where clients reach this API, link URLs are built on it.
+type Links struct {
+	Ttl     int64
+	BaseUrl string
+}
+
+// Uploads configures direct upload sessions, through which clients store
+// documents they encrypted themselves. A session stays open for Ttl seconds,
+// for a document of at most MaxSize bytes.
+type Uploads struct {
+	Enabled bool
+	Ttl     int64
+	MaxSize int64
+}
+
+// Tus configures resumable uploads over the tus protocol. An upload can be
+// resumed for Ttl seconds after its creation, for a document of at most
+// MaxSize bytes. Expired uploads are discarded in the background.
+type Tus struct {
+	Enabled bool
+	Ttl     int64
+	MaxSize int64
+}
+
+// Idempotency configures Idempotency-Key handling. Responses are replayed to
+// retries for Ttl seconds, for request bodies of at most MaxBodySize bytes.
+type Idempotency struct {
+	Enabled     bool
+	Ttl         int64
+	MaxBodySize int64
+}
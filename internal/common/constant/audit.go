@@ -0,0 +1,36 @@
+package constant
+
+const (
+	AUDIT_ACTION_DOCUMENT_UPLOAD              = "document.upload"
+	AUDIT_ACTION_DOCUMENT_REPLACE             = "document.replace"
+	AUDIT_ACTION_DOCUMENT_VERSIONS            = "document.versions"
+	AUDIT_ACTION_DOCUMENT_DOWNLOAD            = "document.download"
+	AUDIT_ACTION_DOCUMENT_LINK_CREATE         = "document.link.create"
+	AUDIT_ACTION_DOCUMENT_LINK_REDEEM         = "document.link.redeem"
+	AUDIT_ACTION_DOCUMENT_METADATA            = "document.metadata"
+	AUDIT_ACTION_DOCUMENT_EXTRACTION_READ     = "document.extraction.read"
+	AUDIT_ACTION_DOCUMENT_EXTRACTION_OVERRIDE = "document.extraction.override"
+	AUDIT_ACTION_DOCUMENT_LEGAL_HOLD          = "document.legal_hold"
+	AUDIT_ACTION_DOCUMENT_PURGE               = "document.purge"
+	AUDIT_ACTION_CASE_TRANSITION              = "case.transition"
+	AUDIT_ACTION_CONSENT_GRANT                = "consent.grant"
+	AUDIT_ACTION_CONSENT_WITHDRAW             = "consent.withdraw"
+	AUDIT_ACTION_SUBJECT_LOOKUP               = "subject.lookup"
+	AUDIT_ACTION_SUBJECT_EXPORT               = "subject.export"
+	AUDIT_ACTION_SUBJECT_EXPORT_DOWNLOAD      = "subject.export.download"
+	AUDIT_ACTION_AUDIT_QUERY                  = "audit.query"
+	AUDIT_ACTION_AUDIT_EXPORT                 = "audit.export"
+
+	AUDIT_OUTCOME_SUCCESS   = "success"
+	AUDIT_OUTCOME_DENIED    = "denied"
+	AUDIT_OUTCOME_NOT_FOUND = "not_found"
+	AUDIT_OUTCOME_FAILURE   = "failure"
+
+	// AUDIT_SUBJECT_RETENTION acts for the purge worker, which has no principal
+	AUDIT_SUBJECT_RETENTION = "system:retention"
+)
+
+const (
+	AUDIT_EXPORT_FORMAT_JSONL = "jsonl"
+	AUDIT_EXPORT_FORMAT_CSV   = "csv"
+)
@@ -0,0 +1,20 @@
+package constant
+
+const (
+	CASE_STATE_DRAFT              = "draft"
+	CASE_STATE_SUBMITTED          = "submitted"
+	CASE_STATE_IN_REVIEW          = "in_review"
+	CASE_STATE_APPROVED           = "approved"
+	CASE_STATE_REJECTED           = "rejected"
+	CASE_STATE_NEEDS_RESUBMISSION = "needs_resubmission"
+
+	CASE_REASON_DOCUMENT_UNREADABLE   = "document_unreadable"
+	CASE_REASON_DOCUMENT_EXPIRED      = "document_expired"
+	CASE_REASON_DOCUMENT_MISMATCH     = "document_mismatch"
+	CASE_REASON_INCOMPLETE_SUBMISSION = "incomplete_submission"
+	CASE_REASON_SUSPECTED_FRAUD       = "suspected_fraud"
+	CASE_REASON_OTHER                 = "other"
+	CASE_REASON_LEASE_EXPIRED         = "lease_expired"
+
+	CASE_ACTOR_SYSTEM = "system"
+)
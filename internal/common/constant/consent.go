@@ -0,0 +1,10 @@
+package constant
+
+const (
+	CONSENT_CHANNEL_WEB    = "web"
+	CONSENT_CHANNEL_MOBILE = "mobile"
+	CONSENT_CHANNEL_BRANCH = "branch"
+
+	CONSENT_WITHDRAWAL_RETAIN = "retain"
+	CONSENT_WITHDRAWAL_PURGE  = "purge"
+)
@@ -2,4 +2,7 @@ package constant
 
 const (
 	CONTEXT_KEY_PRINCIPAL = "principal"
+	CONTEXT_KEY_ROLES     = "roles"
+
+	CONTEXT_KEY_REQUEST_INFO = "request-info"
 )
@@ -0,0 +1,20 @@
+package constant
+
+const (
+	DOCUMENT_KIND_KTP         = "ktp"
+	DOCUMENT_KIND_SALARY_SLIP = "salary_slip"
+	DOCUMENT_KIND_UNKNOWN     = "unknown"
+
+	DOCUMENT_STATUS_PENDING  = "pending"
+	DOCUMENT_STATUS_VERIFIED = "verified"
+	DOCUMENT_STATUS_REJECTED = "rejected"
+
+	// DOCUMENT_OBJECT_PREFIX holds uploads, each version under its own id
+	DOCUMENT_OBJECT_PREFIX = "documents"
+)
+
+var DOCUMENT_KINDS = []string{
+	DOCUMENT_KIND_KTP,
+	DOCUMENT_KIND_SALARY_SLIP,
+	DOCUMENT_KIND_UNKNOWN,
+}
@@ -4,4 +4,10 @@ const (
 	// MUST BE lower-case, bcs somehow aws-sdk-go-v2 always returns lower-cased header :/
 	EDEK_HEADER = "x-edek"
 	DEK_DIGEST  = "x-dek-digest"
+	SOURCE_KEY  = "x-source-key"
+	VARIANT     = "x-variant"
+
+	// ENCRYPTION_FORMAT is absent on objects sealed as a single AES-GCM message
+	ENCRYPTION_FORMAT        = "x-encryption-format"
+	ENCRYPTION_FORMAT_STREAM = "aes-gcm-stream-v1"
 )
@@ -0,0 +1,19 @@
+package constant
+
+const (
+	EXPORT_STATUS_PENDING    = "pending"
+	EXPORT_STATUS_PROCESSING = "processing"
+	EXPORT_STATUS_READY      = "ready"
+	EXPORT_STATUS_FAILED     = "failed"
+	EXPORT_STATUS_EXPIRED    = "expired"
+
+	EXPORT_RECIPIENT_PASSWORD   = "password"
+	EXPORT_RECIPIENT_PUBLIC_KEY = "public_key"
+
+	EXPORT_OBJECT_PREFIX = "exports/"
+)
+
+const (
+	NOTIFICATION_TYPE_EXPORT_READY  = "export.ready"
+	NOTIFICATION_TYPE_EXPORT_FAILED = "export.failed"
+)
@@ -0,0 +1,8 @@
+package constant
+
+const (
+	EXTRACTION_STATUS_PENDING    = "pending"
+	EXTRACTION_STATUS_PROCESSING = "processing"
+	EXTRACTION_STATUS_COMPLETED  = "completed"
+	EXTRACTION_STATUS_FAILED     = "failed"
+)
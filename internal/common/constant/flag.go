@@ -0,0 +1,15 @@
+package constant
+
+const (
+	CASE_FLAG_SOURCE_IDENTITY   = "identity"
+	CASE_FLAG_SOURCE_DUPLICATES = "duplicates"
+
+	CASE_FLAG_EXTRACTION_INCOMPLETE = "extraction_incomplete"
+	CASE_FLAG_NIK_UNREADABLE        = "nik_unreadable"
+	CASE_FLAG_NIK_INVALID           = "nik_invalid"
+	CASE_FLAG_NIK_CONFLICT          = "nik_conflict"
+	CASE_FLAG_BIRTH_DATE_MISMATCH   = "birth_date_mismatch"
+	CASE_FLAG_GENDER_MISMATCH       = "gender_mismatch"
+	CASE_FLAG_NAME_MISMATCH         = "name_mismatch"
+	CASE_FLAG_DUPLICATE_DOCUMENT    = "duplicate_document"
+)
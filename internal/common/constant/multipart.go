@@ -2,4 +2,6 @@ package constant
 
 const (
 	MULTIPART_KEY_ATTACHMENTS = "attachments"
+	MULTIPART_KEY_KINDS       = "kinds"
+	MULTIPART_KEY_CONSENT     = "consent"
 )
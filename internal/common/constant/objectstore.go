@@ -0,0 +1,12 @@
+package constant
+
+const (
+	OBJECT_STORE_BACKEND_S3         = "s3"
+	OBJECT_STORE_BACKEND_FILESYSTEM = "filesystem"
+	OBJECT_STORE_BACKEND_MEMORY     = "memory"
+)
+
+const (
+	S3_CHECKSUMS_WHEN_REQUIRED  = "when_required"
+	S3_CHECKSUMS_WHEN_SUPPORTED = "when_supported"
+)
@@ -0,0 +1,10 @@
+package constant
+
+const (
+	SCAN_STATUS_UNSCANNED = "unscanned"
+	SCAN_STATUS_CLEAN     = "clean"
+	SCAN_STATUS_INFECTED  = "infected"
+	SCAN_STATUS_ERROR     = "error"
+
+	QUARANTINE_OBJECT_PREFIX = "quarantine"
+)
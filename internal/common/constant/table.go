@@ -1,5 +1,21 @@
 package constant
 
 const (
-	TABLE_DOCUMENTS = "documents"
+	TABLE_DOCUMENTS                 = "documents"
+	TABLE_DOCUMENT_VARIANTS         = "document_variants"
+	TABLE_DOCUMENT_WATERMARKS       = "document_watermarks"
+	TABLE_KYC_CASES                 = "kyc_cases"
+	TABLE_KYC_CASE_DOCUMENTS        = "kyc_case_documents"
+	TABLE_DOCUMENT_EXTRACTIONS      = "document_extractions"
+	TABLE_KYC_CASE_FLAGS            = "kyc_case_flags"
+	TABLE_DOCUMENT_FINGERPRINTS     = "document_fingerprints"
+	TABLE_DOCUMENT_EXTRACTION_EDITS = "document_extraction_edits"
+	TABLE_SUBJECT_IDENTITIES        = "subject_identities"
+	TABLE_CONSENTS                  = "consents"
+	TABLE_SUBJECT_EXPORTS           = "subject_exports"
+	TABLE_DOWNLOAD_LINKS            = "download_links"
+	TABLE_UPLOAD_SESSIONS           = "upload_sessions"
+	TABLE_TUS_UPLOADS               = "tus_uploads"
+	TABLE_IDEMPOTENCY_KEYS          = "idempotency_keys"
+	TABLE_PURGED_OBJECTS            = "purged_objects"
 )
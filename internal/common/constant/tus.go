@@ -0,0 +1,17 @@
+package constant
+
+const (
+	TUS_VERSION      = "1.0.0"
+	TUS_EXTENSIONS   = "creation,termination,expiration"
+	TUS_CONTENT_TYPE = "application/offset+octet-stream"
+
+	TUS_STATUS_UPLOADING = "uploading"
+	// TUS_STATUS_UPLOADED uploads are complete in storage, not yet registered
+	TUS_STATUS_UPLOADED  = "uploaded"
+	TUS_STATUS_COMPLETED = "completed"
+	TUS_STATUS_FAILED    = "failed"
+
+	TUS_METADATA_FILENAME = "filename"
+	TUS_METADATA_KIND     = "kind"
+	TUS_METADATA_CONSENT  = "consentId"
+)
@@ -0,0 +1,12 @@
+package constant
+
+const (
+	UPLOAD_STATUS_PENDING    = "pending"
+	UPLOAD_STATUS_FINALIZING = "finalizing"
+	UPLOAD_STATUS_COMPLETED  = "completed"
+	UPLOAD_STATUS_FAILED     = "failed"
+
+	// UPLOAD_OBJECT_PREFIX holds objects put by clients until their session
+	// is finalized, abandoned ones are best expired by a bucket lifecycle rule
+	UPLOAD_OBJECT_PREFIX = "uploads"
+)
@@ -0,0 +1,9 @@
+package constant
+
+const (
+	VARIANT_ORIGINAL   = "original"
+	VARIANT_NORMALISED = "normalised"
+	VARIANT_PREVIEW    = "preview"
+
+	VARIANT_OBJECT_PREFIX = "variants"
+)
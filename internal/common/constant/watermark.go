@@ -0,0 +1,4 @@
+package constant
+
+// PDF_WATERMARK_COMMENT prefixes the download watermark ULID appended to PDFs.
+const PDF_WATERMARK_COMMENT = "%modalrakyat-watermark "
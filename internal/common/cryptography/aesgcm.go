@@ -8,6 +8,10 @@ import (
 	"io"
 )
 
+// AesGcmOverhead is what EncryptAesGcm adds on top of the plaintext, the
+// prepended 12-bytes nonce and the trailing 16-bytes tag.
+const AesGcmOverhead = 12 + 16
+
 func EncryptAesGcm(key, plaintext []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
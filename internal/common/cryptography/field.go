@@ -0,0 +1,87 @@
+package cryptography
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// fieldVersion prefixes every field ciphertext so the format can evolve
+// without guessing at how old rows were sealed.
+const fieldVersion byte = 1
+
+// FieldCipher encrypts individual column values and derives blind indexes for
+// them. The encryption and index keys must differ: an index is a
+// deterministic function of the value, a ciphertext must never be.
+type FieldCipher struct {
+	aead     cipher.AEAD
+	indexKey []byte
+}
+
+func NewFieldCipher(encryptionKey, indexKey []byte) (FieldCipher, error) {
+	if len(encryptionKey) != 32 || len(indexKey) != 32 {
+		return FieldCipher{}, errors.New("cryptography: field keys must be 32 bytes")
+	}
+	if hmac.Equal(encryptionKey, indexKey) {
+		return FieldCipher{}, errors.New("cryptography: field encryption and index keys must differ")
+	}
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return FieldCipher{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return FieldCipher{}, err
+	}
+	return FieldCipher{aead, indexKey}, nil
+}
+
+// Encrypt seals plaintext as version || nonce || ciphertext || tag. The aad
+// should name the column and the row, so a ciphertext copied over to another
+// row or column fails to decrypt.
+func (c FieldCipher) Encrypt(plaintext, aad []byte) ([]byte, error) {
+	if c.aead == nil {
+		return nil, errors.New("cryptography: field cipher not initialized")
+	}
+	sealed := make([]byte, 1+c.aead.NonceSize(), 1+c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	sealed[0] = fieldVersion
+	nonce := sealed[1:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(sealed, nonce, plaintext, aad), nil
+}
+
+func (c FieldCipher) Decrypt(ciphertext, aad []byte) ([]byte, error) {
+	if c.aead == nil {
+		return nil, errors.New("cryptography: field cipher not initialized")
+	}
+	if len(ciphertext) < 1+c.aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	if ciphertext[0] != fieldVersion {
+		return nil, fmt.Errorf("unsupported field ciphertext version %d", ciphertext[0])
+	}
+	nonce := ciphertext[1 : 1+c.aead.NonceSize()]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext[1+c.aead.NonceSize():], aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt field: %w", err)
+	}
+	return plaintext, nil
+}
+
+// BlindIndex is the HMAC-SHA256 of value under the index key, separated per
+// domain so equal values in different columns do not share an index. Values
+// must be normalized by the caller, the index only supports exact matches.
+func (c FieldCipher) BlindIndex(domain string, value []byte) []byte {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(domain))
+	mac.Write([]byte{0})
+	mac.Write(value)
+	return mac.Sum(nil)
+}
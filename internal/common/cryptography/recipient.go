@@ -0,0 +1,56 @@
+package cryptography
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+const minRecipientKeyBits = 2048
+
+// ParseRecipientKey reads a PEM encoded RSA public key, in PKIX or PKCS #1
+// form, of at least 2048 bits.
+func ParseRecipientKey(encoded []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(encoded)
+	if block == nil {
+		return nil, errors.New("recipient key is not PEM encoded")
+	}
+
+	var key *rsa.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("recipient key is not an RSA key")
+		}
+		key = rsaKey
+	case "RSA PUBLIC KEY":
+		parsed, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = parsed
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %s", block.Type)
+	}
+
+	if key.N.BitLen() < minRecipientKeyBits {
+		return nil, fmt.Errorf("recipient key must have at least %d bits", minRecipientKeyBits)
+	}
+	return key, nil
+}
+
+// WrapForRecipient encrypts a short secret to the recipient with RSA-OAEP
+// and SHA-256, as `openssl pkeyutl -decrypt -pkeyopt rsa_padding_mode:oaep
+// -pkeyopt rsa_oaep_md:sha256` reverses.
+func WrapForRecipient(key *rsa.PublicKey, secret []byte) ([]byte, error) {
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, key, secret, nil)
+}
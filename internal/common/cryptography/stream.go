@@ -0,0 +1,230 @@
+package cryptography
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Segmented AES-GCM, decryptable front to back without holding the whole
+// ciphertext. A header of magic, segment size and nonce prefix is followed by
+// segments sealed independently under nonce prefix, segment counter and a
+// final flag, so reordered, truncated or extended streams fail to open.
+const (
+	StreamSegmentSize = 64 * 1024
+
+	streamMagic        = "MRS1"
+	streamPrefixSize   = 7
+	streamHeaderSize   = len(streamMagic) + 4 + streamPrefixSize
+	streamTagSize      = 16
+	streamMaxSegments  = 1<<32 - 1
+	streamFinalSegment = 1
+)
+
+var ErrStreamCorrupted = errors.New("encrypted stream is corrupted")
+
+// IsStream reports whether ciphertext starts like a segmented stream.
+func IsStream(ciphertext []byte) bool {
+	return bytes.HasPrefix(ciphertext, []byte(streamMagic))
+}
+
+// StreamPlaintextSize is the plaintext size of a segmented stream of the
+// given ciphertext size.
+func StreamPlaintextSize(size int64) int64 {
+	body := size - int64(streamHeaderSize)
+	segments := (body + StreamSegmentSize + streamTagSize - 1) / (StreamSegmentSize + streamTagSize)
+	return max(0, body-segments*streamTagSize)
+}
+
+// StreamCiphertextSize is the size of the segmented stream sealing a
+// plaintext of the given size.
+func StreamCiphertextSize(size int64) int64 {
+	segments := max(1, (size+StreamSegmentSize-1)/StreamSegmentSize)
+	return int64(streamHeaderSize) + size + segments*streamTagSize
+}
+
+func newStreamCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func streamNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, streamPrefixSize+4+1)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamPrefixSize:], counter)
+	if final {
+		nonce[len(nonce)-1] = streamFinalSegment
+	}
+	return nonce
+}
+
+// EncryptStream seals plaintext as a segmented stream.
+func EncryptStream(key, plaintext []byte) ([]byte, error) {
+	segments := max(1, (len(plaintext)+StreamSegmentSize-1)/StreamSegmentSize)
+	if segments > streamMaxSegments {
+		return nil, errors.New("plaintext too large for a stream")
+	}
+	header, err := NewStreamHeader()
+	if err != nil {
+		return nil, err
+	}
+	sealer, err := NewStreamSealer(key, header)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, streamHeaderSize+len(plaintext)+segments*streamTagSize)
+	out = append(out, header...)
+	for i := range segments {
+		start := i * StreamSegmentSize
+		end := min(start+StreamSegmentSize, len(plaintext))
+		out = sealer.Seal(out, uint32(i), i == segments-1, plaintext[start:end])
+	}
+	return out, nil
+}
+
+// NewStreamHeader starts a segmented stream, under a random nonce prefix.
+func NewStreamHeader() ([]byte, error) {
+	prefix := make([]byte, streamPrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, streamHeaderSize)
+	header = append(header, streamMagic...)
+	header = binary.BigEndian.AppendUint32(header, StreamSegmentSize)
+	return append(header, prefix...), nil
+}
+
+// StreamSealer seals the segments of a stream one at a time, for plaintext
+// that arrives in pieces.
+type StreamSealer struct {
+	gcm    cipher.AEAD
+	prefix []byte
+}
+
+// NewStreamSealer seals segments following header, as NewStreamHeader made.
+func NewStreamSealer(key, header []byte) (*StreamSealer, error) {
+	if len(header) != streamHeaderSize || !IsStream(header) ||
+		binary.BigEndian.Uint32(header[len(streamMagic):]) != StreamSegmentSize {
+		return nil, ErrStreamCorrupted
+	}
+	gcm, err := newStreamCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamSealer{gcm: gcm, prefix: header[len(streamMagic)+4:]}, nil
+}
+
+// Seal appends segment, sealed as the counter-th one, to dst. Segments but
+// the final one must be StreamSegmentSize long.
+func (s *StreamSealer) Seal(dst []byte, counter uint32, final bool, segment []byte) []byte {
+	return s.gcm.Seal(dst, streamNonce(s.prefix, counter, final), segment, nil)
+}
+
+// StreamReader opens a segmented stream as it is read.
+type StreamReader struct {
+	source  io.Reader
+	gcm     cipher.AEAD
+	prefix  []byte
+	segment []byte
+	carry   bool
+	counter uint32
+	plain   []byte
+	done    bool
+	err     error
+}
+
+// NewStreamReader reads the stream header off source.
+func NewStreamReader(key []byte, source io.Reader) (*StreamReader, error) {
+	gcm, err := newStreamCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(source, header); err != nil || !IsStream(header) {
+		return nil, ErrStreamCorrupted
+	}
+	segmentSize := binary.BigEndian.Uint32(header[len(streamMagic):])
+	if segmentSize == 0 || segmentSize > 16*StreamSegmentSize {
+		return nil, fmt.Errorf("%w: segment size %d", ErrStreamCorrupted, segmentSize)
+	}
+
+	return &StreamReader{
+		source: source,
+		gcm:    gcm,
+		prefix: header[len(streamMagic)+4:],
+		// one byte more than a sealed segment, to tell the final one apart
+		segment: make([]byte, int(segmentSize)+streamTagSize+1),
+	}, nil
+}
+
+func (r *StreamReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next opens the following segment. A segment is final when the source ends
+// within it, found out by reading one byte past it, which is carried over as
+// the start of the next segment otherwise.
+func (r *StreamReader) next() error {
+	start := 0
+	if r.carry {
+		start = 1
+	}
+	n, err := io.ReadFull(r.source, r.segment[start:])
+	n += start
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		if n < streamTagSize {
+			return ErrStreamCorrupted
+		}
+		plain, err := r.gcm.Open(nil, streamNonce(r.prefix, r.counter, true), r.segment[:n], nil)
+		if err != nil {
+			return ErrStreamCorrupted
+		}
+		r.plain, r.done = plain, true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	sealedSize := len(r.segment) - 1
+	if r.counter == streamMaxSegments {
+		return ErrStreamCorrupted
+	}
+	plain, err := r.gcm.Open(nil, streamNonce(r.prefix, r.counter, false), r.segment[:sealedSize], nil)
+	if err != nil {
+		return ErrStreamCorrupted
+	}
+	r.counter++
+	r.segment[0], r.carry = r.segment[sealedSize], true
+	r.plain = plain
+	return nil
+}
+
+// DecryptStream opens a whole segmented stream.
+func DecryptStream(key, ciphertext []byte) ([]byte, error) {
+	reader, err := NewStreamReader(key, bytes.NewReader(ciphertext))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
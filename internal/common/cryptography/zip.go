@@ -0,0 +1,143 @@
+package cryptography
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// WinZip AES parameters, AE-2 with 256-bits keys, as read by 7-Zip, WinZip
+// and libarchive.
+const (
+	zipMethodAes     = 99
+	zipAesExtraId    = 0x9901
+	zipAesVersion    = 2
+	zipAesStrength   = 3
+	zipAesSaltSize   = 16
+	zipAesKeySize    = 32
+	zipAesVerifySize = 2
+	zipAesMacSize    = 10
+	zipAesIterations = 1000
+	zipFlagEncrypted = 0x1
+)
+
+// ZipWriter writes a ZIP archive whose entries are encrypted with WinZip AES
+// under a single password. Entries are deflated before encryption.
+type ZipWriter struct {
+	zip      *zip.Writer
+	password string
+	// random supplies the salts
+	random io.Reader
+}
+
+func NewZipWriter(w io.Writer, password string) (*ZipWriter, error) {
+	if password == "" {
+		return nil, errors.New("zip: empty password")
+	}
+	return &ZipWriter{zip: zip.NewWriter(w), password: password, random: rand.Reader}, nil
+}
+
+// Add writes content as the entry name.
+func (z *ZipWriter) Add(name string, content []byte, modified time.Time) error {
+	compressed := new(bytes.Buffer)
+	deflater, err := flate.NewWriter(compressed, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := deflater.Write(content); err != nil {
+		return err
+	}
+	if err := deflater.Close(); err != nil {
+		return err
+	}
+
+	salt := make([]byte, zipAesSaltSize)
+	if _, err := io.ReadFull(z.random, salt); err != nil {
+		return err
+	}
+	keys, err := pbkdf2.Key(sha1.New, z.password, salt, zipAesIterations, 2*zipAesKeySize+zipAesVerifySize)
+	if err != nil {
+		return err
+	}
+	encryptionKey, macKey, verifier := keys[:zipAesKeySize], keys[zipAesKeySize:2*zipAesKeySize], keys[2*zipAesKeySize:]
+
+	ciphertext, err := zipAesCtr(encryptionKey, compressed.Bytes())
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha1.New, macKey)
+	mac.Write(ciphertext)
+
+	// AE-2 leaves the CRC out, the MAC authenticates the entry instead
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], zipAesExtraId)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], zipAesVersion)
+	copy(extra[6:], "AE")
+	extra[8] = zipAesStrength
+	binary.LittleEndian.PutUint16(extra[9:], zip.Deflate)
+
+	header := &zip.FileHeader{
+		Name:               name,
+		Method:             zipMethodAes,
+		Flags:              zipFlagEncrypted,
+		Modified:           modified,
+		Extra:              extra,
+		CompressedSize64:   uint64(len(salt) + len(verifier) + len(ciphertext) + zipAesMacSize),
+		UncompressedSize64: uint64(len(content)),
+	}
+	// unlike CreateHeader, CreateRaw leaves the MS-DOS timestamp to the caller
+	header.ModifiedDate, header.ModifiedTime = msDosTime(modified)
+	w, err := z.zip.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	for _, part := range [][]byte{salt, verifier, ciphertext, mac.Sum(nil)[:zipAesMacSize]} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (z *ZipWriter) Close() error {
+	return z.zip.Close()
+}
+
+func msDosTime(t time.Time) (date, clock uint16) {
+	t = t.UTC()
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, clock
+}
+
+// zipAesCtr is AES in counter mode as WinZip runs it, a little endian
+// counter starting at one, which cipher.NewCTR cannot express.
+func zipAesCtr(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := make([]byte, len(plaintext))
+	counter := make([]byte, aes.BlockSize)
+	keystream := make([]byte, aes.BlockSize)
+	for offset, n := 0, uint64(1); offset < len(plaintext); offset, n = offset+aes.BlockSize, n+1 {
+		binary.LittleEndian.PutUint64(counter, n)
+		block.Encrypt(keystream, counter)
+		end := min(offset+aes.BlockSize, len(plaintext))
+		for i := offset; i < end; i++ {
+			ciphertext[i] = plaintext[i] ^ keystream[i-offset]
+		}
+	}
+	return ciphertext, nil
+}
@@ -0,0 +1,29 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnsupportedKind is returned for document kinds an extractor has no
+// parser for.
+var ErrUnsupportedKind = errors.New("extractor: unsupported document kind")
+
+type Field struct {
+	Value      string  `json:"value"`
+	Confidence float64 `json:"confidence" doc:"Recognition confidence between 0 and 1"`
+}
+
+type Fields map[string]Field
+
+// Extractor turns a decrypted document into structured fields.
+type Extractor interface {
+	Name() string
+	Extract(ctx context.Context, kind string, content []byte) (Fields, error)
+}
+
+// Line is a recognized line of text with its mean word confidence.
+type Line struct {
+	Text       string
+	Confidence float64
+}
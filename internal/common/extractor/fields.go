@@ -0,0 +1,62 @@
+package extractor
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+// KindFields lists, per document kind, the fields its parser produces.
+var KindFields = map[string][]string{
+	constant.DOCUMENT_KIND_KTP: {
+		KTP_FIELD_NIK,
+		KTP_FIELD_NAME,
+		KTP_FIELD_BIRTH_PLACE,
+		KTP_FIELD_BIRTH_DATE,
+		KTP_FIELD_GENDER,
+		KTP_FIELD_ADDRESS,
+	},
+	constant.DOCUMENT_KIND_SALARY_SLIP: {
+		SALARY_FIELD_EMPLOYER,
+		SALARY_FIELD_PERIOD,
+		SALARY_FIELD_GROSS,
+		SALARY_FIELD_NET,
+		SALARY_FIELD_CURRENCY,
+	},
+}
+
+var (
+	nikValuePattern      = regexp.MustCompile(`^[0-9]{16}$`)
+	amountValuePattern   = regexp.MustCompile(`^[0-9]+(\.[0-9]{1,2})?$`)
+	currencyValuePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// ValidateField checks that a value has the normalized form the parsers emit,
+// so values set by hand compare like extracted ones.
+func ValidateField(name, value string) error {
+	var ok bool
+	switch name {
+	case KTP_FIELD_NIK:
+		ok = nikValuePattern.MatchString(value)
+	case KTP_FIELD_BIRTH_DATE:
+		_, err := time.Parse(time.DateOnly, value)
+		ok = err == nil
+	case KTP_FIELD_GENDER:
+		ok = value == "male" || value == "female"
+	case SALARY_FIELD_PERIOD:
+		_, err := time.Parse("2006-01", value)
+		ok = err == nil
+	case SALARY_FIELD_GROSS, SALARY_FIELD_NET:
+		ok = amountValuePattern.MatchString(value)
+	case SALARY_FIELD_CURRENCY:
+		ok = currencyValuePattern.MatchString(value)
+	default:
+		ok = value != ""
+	}
+	if !ok {
+		return fmt.Errorf("malformed value for field %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package extractor
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	KTP_FIELD_NIK         = "nik"
+	KTP_FIELD_NAME        = "name"
+	KTP_FIELD_BIRTH_PLACE = "birthPlace"
+	KTP_FIELD_BIRTH_DATE  = "birthDate"
+	KTP_FIELD_GENDER      = "gender"
+	KTP_FIELD_ADDRESS     = "address"
+)
+
+var (
+	ktpLabelSeparator = `\s*[:;.]?\s*`
+	ktpNikPattern     = regexp.MustCompile(`(?i)^n[il1|]k` + ktpLabelSeparator + `([0-9OoIlDB ]{16,24})`)
+	ktpNamePattern    = regexp.MustCompile(`(?i)^nama` + ktpLabelSeparator + `(.+)$`)
+	ktpBirthPattern   = regexp.MustCompile(`(?i)^tempat\s*/?\s*tg[l1]\.?\s*lahir` + ktpLabelSeparator + `(.+?)[\s,.]+(\d{2})[-/ .](\d{2})[-/ .](\d{4})`)
+	ktpGenderPattern  = regexp.MustCompile(`(?i)^jenis\s*kelamin` + ktpLabelSeparator + `(laki[\s-]*laki|perempuan)`)
+	ktpAddressPattern = regexp.MustCompile(`(?i)^alamat` + ktpLabelSeparator + `(.+)$`)
+)
+
+// nikDigitReplacer undoes the letter-for-digit confusions OCR typically makes
+// on the NIK line, which only ever holds digits.
+var nikDigitReplacer = strings.NewReplacer(
+	"O", "0", "o", "0", "D", "0",
+	"I", "1", "l", "1",
+	"B", "8",
+	" ", "",
+)
+
+// ParseKtp picks the printed fields of an Indonesian KTP out of OCR lines.
+// Fields that could not be read are left out rather than guessed.
+func ParseKtp(lines []Line) Fields {
+	fields := make(Fields)
+	for _, line := range lines {
+		text := strings.TrimSpace(line.Text)
+
+		if m := ktpNikPattern.FindStringSubmatch(text); m != nil {
+			nik := nikDigitReplacer.Replace(m[1])
+			if len(nik) == 16 {
+				fields[KTP_FIELD_NIK] = Field{nik, line.Confidence}
+			}
+			continue
+		}
+		if m := ktpNamePattern.FindStringSubmatch(text); m != nil {
+			fields[KTP_FIELD_NAME] = Field{strings.ToUpper(strings.TrimSpace(m[1])), line.Confidence}
+			continue
+		}
+		if m := ktpBirthPattern.FindStringSubmatch(text); m != nil {
+			fields[KTP_FIELD_BIRTH_PLACE] = Field{strings.ToUpper(strings.TrimSpace(m[1])), line.Confidence}
+			date, err := time.Parse("02-01-2006", m[2]+"-"+m[3]+"-"+m[4])
+			if err == nil {
+				fields[KTP_FIELD_BIRTH_DATE] = Field{date.Format(time.DateOnly), line.Confidence}
+			}
+			continue
+		}
+		if m := ktpGenderPattern.FindStringSubmatch(text); m != nil {
+			gender := "female"
+			if strings.HasPrefix(strings.ToLower(m[1]), "laki") {
+				gender = "male"
+			}
+			fields[KTP_FIELD_GENDER] = Field{gender, line.Confidence}
+			continue
+		}
+		if m := ktpAddressPattern.FindStringSubmatch(text); m != nil {
+			fields[KTP_FIELD_ADDRESS] = Field{strings.ToUpper(strings.TrimSpace(m[1])), line.Confidence}
+			continue
+		}
+	}
+	return fields
+}
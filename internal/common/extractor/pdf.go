@@ -0,0 +1,46 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrNoTextLayer is returned for PDFs that are scans without embedded text.
+var ErrNoTextLayer = errors.New("extractor: pdf has no text layer")
+
+var pdfMagicBytes = []byte("%PDF-")
+
+func IsPdf(content []byte) bool {
+	return bytes.HasPrefix(content, pdfMagicBytes)
+}
+
+// readPdfText runs pdftotext in layout mode, which keeps a label and its
+// value on the same line, streaming the document through stdin and stdout.
+// Text layers carry no recognition confidence, so every line gets 1.
+func readPdfText(ctx context.Context, path string, content []byte) ([]Line, error) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, path, "-layout", "-enc", "UTF-8", "-", "-") // #nosec G204 -- binary path comes from config
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("pdftotext: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	lines := make([]Line, 0)
+	for text := range strings.SplitSeq(stdout.String(), "\n") {
+		// layout mode pads columns with runs of spaces
+		text = strings.Join(strings.Fields(strings.ReplaceAll(text, "\f", "")), " ")
+		if text != "" {
+			lines = append(lines, Line{Text: text, Confidence: 1})
+		}
+	}
+	if len(lines) == 0 {
+		return nil, ErrNoTextLayer
+	}
+	return lines, nil
+}
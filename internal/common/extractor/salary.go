@@ -0,0 +1,157 @@
+package extractor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	SALARY_FIELD_EMPLOYER = "employer"
+	SALARY_FIELD_PERIOD   = "period"
+	SALARY_FIELD_GROSS    = "grossIncome"
+	SALARY_FIELD_NET      = "netIncome"
+	SALARY_FIELD_CURRENCY = "currency"
+)
+
+var (
+	salaryEmployerPattern = regexp.MustCompile(`(?i)^(?:nama\s+)?(?:perusahaan|company|employer)` + ktpLabelSeparator + `(.+)$`)
+	salaryCompanyPattern  = regexp.MustCompile(`^((?:PT|CV)\.?\s+[A-Z0-9][A-Za-z0-9 .,&-]+?)\s*$`)
+	salaryPeriodPattern   = regexp.MustCompile(`(?i)(?:periode|bulan|pay\s*period|period)` + ktpLabelSeparator + `(.+)$`)
+	salaryGrossPattern    = regexp.MustCompile(`(?i)(?:total\s+pendapatan|total\s+penerimaan|gaji\s+kotor|penghasilan\s+bruto|gross\s+(?:pay|salary|income)|total\s+earnings)` + ktpLabelSeparator + `(.+)$`)
+	salaryNetPattern      = regexp.MustCompile(`(?i)(?:gaji\s+bersih|penerimaan\s+bersih|penghasilan\s+bersih|take\s+home\s+pay|thp|jumlah\s+diterima|net\s+(?:pay|salary|income))` + ktpLabelSeparator + `(.+)$`)
+	salaryAmountPattern   = regexp.MustCompile(`(?i)(rp\.?|idr|usd|us\$|\$|sgd)?\s*([0-9][0-9.,]*[0-9]|[0-9])`)
+
+	periodNumericPattern = regexp.MustCompile(`\b(\d{1,2})[-/](\d{4})\b|\b(\d{4})[-/](\d{1,2})\b`)
+	periodNamedPattern   = regexp.MustCompile(`(?i)\b([a-z]+)\.?\s+(\d{4})\b`)
+)
+
+var currencyCodes = map[string]string{
+	"rp":  "IDR",
+	"rp.": "IDR",
+	"idr": "IDR",
+	"usd": "USD",
+	"us$": "USD",
+	"$":   "USD",
+	"sgd": "SGD",
+}
+
+// monthNames maps Indonesian and English month names, and their common
+// abbreviations, to the month number.
+var monthNames = map[string]time.Month{
+	"januari": 1, "january": 1, "jan": 1,
+	"februari": 2, "february": 2, "feb": 2, "pebruari": 2,
+	"maret": 3, "march": 3, "mar": 3,
+	"april": 4, "apr": 4,
+	"mei": 5, "may": 5,
+	"juni": 6, "june": 6, "jun": 6,
+	"juli": 7, "july": 7, "jul": 7,
+	"agustus": 8, "august": 8, "agu": 8, "aug": 8, "agt": 8,
+	"september": 9, "sep": 9, "sept": 9,
+	"oktober": 10, "october": 10, "okt": 10, "oct": 10,
+	"november": 11, "nopember": 11, "nov": 11,
+	"desember": 12, "december": 12, "des": 12, "dec": 12,
+}
+
+// ParseSalarySlip picks employer, pay period, gross and net income out of the
+// lines of a salary slip, whether they come from a PDF text layer or OCR.
+// Amounts are normalized to plain decimals, periods to YYYY-MM.
+func ParseSalarySlip(lines []Line) Fields {
+	fields := make(Fields)
+	currency := ""
+	setAmount := func(field, text string, confidence float64) {
+		if _, ok := fields[field]; ok {
+			return
+		}
+		code, amount, ok := parseAmount(text)
+		if !ok {
+			return
+		}
+		fields[field] = Field{amount, confidence}
+		if code != "" && currency == "" {
+			currency = code
+			fields[SALARY_FIELD_CURRENCY] = Field{code, confidence}
+		}
+	}
+
+	for _, line := range lines {
+		text := strings.TrimSpace(line.Text)
+		if text == "" {
+			continue
+		}
+
+		if m := salaryEmployerPattern.FindStringSubmatch(text); m != nil {
+			fields[SALARY_FIELD_EMPLOYER] = Field{strings.ToUpper(strings.TrimSpace(m[1])), line.Confidence}
+			continue
+		}
+		if _, ok := fields[SALARY_FIELD_EMPLOYER]; !ok {
+			if m := salaryCompanyPattern.FindStringSubmatch(text); m != nil {
+				fields[SALARY_FIELD_EMPLOYER] = Field{strings.ToUpper(m[1]), line.Confidence}
+				continue
+			}
+		}
+		if m := salaryPeriodPattern.FindStringSubmatch(text); m != nil {
+			if _, ok := fields[SALARY_FIELD_PERIOD]; !ok {
+				if period, ok := parsePeriod(m[1]); ok {
+					fields[SALARY_FIELD_PERIOD] = Field{period, line.Confidence}
+				}
+			}
+			continue
+		}
+		if m := salaryNetPattern.FindStringSubmatch(text); m != nil {
+			setAmount(SALARY_FIELD_NET, m[1], line.Confidence)
+			continue
+		}
+		if m := salaryGrossPattern.FindStringSubmatch(text); m != nil {
+			setAmount(SALARY_FIELD_GROSS, m[1], line.Confidence)
+			continue
+		}
+	}
+	return fields
+}
+
+func parsePeriod(text string) (string, bool) {
+	if m := periodNumericPattern.FindStringSubmatch(text); m != nil {
+		month, year := m[1], m[2]
+		if month == "" {
+			month, year = m[4], m[3]
+		}
+		date, err := time.Parse("1-2006", strings.TrimLeft(month, "0")+"-"+year)
+		if err != nil {
+			return "", false
+		}
+		return date.Format("2006-01"), true
+	}
+	for _, m := range periodNamedPattern.FindAllStringSubmatch(text, -1) {
+		if month, ok := monthNames[strings.ToLower(m[1])]; ok {
+			return fmt.Sprintf("%s-%02d", m[2], month), true
+		}
+	}
+	return "", false
+}
+
+// parseAmount reads the first amount of text. A final separator followed by
+// exactly two digits is taken as the decimal point, any other separator as a
+// thousands separator, which covers both 1.234.567,00 and 1,234,567.00.
+func parseAmount(text string) (currency, amount string, ok bool) {
+	m := salaryAmountPattern.FindStringSubmatch(text)
+	if m == nil {
+		return "", "", false
+	}
+	currency = currencyCodes[strings.ToLower(m[1])]
+	digits := m[2]
+
+	integer, fraction := digits, ""
+	if i := strings.LastIndexAny(digits, ".,"); i >= 0 && len(digits)-i-1 == 2 {
+		integer, fraction = digits[:i], digits[i+1:]
+	}
+	integer = strings.NewReplacer(".", "", ",", "").Replace(integer)
+	if integer == "" {
+		return "", "", false
+	}
+	if fraction != "" && fraction != "00" {
+		return currency, integer + "." + fraction, true
+	}
+	return currency, integer, true
+}
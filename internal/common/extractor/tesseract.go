@@ -0,0 +1,144 @@
+package extractor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+// Tesseract shells out to the tesseract CLI, feeding the image through stdin
+// so the plaintext never touches the disk. PDFs are read from their text
+// layer with pdftotext instead.
+type Tesseract struct {
+	path          string
+	pdftotextPath string
+	languages     string
+	timeout       time.Duration
+}
+
+func NewTesseract(path, pdftotextPath, languages string, timeout time.Duration) *Tesseract {
+	if path == "" {
+		path = "tesseract"
+	}
+	if pdftotextPath == "" {
+		pdftotextPath = "pdftotext"
+	}
+	if languages == "" {
+		languages = "ind+eng"
+	}
+	return &Tesseract{path, pdftotextPath, languages, timeout}
+}
+
+func (t *Tesseract) Name() string {
+	return "tesseract"
+}
+
+func (t *Tesseract) Extract(ctx context.Context, kind string, content []byte) (Fields, error) {
+	switch kind {
+	case constant.DOCUMENT_KIND_KTP:
+		lines, err := t.Recognize(ctx, content)
+		if err != nil {
+			return nil, err
+		}
+		return ParseKtp(lines), nil
+	case constant.DOCUMENT_KIND_SALARY_SLIP:
+		var (
+			lines []Line
+			err   error
+		)
+		if IsPdf(content) {
+			lines, err = readPdfText(ctx, t.pdftotextPath, content)
+		} else {
+			lines, err = t.Recognize(ctx, content)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ParseSalarySlip(lines), nil
+	default:
+		return nil, ErrUnsupportedKind
+	}
+}
+
+// Recognize runs OCR and regroups the TSV word boxes into lines.
+func (t *Tesseract) Recognize(ctx context.Context, content []byte) ([]Line, error) {
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, t.path, "stdin", "stdout", "-l", t.languages, "tsv") // #nosec G204 -- binary path comes from config
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("tesseract: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseTsv(stdout.Bytes())
+}
+
+// parseTsv reads tesseract TSV output, columns being level, page_num,
+// block_num, par_num, line_num, word_num, left, top, width, height, conf and
+// text. Only word rows (level 5) carry text.
+func parseTsv(raw []byte) ([]Line, error) {
+	type lineKey struct{ page, block, par, line string }
+
+	order := make([]lineKey, 0)
+	words := make(map[lineKey][]string)
+	confidences := make(map[lineKey][]float64)
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	header := true
+	for scanner.Scan() {
+		if header {
+			header = false
+			continue
+		}
+		columns := strings.Split(scanner.Text(), "\t")
+		if len(columns) < 12 || columns[0] != "5" {
+			continue
+		}
+		text := strings.TrimSpace(columns[11])
+		if text == "" {
+			continue
+		}
+		confidence, err := strconv.ParseFloat(columns[10], 64)
+		if err != nil || confidence < 0 {
+			continue
+		}
+
+		key := lineKey{columns[1], columns[2], columns[3], columns[4]}
+		if _, ok := words[key]; !ok {
+			order = append(order, key)
+		}
+		words[key] = append(words[key], text)
+		confidences[key] = append(confidences[key], confidence)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	lines := make([]Line, len(order))
+	for i, key := range order {
+		total := 0.0
+		for _, confidence := range confidences[key] {
+			total += confidence
+		}
+		lines[i] = Line{
+			Text:       strings.Join(words[key], " "),
+			Confidence: total / float64(len(confidences[key])) / 100,
+		}
+	}
+	return lines, nil
+}
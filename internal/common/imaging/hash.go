@@ -0,0 +1,96 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"slices"
+
+	"golang.org/x/image/draw"
+)
+
+// grayscale shrinks img to w×h luminance values, row by row.
+func grayscale(img image.Image, w, h int) []float64 {
+	small := image.NewGray(image.Rect(0, 0, w, h))
+	draw.BiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	values := make([]float64, w*h)
+	for y := range h {
+		for x := range w {
+			values[y*w+x] = float64(small.At(x, y).(color.Gray).Y)
+		}
+	}
+	return values
+}
+
+// DHash is the difference hash: each bit tells whether a pixel of the 9×8
+// downscaled image is brighter than its right neighbour.
+func DHash(img image.Image) uint64 {
+	values := grayscale(img, 9, 8)
+	var hash uint64
+	for y := range 8 {
+		for x := range 8 {
+			hash <<= 1
+			if values[y*9+x] > values[y*9+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// PHash is the DCT based perceptual hash: each bit tells whether one of the
+// 8×8 lowest frequencies of the 32×32 downscaled image lies above their
+// median. It survives recompression, rescaling and small edits.
+func PHash(img image.Image) uint64 {
+	const size, low = 32, 8
+	values := grayscale(img, size, size)
+
+	// separable DCT-II, only the low frequencies are needed
+	cosines := make([]float64, low*size)
+	for u := range low {
+		for x := range size {
+			cosines[u*size+x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * size))
+		}
+	}
+	rows := make([]float64, size*low)
+	for y := range size {
+		for u := range low {
+			sum := 0.0
+			for x := range size {
+				sum += values[y*size+x] * cosines[u*size+x]
+			}
+			rows[y*low+u] = sum
+		}
+	}
+	coefficients := make([]float64, low*low)
+	for v := range low {
+		for u := range low {
+			sum := 0.0
+			for y := range size {
+				sum += rows[y*low+u] * cosines[v*size+y]
+			}
+			coefficients[v*low+u] = sum
+		}
+	}
+
+	// the DC term only carries the mean brightness, keep it out of the median
+	sorted := slices.Clone(coefficients[1:])
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for _, coefficient := range coefficients {
+		hash <<= 1
+		if coefficient > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
+
+// HammingDistance counts the bits two hashes differ in.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,107 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/draw"
+)
+
+var identifierMagic = []byte{'M', 'R'}
+
+// ErrIdentifierNotFound is returned when no intact identifier frame could be
+// recovered from an image.
+var ErrIdentifierNotFound = errors.New("imaging: no embedded identifier found")
+
+// identifierFrame lays out magic | length | payload | crc32(payload).
+func identifierFrame(payload []byte) ([]byte, error) {
+	if len(payload) == 0 || len(payload) > 255 {
+		return nil, errors.New("imaging: identifier payload must be 1-255 bytes")
+	}
+	frame := make([]byte, 0, len(identifierMagic)+1+len(payload)+4)
+	frame = append(frame, identifierMagic...)
+	frame = append(frame, byte(len(payload)))
+	frame = append(frame, payload...)
+	frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(payload))
+	return frame, nil
+}
+
+// EmbedIdentifier hides payload in the least significant bit of the blue
+// channel, repeating the frame across the whole raster so a crop of the image
+// still carries at least one full copy. The result must be stored losslessly.
+func EmbedIdentifier(img image.Image, payload []byte) (image.Image, error) {
+	frame, err := identifierFrame(payload)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	bits := len(frame) * 8
+	pixels := bounds.Dx() * bounds.Dy()
+	if pixels < bits {
+		return nil, errors.New("imaging: image too small to carry identifier")
+	}
+
+	for i := 0; i < pixels; i++ {
+		bit := (frame[(i%bits)/8] >> (7 - uint(i%8))) & 1
+		blue := i*4 + 2
+		dst.Pix[blue] = (dst.Pix[blue] &^ 1) | bit
+	}
+
+	return dst, nil
+}
+
+// ExtractIdentifier scans every pixel offset for an intact frame, so a copy
+// surviving within a single row of a cropped image is still found, and
+// returns the first payload whose checksum matches.
+func ExtractIdentifier(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	pixels := bounds.Dx() * bounds.Dy()
+	readByte := func(offset int) (byte, bool) {
+		if offset+8 > pixels {
+			return 0, false
+		}
+		var b byte
+		for i := 0; i < 8; i++ {
+			b = b<<1 | src.Pix[(offset+i)*4+2]&1
+		}
+		return b, true
+	}
+
+	for start := 0; start+8*(len(identifierMagic)+1) <= pixels; start++ {
+		m0, _ := readByte(start)
+		m1, _ := readByte(start + 8)
+		if m0 != identifierMagic[0] || m1 != identifierMagic[1] {
+			continue
+		}
+		length, _ := readByte(start + 16)
+		if length == 0 {
+			continue
+		}
+		payload := make([]byte, length+4)
+		intact := true
+		for i := range payload {
+			b, ok := readByte(start + 24 + i*8)
+			if !ok {
+				intact = false
+				break
+			}
+			payload[i] = b
+		}
+		if !intact {
+			continue
+		}
+		checksum := binary.BigEndian.Uint32(payload[length:])
+		if crc32.ChecksumIEEE(payload[:length]) == checksum {
+			return payload[:length], nil
+		}
+	}
+
+	return nil, ErrIdentifierNotFound
+}
@@ -0,0 +1,125 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+
+	_ "image/jpeg"
+)
+
+// Decode reads any registered image format (PNG and JPEG) from raw bytes.
+func Decode(raw []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func EncodePNG(img image.Image) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseOrientation turns the exiftool Orientation field, either the numeric
+// form (-n) or the human readable one, into the EXIF orientation tag value.
+// Unknown values are treated as already upright.
+func ParseOrientation(value any) int {
+	switch v := value.(type) {
+	case float64:
+		if v >= 1 && v <= 8 {
+			return int(v)
+		}
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "mirror horizontal":
+			return 2
+		case "rotate 180":
+			return 3
+		case "mirror vertical":
+			return 4
+		case "mirror horizontal and rotate 270 cw":
+			return 5
+		case "rotate 90 cw":
+			return 6
+		case "mirror horizontal and rotate 90 cw":
+			return 7
+		case "rotate 270 cw":
+			return 8
+		}
+	}
+	return 1
+}
+
+// Orient applies the EXIF orientation so the returned image is upright.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	src := img.Bounds()
+	w, h := src.Dx(), src.Dy()
+	swap := orientation >= 5
+	dstW, dstH := w, h
+	if swap {
+		dstW, dstH = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(src.Min.X+x, src.Min.Y+y))
+		}
+	}
+
+	return dst
+}
+
+// Fit scales the image down, preserving the aspect ratio, so neither side
+// exceeds maxDimension. Images already within bounds are returned as is.
+func Fit(img image.Image, maxDimension int) (image.Image, error) {
+	if maxDimension < 1 {
+		return nil, errors.New("imaging: max dimension must be positive")
+	}
+
+	src := img.Bounds()
+	w, h := src.Dx(), src.Dy()
+	if w <= maxDimension && h <= maxDimension {
+		return img, nil
+	}
+
+	scale := math.Min(float64(maxDimension)/float64(w), float64(maxDimension)/float64(h))
+	dstW := max(1, int(math.Round(float64(w)*scale)))
+	dstH := max(1, int(math.Round(float64(h)*scale)))
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst, nil
+}
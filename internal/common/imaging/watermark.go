@@ -0,0 +1,85 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	monoFont     *opentype.Font
+	monoFontErr  error
+	monoFontOnce sync.Once
+)
+
+func loadFont() (*opentype.Font, error) {
+	monoFontOnce.Do(func() {
+		monoFont, monoFontErr = opentype.Parse(gomonobold.TTF)
+	})
+	return monoFont, monoFontErr
+}
+
+// Watermark tiles every line of text diagonally-staggered across the whole
+// image with a translucent fill, so cropping a region out of it still leaves
+// the marking visible. The font size follows the image width.
+func Watermark(img image.Image, lines ...string) (image.Image, error) {
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	if len(lines) == 0 {
+		return dst, nil
+	}
+
+	f, err := loadFont()
+	if err != nil {
+		return nil, err
+	}
+	size := max(8, float64(bounds.Dx())/40)
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	lineHeight := face.Metrics().Height.Ceil()
+	blockHeight := lineHeight * (len(lines) + 1)
+	shadow := image.NewUniform(color.NRGBA{0, 0, 0, 72})
+	fill := image.NewUniform(color.NRGBA{255, 255, 255, 110})
+
+	row := 0
+	for y := lineHeight; y < dst.Bounds().Dy()+blockHeight; y += blockHeight {
+		stagger := (row % 2) * (dst.Bounds().Dx() / 4)
+		for i, line := range lines {
+			advance := font.MeasureString(face, line).Ceil()
+			gap := advance + int(size)*4
+			for x := -stagger; x < dst.Bounds().Dx(); x += gap {
+				baseline := y + i*lineHeight
+				drawString(dst, face, shadow, x+1, baseline+1, line)
+				drawString(dst, face, fill, x, baseline, line)
+			}
+		}
+		row++
+	}
+
+	return dst, nil
+}
+
+func drawString(dst draw.Image, face font.Face, src image.Image, x, y int, text string) {
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  src,
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
@@ -0,0 +1,29 @@
+package keyservice
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/cryptography"
+)
+
+// NewFieldCipher unwraps the configured field encryption and blind index keys.
+// They are unwrapped once at startup and only ever held in memory.
+func (k KeyService) NewFieldCipher(ctx context.Context, fieldConfig config.FieldEncryption) (cryptography.FieldCipher, error) {
+	if !fieldConfig.Enabled {
+		return cryptography.FieldCipher{}, nil
+	}
+	if fieldConfig.EncryptionKey == "" || fieldConfig.IndexKey == "" {
+		return cryptography.FieldCipher{}, errors.New("field encryption enabled without wrapped keys")
+	}
+	encryptionKey, err := k.DecryptDataKey(ctx, fieldConfig.EncryptionKey, "")
+	if err != nil {
+		return cryptography.FieldCipher{}, err
+	}
+	indexKey, err := k.DecryptDataKey(ctx, fieldConfig.IndexKey, "")
+	if err != nil {
+		return cryptography.FieldCipher{}, err
+	}
+	return cryptography.NewFieldCipher(encryptionKey, indexKey)
+}
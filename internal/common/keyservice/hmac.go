@@ -0,0 +1,40 @@
+package keyservice
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	vaultApi "github.com/hashicorp/vault/api"
+)
+
+// Hmac computes a keyed HMAC-SHA256 of data with the transit HMAC key, which
+// never leaves Vault. The result is prefixed with the key version, so values
+// only compare equal when computed under the same version.
+func (k KeyService) Hmac(ctx context.Context, data []byte) (string, error) {
+	path := fmt.Sprintf(
+		"%s/hmac/%s/sha2-256",
+		k.config.TransitBasePath,
+		k.config.HmacKey,
+	)
+	secret, err := k.vault.Logical().WriteWithRequest(ctx,
+		vaultApi.NewLogicalWriteRequest(
+			path,
+			map[string]interface{}{"input": base64.StdEncoding.EncodeToString(data)},
+			make(http.Header),
+		))
+	if err != nil {
+		return "", err
+	}
+	untyped, ok := secret.Data["hmac"]
+	if !ok {
+		return "", errors.New("missing hmac response from vault")
+	}
+	hmac, ok := untyped.(string)
+	if !ok {
+		return "", errors.New("vault hmac is not a valid string type")
+	}
+	return hmac, nil
+}
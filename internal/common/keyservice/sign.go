@@ -0,0 +1,69 @@
+package keyservice
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	vaultApi "github.com/hashicorp/vault/api"
+)
+
+// Sign signs data with the transit signing key, returning Vault's versioned
+// signature string.
+func (k KeyService) Sign(ctx context.Context, data []byte) (string, error) {
+	path := fmt.Sprintf(
+		"%s/sign/%s",
+		k.config.TransitBasePath,
+		k.config.SigningKey,
+	)
+	secret, err := k.vault.Logical().WriteWithRequest(ctx,
+		vaultApi.NewLogicalWriteRequest(
+			path,
+			map[string]interface{}{"input": base64.StdEncoding.EncodeToString(data)},
+			make(http.Header),
+		))
+	if err != nil {
+		return "", err
+	}
+	untyped, ok := secret.Data["signature"]
+	if !ok {
+		return "", errors.New("missing signature response from vault")
+	}
+	signature, ok := untyped.(string)
+	if !ok {
+		return "", errors.New("vault signature is not a valid string type")
+	}
+	return signature, nil
+}
+
+// VerifySignature checks a signature produced by Sign.
+func (k KeyService) VerifySignature(ctx context.Context, data []byte, signature string) (bool, error) {
+	path := fmt.Sprintf(
+		"%s/verify/%s",
+		k.config.TransitBasePath,
+		k.config.SigningKey,
+	)
+	secret, err := k.vault.Logical().WriteWithRequest(ctx,
+		vaultApi.NewLogicalWriteRequest(
+			path,
+			map[string]interface{}{
+				"input":     base64.StdEncoding.EncodeToString(data),
+				"signature": signature,
+			},
+			make(http.Header),
+		))
+	if err != nil {
+		return false, err
+	}
+	untyped, ok := secret.Data["valid"]
+	if !ok {
+		return false, errors.New("missing valid response from vault")
+	}
+	valid, ok := untyped.(bool)
+	if !ok {
+		return false, errors.New("vault valid is not a valid bool type")
+	}
+	return valid, nil
+}
@@ -0,0 +1,140 @@
+package keyservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	vaultApi "github.com/hashicorp/vault/api"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+)
+
+type KeyService struct {
+	vault  *vaultApi.Client
+	config config.Vault
+}
+
+func New(vault *vaultApi.Client, config config.Vault) KeyService {
+	return KeyService{vault, config}
+}
+
+// GenerateDataKeys creates n random 32-bytes DEKs and wraps every one of them
+// with the transit key in a single batch request.
+func (k KeyService) GenerateDataKeys(ctx context.Context, n int) ([]SecretKey, error) {
+	keys := make([]SecretKey, n)
+	inputs := make([]TransitEncryptRequest, n)
+	for i := range keys {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		keyEncoded := base64.StdEncoding.EncodeToString(key)
+
+		digest := sha256.Sum256(key)
+		digestEncoded := base64.StdEncoding.EncodeToString(digest[:])
+
+		keys[i] = SecretKey{
+			Data:          key,
+			Encoded:       keyEncoded,
+			DigestEncoded: digestEncoded,
+		}
+		inputs[i] = TransitEncryptRequest{Plaintext: keyEncoded}
+	}
+	if n == 0 {
+		return keys, nil
+	}
+
+	path := fmt.Sprintf(
+		"%s/encrypt/%s",
+		k.config.TransitBasePath,
+		k.config.TransitKey,
+	)
+	secret, err := k.vault.Logical().WriteWithRequest(ctx,
+		vaultApi.NewLogicalWriteRequest(
+			path,
+			map[string]interface{}{"batch_input": inputs},
+			make(http.Header),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+	resultsUntyped, ok := secret.Data["batch_results"]
+	if !ok {
+		return nil, errors.New("vault transit secrets engine missing batch_results response field")
+	}
+	results, ok := resultsUntyped.([]interface{})
+	if !ok {
+		return nil, errors.New("body.batch_results is not the correct type")
+	}
+	if len(results) != len(keys) {
+		return nil, errors.New("vault transit batch_results length mismatch")
+	}
+	for i := range results {
+		resultUntyped, ok := results[i].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("body.batch_results item is not the correct type")
+		}
+		untyped, ok := resultUntyped["ciphertext"]
+		if !ok {
+			return nil, errors.New("body.batch_results item missing ciphertext")
+		}
+		ciphertext, ok := untyped.(string)
+		if !ok {
+			return nil, errors.New("body.batch_results ciphertext is not a valid string type")
+		}
+		keys[i].CiphertextEncoded = ciphertext
+	}
+
+	return keys, nil
+}
+
+// DecryptDataKey unwraps an EDEK through the transit key. When digestEncoded is
+// not empty, the unwrapped DEK is checked against its stored SHA256 digest.
+func (k KeyService) DecryptDataKey(ctx context.Context, edek, digestEncoded string) ([]byte, error) {
+	path := fmt.Sprintf(
+		"%s/decrypt/%s",
+		k.config.TransitBasePath,
+		k.config.TransitKey,
+	)
+	secret, err := k.vault.Logical().WriteWithRequest(ctx,
+		vaultApi.NewLogicalWriteRequest(
+			path,
+			map[string]interface{}{"ciphertext": edek},
+			make(http.Header),
+		))
+	if err != nil {
+		return nil, err
+	}
+	untyped, ok := secret.Data["plaintext"]
+	if !ok {
+		return nil, errors.New("missing plaintext response from vault")
+	}
+	dekEncoded, ok := untyped.(string)
+	if !ok {
+		return nil, errors.New("stored dek is not a valid string type")
+	}
+	dek, err := base64.StdEncoding.DecodeString(dekEncoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if digestEncoded != "" {
+		expected, err := base64.StdEncoding.DecodeString(digestEncoded)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(dek)
+		if subtle.ConstantTimeCompare(digest[:], expected) != 1 {
+			return nil, errors.New("dek digest mismatch")
+		}
+	}
+
+	return dek, nil
+}
@@ -0,0 +1,352 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/adapters/humachi"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	idempotencyMaxKeyLength   = 255
+	// a request still processing after this long is presumed dead, its key
+	// may be taken over by a retry
+	idempotencyStaleAfter    = 5 * time.Minute
+	idempotencySweepInterval = time.Hour
+)
+
+// IdempotencyKeyParam documents the Idempotency-Key header of operations
+// guarded by NewIdempotency.
+func (m Middleware) IdempotencyKeyParam() *huma.Param {
+	maxLength := idempotencyMaxKeyLength
+	return &huma.Param{
+		Name:        idempotencyKeyHeader,
+		In:          "header",
+		Description: "Unique key of this request. Retries under the same key replay the original response instead of repeating the operation.",
+		Schema:      &huma.Schema{Type: huma.TypeString, MaxLength: &maxLength},
+	}
+}
+
+// NewIdempotency makes requests carrying an Idempotency-Key header safe to
+// retry. The first request under a key runs and its response is kept, later
+// ones with the same fingerprint get that response replayed, and ones with a
+// different fingerprint are refused. Keys are scoped to the principal, so
+// it must run after NewOidcAuthorization.
+func (m Middleware) NewIdempotency() func(huma.Context, func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		key := ctx.Header(idempotencyKeyHeader)
+		if !m.config.Idempotency.Enabled || key == "" {
+			next(ctx)
+			return
+		}
+		principal, ok := ctx.Context().Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+		if !ok {
+			next(ctx)
+			return
+		}
+		if len(key) > idempotencyMaxKeyLength {
+			m.writeIdempotencyErr(ctx, http.StatusBadRequest, "idempotency key is too long")
+			return
+		}
+
+		r, _ := humachi.Unwrap(ctx)
+		body, err := io.ReadAll(io.LimitReader(r.Body, m.config.Idempotency.MaxBodySize+1))
+		if err != nil {
+			m.writeIdempotencyErr(ctx, http.StatusBadRequest, "failed to read request body")
+			return
+		}
+		if int64(len(body)) > m.config.Idempotency.MaxBodySize {
+			m.writeIdempotencyErr(ctx, http.StatusRequestEntityTooLarge, "request body is too large")
+			return
+		}
+		// the handler reads the body again, multipart forms included
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint, err := requestFingerprint(r, body)
+		if err != nil {
+			m.writeIdempotencyErr(ctx, http.StatusBadRequest, "malformed request body")
+			return
+		}
+		operationId := ""
+		if operation := ctx.Operation(); operation != nil {
+			operationId = operation.OperationID
+		}
+
+		claimed, stored, err := m.claimIdempotencyKey(ctx.Context(), principal.Subject, key, operationId, fingerprint)
+		if err != nil {
+			log.Error().Err(err).Msg("idempotency: failed to claim key")
+			m.writeIdempotencyErr(ctx, http.StatusInternalServerError, "failed to process idempotency key")
+			return
+		}
+		if !claimed {
+			m.replay(ctx, stored, fingerprint)
+			return
+		}
+
+		recorder := &recordingContext{humaContext: ctx, header: http.Header{}}
+		completed := false
+		defer func() {
+			// errors and panics leave the key free for the retry
+			if completed && recorder.status != 0 && recorder.status < http.StatusInternalServerError {
+				return
+			}
+			if _, err := m.pool.Exec(
+				context.WithoutCancel(ctx.Context()),
+				"DELETE FROM idempotency_keys WHERE subject = $1 AND key = $2",
+				principal.Subject,
+				key,
+			); err != nil {
+				log.Error().Err(err).Msg("idempotency: failed to release key")
+			}
+		}()
+
+		next(recorder)
+		completed = true
+		if recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+			return
+		}
+
+		headers, err := json.Marshal(recorder.header)
+		if err != nil {
+			log.Error().Err(err).Msg("idempotency: failed to encode response headers")
+			completed = false
+			return
+		}
+		if _, err := m.pool.Exec(
+			context.WithoutCancel(ctx.Context()),
+			`UPDATE idempotency_keys
+			SET response_status = $3, response_headers = $4, response_body = $5
+			WHERE subject = $1 AND key = $2`,
+			principal.Subject,
+			key,
+			recorder.status,
+			headers,
+			recorder.body.Bytes(),
+		); err != nil {
+			log.Error().Err(err).Msg("idempotency: failed to store response")
+			completed = false
+		}
+	}
+}
+
+// storedRequest is what was kept of an earlier request under a key.
+type storedRequest struct {
+	Fingerprint []byte
+	Status      *int
+	Headers     http.Header
+	Body        []byte
+}
+
+// claimIdempotencyKey records the request under key, unless a live request
+// already holds it, in which case that one is returned. Expired keys and
+// stale ones of the same request are taken over.
+func (m Middleware) claimIdempotencyKey(
+	ctx context.Context,
+	subject, key, operationId string,
+	fingerprint []byte,
+) (bool, storedRequest, error) {
+	var stored storedRequest
+	// the held key may be released between both statements, so try again
+	for range 2 {
+		now := time.Now()
+		tag, err := m.pool.Exec(ctx, `
+			INSERT INTO idempotency_keys (subject, key, operation_id, fingerprint, created_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (subject, key) DO UPDATE
+			SET operation_id = EXCLUDED.operation_id,
+				fingerprint = EXCLUDED.fingerprint,
+				response_status = NULL,
+				response_headers = NULL,
+				response_body = NULL,
+				created_at = EXCLUDED.created_at,
+				expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at <= EXCLUDED.created_at
+				OR (idempotency_keys.response_status IS NULL
+					AND idempotency_keys.created_at <= $7
+					AND idempotency_keys.fingerprint = EXCLUDED.fingerprint)`,
+			subject,
+			key,
+			operationId,
+			fingerprint,
+			now,
+			now.Add(time.Duration(m.config.Idempotency.Ttl)*time.Second),
+			now.Add(-idempotencyStaleAfter),
+		)
+		if err != nil {
+			return false, stored, err
+		}
+		if tag.RowsAffected() == 1 {
+			return true, stored, nil
+		}
+
+		var headers []byte
+		err = m.pool.QueryRow(ctx, `
+			SELECT fingerprint, response_status, response_headers, response_body
+			FROM idempotency_keys
+			WHERE subject = $1 AND key = $2`,
+			subject,
+			key,
+		).Scan(&stored.Fingerprint, &stored.Status, &headers, &stored.Body)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return false, stored, err
+		}
+		if headers != nil {
+			if err := json.Unmarshal(headers, &stored.Headers); err != nil {
+				return false, stored, err
+			}
+		}
+		return false, stored, nil
+	}
+	return false, stored, errors.New("idempotency key keeps changing hands")
+}
+
+// replay answers a retry with the response kept for its key.
+func (m Middleware) replay(ctx huma.Context, stored storedRequest, fingerprint []byte) {
+	if subtle.ConstantTimeCompare(stored.Fingerprint, fingerprint) != 1 {
+		m.writeIdempotencyErr(ctx, http.StatusConflict, "idempotency key was already used for a different request")
+		return
+	}
+	if stored.Status == nil {
+		m.writeIdempotencyErr(ctx, http.StatusConflict, "a request with this idempotency key is still processing")
+		return
+	}
+
+	for name, values := range stored.Headers {
+		for _, value := range values {
+			ctx.AppendHeader(name, value)
+		}
+	}
+	ctx.SetHeader(idempotencyReplayedHeader, "true")
+	ctx.SetStatus(*stored.Status)
+	if _, err := ctx.BodyWriter().Write(stored.Body); err != nil {
+		log.Warn().Err(err).Msg("idempotency: failed to replay response")
+	}
+}
+
+func (m Middleware) writeIdempotencyErr(ctx huma.Context, status int, msg string) {
+	if err := huma.WriteErr(m.api, ctx, status, msg); err != nil {
+		log.Warn().Err(err).Msg("idempotency: failed write http error")
+	}
+}
+
+// requestFingerprint digests what makes a request: its method, target and
+// body. Multipart bodies are digested by part, as clients pick a new
+// boundary on every attempt.
+func requestFingerprint(r *http.Request, body []byte) ([]byte, error) {
+	digest := sha256.New()
+	writeField(digest, []byte(r.Method))
+	writeField(digest, []byte(r.URL.RequestURI()))
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		writeField(digest, body)
+		return digest.Sum(nil), nil
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		writeField(digest, []byte(part.FormName()))
+		writeField(digest, []byte(part.FileName()))
+		writeField(digest, []byte(part.Header.Get("Content-Type")))
+		writeField(digest, content)
+	}
+	return digest.Sum(nil), nil
+}
+
+// writeField writes a length prefixed field, so fields cannot run into
+// each other.
+func writeField(digest hash.Hash, field []byte) {
+	digest.Write(binary.BigEndian.AppendUint64(nil, uint64(len(field))))
+	digest.Write(field)
+}
+
+// humaContext lets recordingContext embed huma.Context, whose Context method
+// would clash with a field of that name.
+type humaContext = huma.Context
+
+// recordingContext keeps a copy of the response written through it.
+type recordingContext struct {
+	humaContext
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (c *recordingContext) Unwrap() huma.Context {
+	return c.humaContext
+}
+
+func (c *recordingContext) SetStatus(code int) {
+	c.status = code
+	c.humaContext.SetStatus(code)
+}
+
+func (c *recordingContext) SetHeader(name, value string) {
+	c.header.Set(name, value)
+	c.humaContext.SetHeader(name, value)
+}
+
+func (c *recordingContext) AppendHeader(name, value string) {
+	c.header.Add(name, value)
+	c.humaContext.AppendHeader(name, value)
+}
+
+func (c *recordingContext) BodyWriter() io.Writer {
+	return io.MultiWriter(c.humaContext.BodyWriter(), &c.body)
+}
+
+// StartIdempotencySweeper deletes expired idempotency keys in the background.
+func (m Middleware) StartIdempotencySweeper(ctx context.Context) {
+	if !m.config.Idempotency.Enabled {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(idempotencySweepInterval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := m.pool.Exec(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= $1", time.Now()); err != nil {
+				log.Error().Err(err).Msg("idempotency: failed to delete expired keys")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
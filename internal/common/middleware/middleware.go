@@ -2,14 +2,16 @@ package middleware
 
 import (
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
 )
 
 type Middleware struct {
 	api    huma.API
 	config config.Config
+	pool   *pgxpool.Pool
 }
 
-func NewMiddleware(api huma.API, config config.Config) Middleware {
-	return Middleware{api, config}
+func NewMiddleware(api huma.API, config config.Config, pool *pgxpool.Pool) Middleware {
+	return Middleware{api, config, pool}
 }
@@ -37,7 +37,13 @@ func (m Middleware) NewOidcAuthorization(ctx context.Context) func(huma.Context,
 			return
 		}
 
+		roles, err := m.extractRoles(token)
+		if err != nil {
+			log.Debug().Err(err).Msg("oidc: failed to parse role claims")
+		}
+
 		ctx = huma.WithValue(ctx, constant.CONTEXT_KEY_PRINCIPAL, token)
+		ctx = huma.WithValue(ctx, constant.CONTEXT_KEY_ROLES, roles)
 		next(ctx)
 	}
 }
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"net"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+// RequestInfo describes the HTTP request an operation runs for.
+type RequestInfo struct {
+	ClientIp    string
+	UserAgent   string
+	OperationId string
+}
+
+// NewRequestInfo captures the client address, user agent and operation of
+// every request. Only the socket peer address is trusted, forwarded headers
+// are client controlled.
+func (m Middleware) NewRequestInfo() func(huma.Context, func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		clientIp, _, err := net.SplitHostPort(ctx.RemoteAddr())
+		if err != nil {
+			clientIp = ctx.RemoteAddr()
+		}
+		info := RequestInfo{
+			ClientIp:  clientIp,
+			UserAgent: ctx.Header("User-Agent"),
+		}
+		if operation := ctx.Operation(); operation != nil {
+			info.OperationId = operation.OperationID
+		}
+		next(huma.WithValue(ctx, constant.CONTEXT_KEY_REQUEST_INFO, info))
+	}
+}
+
+func RequestInfoFrom(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(constant.CONTEXT_KEY_REQUEST_INFO).(RequestInfo)
+	return info
+}
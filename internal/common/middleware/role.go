@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/rs/zerolog/log"
+)
+
+// keycloakClaims mirrors where Keycloak puts realm and client roles in a token.
+type keycloakClaims struct {
+	RealmAccess struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+	ResourceAccess map[string]struct {
+		Roles []string `json:"roles"`
+	} `json:"resource_access"`
+}
+
+func (m Middleware) extractRoles(token *oidc.IDToken) ([]string, error) {
+	var claims keycloakClaims
+	if err := token.Claims(&claims); err != nil {
+		return nil, err
+	}
+	roles := claims.RealmAccess.Roles
+	if client, ok := claims.ResourceAccess[m.config.Oidc.ClientId]; ok {
+		roles = append(roles, client.Roles...)
+	}
+	return roles, nil
+}
+
+// HasRole reports whether the authenticated principal holds any of roles.
+func HasRole(ctx context.Context, roles ...string) bool {
+	granted, ok := ctx.Value(constant.CONTEXT_KEY_ROLES).([]string)
+	if !ok {
+		return false
+	}
+	for _, role := range roles {
+		if role != "" && slices.Contains(granted, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRoleAuthorization refuses principals holding none of roles. It must run
+// after NewOidcAuthorization, which populates the granted roles.
+func (m Middleware) NewRoleAuthorization(roles ...string) func(huma.Context, func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		if !HasRole(ctx.Context(), roles...) {
+			if err := huma.WriteErr(m.api, ctx, http.StatusForbidden, "insufficient role"); err != nil {
+				log.Warn().Err(err).Msg("role: failed write http error")
+			}
+			return
+		}
+		next(ctx)
+	}
+}
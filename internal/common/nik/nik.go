@@ -0,0 +1,97 @@
+package nik
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrMalformed        = errors.New("nik: must be exactly 16 digits")
+	ErrUnknownProvince  = errors.New("nik: unknown province code")
+	ErrInvalidRegency   = errors.New("nik: invalid regency code")
+	ErrInvalidDistrict  = errors.New("nik: invalid district code")
+	ErrInvalidBirthDate = errors.New("nik: invalid encoded birth date")
+	ErrInvalidSerial    = errors.New("nik: invalid serial number")
+)
+
+// NIK is a decoded Nomor Induk Kependudukan, laid out as
+// PPRRDD-DDMMYY-SSSS: province, regency and district codes, the birth date
+// with 40 added to the day for women, then a registration serial. The
+// regency and district codes carry their parents as prefixes.
+type NIK struct {
+	Raw          string
+	ProvinceCode string
+	RegencyCode  string
+	DistrictCode string
+	BirthDate    time.Time
+	Female       bool
+	Serial       string
+}
+
+func (n NIK) Province() string {
+	name, _ := ProvinceName(n.ProvinceCode)
+	return name
+}
+
+// Parse checks the structure of raw and decodes it. Only the province code is
+// looked up, in the embedded table of provinces; regency and district codes
+// are not enumerated, so a well-formed but unassigned one passes as long as
+// it is not zero. now is used to settle the century of the 2-digit birth
+// year: a year that would lie in the future belongs to the previous century.
+func Parse(raw string, now time.Time) (NIK, error) {
+	if len(raw) != 16 {
+		return NIK{}, ErrMalformed
+	}
+	for _, r := range raw {
+		if r < '0' || r > '9' {
+			return NIK{}, ErrMalformed
+		}
+	}
+
+	n := NIK{
+		Raw:          raw,
+		ProvinceCode: raw[0:2],
+		RegencyCode:  raw[0:4],
+		DistrictCode: raw[0:6],
+		Serial:       raw[12:16],
+	}
+
+	if _, ok := ProvinceName(n.ProvinceCode); !ok {
+		return NIK{}, ErrUnknownProvince
+	}
+	if raw[2:4] == "00" {
+		return NIK{}, ErrInvalidRegency
+	}
+	if raw[4:6] == "00" {
+		return NIK{}, ErrInvalidDistrict
+	}
+	if n.Serial == "0000" {
+		return NIK{}, ErrInvalidSerial
+	}
+
+	day, _ := strconv.Atoi(raw[6:8])
+	month, _ := strconv.Atoi(raw[8:10])
+	year, _ := strconv.Atoi(raw[10:12])
+	if day > 40 {
+		day -= 40
+		n.Female = true
+	}
+	century := 2000
+	if century+year > now.Year() {
+		century = 1900
+	}
+	birthDate := time.Date(century+year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	// time.Date normalizes overflowing values, e.g. 31-02 into March
+	if day < 1 || month < 1 || month > 12 || birthDate.Day() != day || birthDate.Month() != time.Month(month) {
+		return NIK{}, ErrInvalidBirthDate
+	}
+	n.BirthDate = birthDate
+
+	return n, nil
+}
+
+func (n NIK) String() string {
+	return fmt.Sprintf("%s.%s.%s.%s", n.DistrictCode, n.Raw[6:8], n.Raw[8:12], n.Serial)
+}
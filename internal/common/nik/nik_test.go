@@ -0,0 +1,102 @@
+package nik
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		raw       string
+		province  string
+		birthDate string
+		female    bool
+	}{
+		{"3174011708900001", "DKI JAKARTA", "1990-08-17", false},
+		// women have 40 added to the day
+		{"3273015708900002", "JAWA BARAT", "1990-08-17", true},
+		{"5171014101050003", "BALI", "2005-01-01", true},
+		// a year that would lie in the future belongs to the previous century
+		{"1101013112270004", "ACEH", "1927-12-31", false},
+		{"9601012902240005", "PAPUA BARAT DAYA", "2024-02-29", false},
+	} {
+		n, err := Parse(test.raw, now)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", test.raw, err)
+		}
+		if n.Province() != test.province {
+			t.Errorf("Parse(%s) province = %q, want %q", test.raw, n.Province(), test.province)
+		}
+		if birthDate := n.BirthDate.Format(time.DateOnly); birthDate != test.birthDate {
+			t.Errorf("Parse(%s) birth date = %s, want %s", test.raw, birthDate, test.birthDate)
+		}
+		if n.Female != test.female {
+			t.Errorf("Parse(%s) female = %v, want %v", test.raw, n.Female, test.female)
+		}
+		if n.ProvinceCode != test.raw[0:2] || n.RegencyCode != test.raw[0:4] || n.DistrictCode != test.raw[0:6] || n.Serial != test.raw[12:16] {
+			t.Errorf("Parse(%s) codes = %s %s %s %s", test.raw, n.ProvinceCode, n.RegencyCode, n.DistrictCode, n.Serial)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, test := range []struct {
+		raw  string
+		want error
+	}{
+		{"317401170890000", ErrMalformed},
+		{"31740117089000011", ErrMalformed},
+		{"3174O11708900001", ErrMalformed},
+		{"317401-170890001", ErrMalformed},
+		{"2074011708900001", ErrUnknownProvince},
+		{"0074011708900001", ErrUnknownProvince},
+		{"3100011708900001", ErrInvalidRegency},
+		{"3174001708900001", ErrInvalidDistrict},
+		{"3174011708900000", ErrInvalidSerial},
+		{"3174010008900001", ErrInvalidBirthDate},
+		{"3174014008900001", ErrInvalidBirthDate},
+		{"3174013102900001", ErrInvalidBirthDate},
+		{"3174012902230001", ErrInvalidBirthDate},
+		{"3174011700900001", ErrInvalidBirthDate},
+		{"3174011713900001", ErrInvalidBirthDate},
+		{"3174017208900001", ErrInvalidBirthDate},
+	} {
+		if _, err := Parse(test.raw, now); !errors.Is(err, test.want) {
+			t.Errorf("Parse(%s) = %v, want %v", test.raw, err, test.want)
+		}
+	}
+}
+
+func TestProvinceName(t *testing.T) {
+	if len(loadProvinces()) != 38 {
+		t.Fatalf("province table holds %d provinces, want 38", len(loadProvinces()))
+	}
+	for code, want := range map[string]string{
+		"11": "ACEH",
+		"34": "DI YOGYAKARTA",
+		"65": "KALIMANTAN UTARA",
+		"96": "PAPUA BARAT DAYA",
+	} {
+		if name, ok := ProvinceName(code); !ok || name != want {
+			t.Errorf("ProvinceName(%s) = %q, %v, want %q", code, name, ok, want)
+		}
+	}
+	for _, code := range []string{"00", "10", "20", "99", "1", "111"} {
+		if _, ok := ProvinceName(code); ok {
+			t.Errorf("ProvinceName(%s) names a province", code)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	n, err := Parse("3174015708900002", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := n.String(); s != "317401.57.0890.0002" {
+		t.Fatalf("String() = %s", s)
+	}
+}
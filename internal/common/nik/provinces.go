@@ -0,0 +1,39 @@
+package nik
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"strings"
+	"sync"
+)
+
+// provinces.csv holds the 2-digit Kemendagri province codes, the only part of
+// an NIK checked against a table.
+//
+//go:embed provinces.csv
+var provincesCsv string
+
+var (
+	provinces     map[string]string
+	provincesOnce sync.Once
+)
+
+func loadProvinces() map[string]string {
+	provincesOnce.Do(func() {
+		records, err := csv.NewReader(strings.NewReader(provincesCsv)).ReadAll()
+		if err != nil {
+			panic("nik: malformed embedded province table: " + err.Error())
+		}
+		provinces = make(map[string]string)
+		for _, record := range records[1:] {
+			provinces[record[0]] = record[1]
+		}
+	})
+	return provinces
+}
+
+// ProvinceName returns the name of a 2-digit province code.
+func ProvinceName(code string) (string, bool) {
+	name, ok := loadProvinces()[code]
+	return name, ok
+}
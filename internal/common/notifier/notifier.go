@@ -0,0 +1,36 @@
+package notifier
+
+import (
+	"context"
+	"time"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+)
+
+// Notification tells a customer that something they asked for happened.
+type Notification struct {
+	Type      string         `json:"type"`
+	Subject   string         `json:"subject"`
+	Data      map[string]any `json:"data,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// Notifier hands notifications over to whatever reaches the customer.
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// New builds the notifier selected by config, falling back to Disabled.
+func New(config config.Notifier) Notifier {
+	if !config.Enabled {
+		return Disabled{}
+	}
+	return NewWebhook(config.WebhookUrl, time.Duration(config.Timeout)*time.Second)
+}
+
+// Disabled drops every notification, customers learn by polling.
+type Disabled struct{}
+
+func (Disabled) Notify(context.Context, Notification) error {
+	return nil
+}
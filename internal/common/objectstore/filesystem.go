@@ -0,0 +1,308 @@
+package objectstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Filesystem keeps objects in a local directory, for local development
+// without an object storage service. Objects are files named after a digest
+// of their key, next to a JSON file describing them, so keys need not make
+// valid paths.
+type Filesystem struct {
+	objects   string
+	multipart string
+}
+
+func NewFilesystem(directory string) (Filesystem, error) {
+	if directory == "" {
+		return Filesystem{}, errors.New("objectstore: missing filesystem directory")
+	}
+	f := Filesystem{
+		objects:   filepath.Join(directory, "objects"),
+		multipart: filepath.Join(directory, "multipart"),
+	}
+	for _, dir := range []string{f.objects, f.multipart} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return Filesystem{}, err
+		}
+	}
+	return f, nil
+}
+
+func (f Filesystem) path(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return filepath.Join(f.objects, hex.EncodeToString(digest[:]))
+}
+
+func (f Filesystem) Put(_ context.Context, key string, body io.Reader, size int64, options PutOptions) error {
+	data, err := writeTemp(f.objects, body, size)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(data)
+	return f.commit(data, ObjectInfo{
+		Key:          key,
+		Size:         size,
+		ContentType:  options.ContentType,
+		Metadata:     options.Metadata,
+		LastModified: time.Now(),
+	})
+}
+
+// commit moves the data file into place along with its description.
+func (f Filesystem) commit(data string, info ObjectInfo) error {
+	encoded, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	path := f.path(info.Key)
+	if err := os.Rename(data, path); err != nil {
+		return err
+	}
+	described, err := os.CreateTemp(f.objects, ".info-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(described.Name())
+	if _, err := described.Write(encoded); err != nil {
+		described.Close()
+		return err
+	}
+	if err := described.Close(); err != nil {
+		return err
+	}
+	return os.Rename(described.Name(), path+".json")
+}
+
+func (f Filesystem) Get(ctx context.Context, key string) (Object, error) {
+	info, err := f.Head(ctx, key)
+	if err != nil {
+		return Object{}, err
+	}
+	file, err := os.Open(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Object{}, ErrNotFound
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{ObjectInfo: info, Body: file}, nil
+}
+
+func (f Filesystem) Head(_ context.Context, key string) (ObjectInfo, error) {
+	return readInfo(f.path(key) + ".json")
+}
+
+func (f Filesystem) Delete(_ context.Context, key string) error {
+	path := f.path(key)
+	for _, name := range []string{path + ".json", path} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f Filesystem) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	entries, err := os.ReadDir(f.objects)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]ObjectInfo, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		info, err := readInfo(filepath.Join(f.objects, name))
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(info.Key, prefix) {
+			info.Metadata = nil
+			objects = append(objects, info)
+		}
+	}
+	slices.SortFunc(objects, func(a, b ObjectInfo) int { return strings.Compare(a.Key, b.Key) })
+	return objects, nil
+}
+
+func (f Filesystem) Copy(ctx context.Context, src, dst string, metadata map[string]string) error {
+	obj, err := f.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer obj.Body.Close()
+
+	data, err := writeTemp(f.objects, obj.Body, obj.Size)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(data)
+	info := obj.ObjectInfo
+	info.Key = dst
+	info.LastModified = time.Now()
+	if metadata != nil {
+		info.Metadata = maps.Clone(metadata)
+	}
+	return f.commit(data, info)
+}
+
+func (f Filesystem) CreateMultipart(context.Context, string) (string, error) {
+	uploadId := ulid.Make().String()
+	if err := os.Mkdir(filepath.Join(f.multipart, uploadId), 0o700); err != nil {
+		return "", err
+	}
+	return uploadId, nil
+}
+
+// uploadDir is where the parts of an upload are kept, upload ids are
+// checked as they come from callers.
+func (f Filesystem) uploadDir(uploadId string) (string, error) {
+	if _, err := ulid.ParseStrict(uploadId); err != nil {
+		return "", ErrNotFound
+	}
+	dir := filepath.Join(f.multipart, uploadId)
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func (f Filesystem) UploadPart(_ context.Context, _, uploadId string, number int32, body io.Reader, size int64) (Part, error) {
+	dir, err := f.uploadDir(uploadId)
+	if err != nil {
+		return Part{}, err
+	}
+	data, err := writeTemp(dir, body, size)
+	if err != nil {
+		return Part{}, err
+	}
+	defer os.Remove(data)
+	etag, err := fileETag(data)
+	if err != nil {
+		return Part{}, err
+	}
+	if err := os.Rename(data, filepath.Join(dir, strconv.Itoa(int(number)))); err != nil {
+		return Part{}, err
+	}
+	return Part{Number: number, ETag: etag}, nil
+}
+
+func (f Filesystem) CompleteMultipart(_ context.Context, key, uploadId string, parts []Part) error {
+	dir, err := f.uploadDir(uploadId)
+	if err != nil {
+		return err
+	}
+	assembled, err := os.CreateTemp(f.objects, ".data-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(assembled.Name())
+	defer assembled.Close()
+
+	var size int64
+	for _, part := range parts {
+		path := filepath.Join(dir, strconv.Itoa(int(part.Number)))
+		etag, err := fileETag(path)
+		if err != nil || etag != part.ETag {
+			return fmt.Errorf("objectstore: part %d of upload %s does not match", part.Number, uploadId)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		written, err := io.Copy(assembled, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		size += written
+	}
+	if err := assembled.Close(); err != nil {
+		return err
+	}
+
+	if err := f.commit(assembled.Name(), ObjectInfo{Key: key, Size: size, LastModified: time.Now()}); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (f Filesystem) AbortMultipart(_ context.Context, _, uploadId string) error {
+	dir, err := f.uploadDir(uploadId)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func readInfo(path string) (ObjectInfo, error) {
+	encoded, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	var info ObjectInfo
+	if err := json.Unmarshal(encoded, &info); err != nil {
+		return ObjectInfo{}, err
+	}
+	return info, nil
+}
+
+// writeTemp writes a body announced to be size bytes long to a temporary
+// file in dir, which the caller renames into place or removes.
+func writeTemp(dir string, body io.Reader, size int64) (string, error) {
+	file, err := os.CreateTemp(dir, ".data-*")
+	if err != nil {
+		return "", err
+	}
+	written, err := io.Copy(file, io.LimitReader(body, size+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written != size {
+		err = fmt.Errorf("objectstore: body is not the announced %d bytes", size)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+func fileETag(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest.Sum(nil)[:16]), nil
+}
@@ -0,0 +1,194 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+type memoryObject struct {
+	info    ObjectInfo
+	content []byte
+}
+
+// Memory keeps objects in process memory, for tests and local development.
+// Everything is lost on restart.
+type Memory struct {
+	mu        *sync.Mutex
+	objects   map[string]memoryObject
+	multipart map[string]map[int32][]byte
+}
+
+func NewMemory() Memory {
+	return Memory{
+		mu:        &sync.Mutex{},
+		objects:   make(map[string]memoryObject),
+		multipart: make(map[string]map[int32][]byte),
+	}
+}
+
+func (m Memory) Put(_ context.Context, key string, body io.Reader, size int64, options PutOptions) error {
+	content, err := readSized(body, size)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = memoryObject{
+		info: ObjectInfo{
+			Key:          key,
+			Size:         int64(len(content)),
+			ContentType:  options.ContentType,
+			Metadata:     maps.Clone(options.Metadata),
+			LastModified: time.Now(),
+		},
+		content: content,
+	}
+	return nil
+}
+
+func (m Memory) Get(_ context.Context, key string) (Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[key]
+	if !ok {
+		return Object{}, ErrNotFound
+	}
+	return Object{ObjectInfo: cloneInfo(obj.info), Body: io.NopCloser(bytes.NewReader(obj.content))}, nil
+}
+
+func (m Memory) Head(_ context.Context, key string) (ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[key]
+	if !ok {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return cloneInfo(obj.info), nil
+}
+
+func (m Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m Memory) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	objects := make([]ObjectInfo, 0)
+	for key, obj := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			info := obj.info
+			info.Metadata = nil
+			objects = append(objects, info)
+		}
+	}
+	slices.SortFunc(objects, func(a, b ObjectInfo) int { return strings.Compare(a.Key, b.Key) })
+	return objects, nil
+}
+
+func (m Memory) Copy(_ context.Context, src, dst string, metadata map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[src]
+	if !ok {
+		return ErrNotFound
+	}
+	obj.info = cloneInfo(obj.info)
+	obj.info.Key = dst
+	obj.info.LastModified = time.Now()
+	if metadata != nil {
+		obj.info.Metadata = maps.Clone(metadata)
+	}
+	m.objects[dst] = obj
+	return nil
+}
+
+func (m Memory) CreateMultipart(context.Context, string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	uploadId := ulid.Make().String()
+	m.multipart[uploadId] = make(map[int32][]byte)
+	return uploadId, nil
+}
+
+func (m Memory) UploadPart(_ context.Context, _, uploadId string, number int32, body io.Reader, size int64) (Part, error) {
+	content, err := readSized(body, size)
+	if err != nil {
+		return Part{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parts, ok := m.multipart[uploadId]
+	if !ok {
+		return Part{}, ErrNotFound
+	}
+	parts[number] = content
+	return Part{Number: number, ETag: partETag(content)}, nil
+}
+
+func (m Memory) CompleteMultipart(ctx context.Context, key, uploadId string, parts []Part) error {
+	m.mu.Lock()
+	stored, ok := m.multipart[uploadId]
+	if !ok {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+	content := new(bytes.Buffer)
+	for _, part := range parts {
+		partContent, ok := stored[part.Number]
+		if !ok || partETag(partContent) != part.ETag {
+			m.mu.Unlock()
+			return fmt.Errorf("objectstore: part %d of upload %s does not match", part.Number, uploadId)
+		}
+		content.Write(partContent)
+	}
+	delete(m.multipart, uploadId)
+	m.mu.Unlock()
+
+	return m.Put(ctx, key, content, int64(content.Len()), PutOptions{})
+}
+
+func (m Memory) AbortMultipart(_ context.Context, _, uploadId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.multipart[uploadId]; !ok {
+		return ErrNotFound
+	}
+	delete(m.multipart, uploadId)
+	return nil
+}
+
+func cloneInfo(info ObjectInfo) ObjectInfo {
+	info.Metadata = maps.Clone(info.Metadata)
+	return info
+}
+
+// readSized reads a body announced to be size bytes long.
+func readSized(body io.Reader, size int64) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(body, size+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) != size {
+		return nil, fmt.Errorf("objectstore: body is not the announced %d bytes", size)
+	}
+	return content, nil
+}
+
+func partETag(content []byte) string {
+	digest := sha256.Sum256(content)
+	return hex.EncodeToString(digest[:16])
+}
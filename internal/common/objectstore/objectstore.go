@@ -0,0 +1,95 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/s3client"
+)
+
+// ErrNotFound is returned for objects, and multipart uploads, that do not
+// exist.
+var ErrNotFound = errors.New("objectstore: no such object")
+
+// ObjectInfo describes a stored object. Listings leave Metadata out.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	Metadata     map[string]string
+	LastModified time.Time
+}
+
+// Object is a stored object opened for reading, the caller closes Body.
+type Object struct {
+	ObjectInfo
+	Body io.ReadCloser
+}
+
+type PutOptions struct {
+	ContentType string
+	Metadata    map[string]string
+}
+
+// Part is a stored part of a multipart upload.
+type Part struct {
+	Number int32
+	ETag   string
+}
+
+// ObjectStore keeps objects under keys, in a single bucket. Deleting an
+// object that does not exist is not an error.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, options PutOptions) error
+	Get(ctx context.Context, key string) (Object, error)
+	Head(ctx context.Context, key string) (ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Copy stores the content of src under dst, along with metadata, or the
+	// metadata of src when nil.
+	Copy(ctx context.Context, src, dst string, metadata map[string]string) error
+
+	// CreateMultipart starts assembling key out of parts, which become the
+	// object once completed in order.
+	CreateMultipart(ctx context.Context, key string) (string, error)
+	UploadPart(ctx context.Context, key, uploadId string, number int32, body io.Reader, size int64) (Part, error)
+	CompleteMultipart(ctx context.Context, key, uploadId string, parts []Part) error
+	AbortMultipart(ctx context.Context, key, uploadId string) error
+}
+
+// PresignedRequest lets a client put an object without credentials, by
+// sending Headers along to Url.
+type PresignedRequest struct {
+	Url     string
+	Headers map[string]string
+}
+
+// Presigner is implemented by stores clients can put objects into directly.
+type Presigner interface {
+	// PresignPut authorizes putting exactly size bytes under key for ttl.
+	PresignPut(ctx context.Context, key string, size int64, ttl time.Duration) (PresignedRequest, error)
+}
+
+// New builds the store selected by config, S3 unless told otherwise.
+func New(ctx context.Context, config config.S3) (ObjectStore, error) {
+	switch config.Backend {
+	case "", constant.OBJECT_STORE_BACKEND_S3:
+		client, err := s3client.New(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3(client, s3.NewPresignClient(client), config.DefaultBucket), nil
+	case constant.OBJECT_STORE_BACKEND_FILESYSTEM:
+		return NewFilesystem(config.Directory)
+	case constant.OBJECT_STORE_BACKEND_MEMORY:
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("objectstore: unknown backend %q", config.Backend)
+	}
+}
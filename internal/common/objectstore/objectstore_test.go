@@ -0,0 +1,260 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// stores are the backends that must behave alike, S3 aside.
+func stores(t *testing.T) map[string]ObjectStore {
+	t.Helper()
+	filesystem, err := NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]ObjectStore{
+		"memory":     NewMemory(),
+		"filesystem": filesystem,
+	}
+}
+
+func put(t *testing.T, store ObjectStore, key, content string, options PutOptions) {
+	t.Helper()
+	if err := store.Put(context.Background(), key, bytes.NewReader([]byte(content)), int64(len(content)), options); err != nil {
+		t.Fatalf("put %s: %v", key, err)
+	}
+}
+
+func read(t *testing.T, store ObjectStore, key string) Object {
+	t.Helper()
+	obj, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	defer obj.Body.Close()
+	content, err := io.ReadAll(obj.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.Body = io.NopCloser(bytes.NewReader(content))
+	return obj
+}
+
+func body(t *testing.T, obj Object) string {
+	t.Helper()
+	content, err := io.ReadAll(obj.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestPutGet(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			put(t, store, "documents/a", "hello", PutOptions{
+				ContentType: "text/plain",
+				Metadata:    map[string]string{"source": "a.png"},
+			})
+
+			obj := read(t, store, "documents/a")
+			if got := body(t, obj); got != "hello" {
+				t.Fatalf("content = %q, want %q", got, "hello")
+			}
+			if obj.Size != 5 || obj.ContentType != "text/plain" || obj.Metadata["source"] != "a.png" {
+				t.Fatalf("info = %+v", obj.ObjectInfo)
+			}
+			info, err := store.Head(context.Background(), "documents/a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size != 5 || info.Metadata["source"] != "a.png" {
+				t.Fatalf("head = %+v", info)
+			}
+		})
+	}
+}
+
+func TestPutRefusesBodyOfAnotherSize(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			err := store.Put(context.Background(), "a", bytes.NewReader([]byte("hello")), 4, PutOptions{})
+			if err == nil {
+				t.Fatal("put accepted a body longer than announced")
+			}
+			err = store.Put(context.Background(), "a", bytes.NewReader([]byte("hello")), 6, PutOptions{})
+			if err == nil {
+				t.Fatal("put accepted a body shorter than announced")
+			}
+			if _, err := store.Head(context.Background(), "a"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("head = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestMissingObjects(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("get = %v, want ErrNotFound", err)
+			}
+			if _, err := store.Head(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("head = %v, want ErrNotFound", err)
+			}
+			if err := store.Copy(ctx, "missing", "b", nil); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("copy = %v, want ErrNotFound", err)
+			}
+			if err := store.Delete(ctx, "missing"); err != nil {
+				t.Fatalf("delete = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestCopy(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			put(t, store, "a", "hello", PutOptions{Metadata: map[string]string{"source": "a.png"}})
+
+			if err := store.Copy(ctx, "a", "kept", nil); err != nil {
+				t.Fatal(err)
+			}
+			if obj := read(t, store, "kept"); obj.Metadata["source"] != "a.png" {
+				t.Fatalf("metadata = %v, want that of the source", obj.Metadata)
+			}
+
+			if err := store.Copy(ctx, "a", "replaced", map[string]string{"variant": "preview"}); err != nil {
+				t.Fatal(err)
+			}
+			obj := read(t, store, "replaced")
+			if got := body(t, obj); got != "hello" {
+				t.Fatalf("content = %q, want %q", got, "hello")
+			}
+			if _, ok := obj.Metadata["source"]; ok || obj.Metadata["variant"] != "preview" {
+				t.Fatalf("metadata = %v, want only the given one", obj.Metadata)
+			}
+		})
+	}
+}
+
+func TestListAndDelete(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			put(t, store, "documents/b", "b", PutOptions{Metadata: map[string]string{"source": "b"}})
+			put(t, store, "documents/a", "a", PutOptions{})
+			put(t, store, "uploads/c", "c", PutOptions{})
+
+			listed, err := store.List(ctx, "documents/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(listed) != 2 || listed[0].Key != "documents/a" || listed[1].Key != "documents/b" {
+				t.Fatalf("listed = %+v", listed)
+			}
+			if listed[1].Metadata != nil {
+				t.Fatalf("listing carries metadata %v", listed[1].Metadata)
+			}
+
+			if err := store.Delete(ctx, "documents/a"); err != nil {
+				t.Fatal(err)
+			}
+			listed, err = store.List(ctx, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(listed) != 2 || listed[0].Key != "documents/b" || listed[1].Key != "uploads/c" {
+				t.Fatalf("listed = %+v", listed)
+			}
+		})
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			uploadId, err := store.CreateMultipart(ctx, "assembled")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// parts may arrive in any order, they are assembled by number
+			second, err := store.UploadPart(ctx, "assembled", uploadId, 2, bytes.NewReader([]byte("world")), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			first, err := store.UploadPart(ctx, "assembled", uploadId, 1, bytes.NewReader([]byte("hello ")), 6)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Head(ctx, "assembled"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("head before completion = %v, want ErrNotFound", err)
+			}
+
+			if err := store.CompleteMultipart(ctx, "assembled", uploadId, []Part{first, second}); err != nil {
+				t.Fatal(err)
+			}
+			if got := body(t, read(t, store, "assembled")); got != "hello world" {
+				t.Fatalf("content = %q, want %q", got, "hello world")
+			}
+			if err := store.AbortMultipart(ctx, "assembled", uploadId); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("abort after completion = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestMultipartRefusesForeignPart(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			uploadId, err := store.CreateMultipart(ctx, "assembled")
+			if err != nil {
+				t.Fatal(err)
+			}
+			part, err := store.UploadPart(ctx, "assembled", uploadId, 1, bytes.NewReader([]byte("hello")), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.ETag = "0000"
+			if err := store.CompleteMultipart(ctx, "assembled", uploadId, []Part{part}); err == nil {
+				t.Fatal("completed with a part that was not uploaded")
+			}
+		})
+	}
+}
+
+func TestAbortMultipart(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			uploadId, err := store.CreateMultipart(ctx, "abandoned")
+			if err != nil {
+				t.Fatal(err)
+			}
+			part, err := store.UploadPart(ctx, "abandoned", uploadId, 1, bytes.NewReader([]byte("hello")), 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := store.AbortMultipart(ctx, "abandoned", uploadId); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.UploadPart(ctx, "abandoned", uploadId, 2, bytes.NewReader([]byte("world")), 5); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("upload part after abort = %v, want ErrNotFound", err)
+			}
+			if err := store.CompleteMultipart(ctx, "abandoned", uploadId, []Part{part}); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("complete after abort = %v, want ErrNotFound", err)
+			}
+			if err := store.AbortMultipart(ctx, "abandoned", uploadId); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("abort twice = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
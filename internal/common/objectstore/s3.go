@@ -0,0 +1,202 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3 stores objects in a bucket of an S3 compatible service.
+type S3 struct {
+	client    *s3.Client
+	presigner *s3.PresignClient
+	bucket    string
+}
+
+func NewS3(client *s3.Client, presigner *s3.PresignClient, bucket string) S3 {
+	return S3{client, presigner, bucket}
+}
+
+func (s S3) Put(ctx context.Context, key string, body io.Reader, size int64, options PutOptions) error {
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		Metadata:      options.Metadata,
+	}
+	if options.ContentType != "" {
+		input.ContentType = aws.String(options.ContentType)
+	}
+	_, err := s.client.PutObject(ctx, input)
+	return err
+}
+
+func (s S3) Get(ctx context.Context, key string) (Object, error) {
+	obj, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return Object{}, notFound(err)
+	}
+	return Object{
+		ObjectInfo: ObjectInfo{
+			Key:          key,
+			Size:         aws.ToInt64(obj.ContentLength),
+			ContentType:  aws.ToString(obj.ContentType),
+			Metadata:     obj.Metadata,
+			LastModified: aws.ToTime(obj.LastModified),
+		},
+		Body: obj.Body,
+	}, nil
+}
+
+func (s S3) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	obj, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ObjectInfo{}, notFound(err)
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(obj.ContentLength),
+		ContentType:  aws.ToString(obj.ContentType),
+		Metadata:     obj.Metadata,
+		LastModified: aws.ToTime(obj.LastModified),
+	}, nil
+}
+
+func (s S3) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s S3) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := make([]ObjectInfo, 0)
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+func (s S3) Copy(ctx context.Context, src, dst string, metadata map[string]string) error {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(dst),
+		CopySource: aws.String(url.PathEscape(s.bucket + "/" + src)),
+	}
+	if metadata != nil {
+		input.Metadata = metadata
+		input.MetadataDirective = types.MetadataDirectiveReplace
+	}
+	_, err := s.client.CopyObject(ctx, input)
+	return notFound(err)
+}
+
+func (s S3) CreateMultipart(ctx context.Context, key string) (string, error) {
+	multipart, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(multipart.UploadId), nil
+}
+
+func (s S3) UploadPart(ctx context.Context, key, uploadId string, number int32, body io.Reader, size int64) (Part, error) {
+	part, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadId),
+		PartNumber:    aws.Int32(number),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return Part{}, notFound(err)
+	}
+	return Part{Number: number, ETag: aws.ToString(part.ETag)}, nil
+}
+
+func (s S3) CompleteMultipart(ctx context.Context, key, uploadId string, parts []Part) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = types.CompletedPart{PartNumber: aws.Int32(part.Number), ETag: aws.String(part.ETag)}
+	}
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadId),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	return notFound(err)
+}
+
+func (s S3) AbortMultipart(ctx context.Context, key, uploadId string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadId),
+	})
+	return notFound(err)
+}
+
+// PresignPut signs the content length, holding the client to size.
+func (s S3) PresignPut(ctx context.Context, key string, size int64, ttl time.Duration) (PresignedRequest, error) {
+	presigned, err := s.presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+	request := PresignedRequest{Url: presigned.URL, Headers: make(map[string]string)}
+	for name, values := range presigned.SignedHeader {
+		if name != "Host" && len(values) > 0 {
+			request.Headers[name] = values[0]
+		}
+	}
+	return request, nil
+}
+
+// notFound translates the missing object and upload errors of S3 into
+// ErrNotFound.
+func notFound(err error) error {
+	var (
+		noSuchKey    *types.NoSuchKey
+		notFound     *types.NotFound
+		noSuchUpload *types.NoSuchUpload
+	)
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) || errors.As(err, &noSuchUpload) {
+		return errors.Join(ErrNotFound, err)
+	}
+	return err
+}
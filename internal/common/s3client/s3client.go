@@ -0,0 +1,110 @@
+package s3client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+// New builds a client for the S3 compatible service at config.URL.
+//
+// Credentials are the static keys when AccessKeyId is set, a web identity
+// token exchanged for RoleArn when WebIdentityTokenFile is set, and the SDK
+// default chain otherwise: environment, shared files under Profile, web
+// identity from the environment, then container and instance roles.
+func New(ctx context.Context, config config.S3) (*s3.Client, error) {
+	checksums, err := checksumMode(config.Checksums)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []func(*awsConfig.LoadOptions) error{
+		awsConfig.WithRegion(config.DefaultRegion),
+		awsConfig.WithRequestChecksumCalculation(checksums.request),
+		awsConfig.WithResponseChecksumValidation(checksums.response),
+		awsConfig.WithRetryer(func() aws.Retryer {
+			return retry.NewStandard(func(o *retry.StandardOptions) {
+				if config.MaxAttempts > 0 {
+					o.MaxAttempts = config.MaxAttempts
+				}
+				if config.MaxBackoff > 0 {
+					o.MaxBackoff = time.Duration(config.MaxBackoff) * time.Second
+				}
+			})
+		}),
+	}
+	if config.Profile != "" {
+		options = append(options, awsConfig.WithSharedConfigProfile(config.Profile))
+	}
+	if config.CredentialsFile != "" {
+		options = append(options, awsConfig.WithSharedCredentialsFiles([]string{config.CredentialsFile}))
+	}
+	if config.AccessKeyId != "" {
+		options = append(options, awsConfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			config.AccessKeyId,
+			config.SecretAccessKey,
+			config.SessionToken,
+		)))
+	}
+	if config.CaBundle != "" {
+		bundle, err := os.Open(config.CaBundle)
+		if err != nil {
+			return nil, fmt.Errorf("s3client: cannot read ca bundle: %w", err)
+		}
+		defer bundle.Close()
+		options = append(options, awsConfig.WithCustomCABundle(bundle))
+	}
+
+	awsCfg, err := awsConfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("s3client: cannot load configuration: %w", err)
+	}
+	if config.AccessKeyId == "" && config.WebIdentityTokenFile != "" {
+		if config.RoleArn == "" {
+			return nil, fmt.Errorf("s3client: web identity token file needs a role arn")
+		}
+		awsCfg.Credentials = aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(
+			sts.NewFromConfig(awsCfg),
+			config.RoleArn,
+			stscreds.IdentityTokenFile(config.WebIdentityTokenFile),
+		))
+	}
+
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if config.URL != "" {
+			o.BaseEndpoint = aws.String(config.URL)
+		}
+		o.UsePathStyle = !config.VirtualHostedStyle
+		o.APIOptions = append(o.APIOptions, withOperationTimeout(config))
+	}), nil
+}
+
+type checksums struct {
+	request  aws.RequestChecksumCalculation
+	response aws.ResponseChecksumValidation
+}
+
+// checksumMode defaults to computing checksums only where S3 demands them,
+// as Garage and other older S3 implementations reject the trailing CRC32
+// checksums the SDK sends otherwise.
+func checksumMode(mode string) (checksums, error) {
+	switch mode {
+	case "", constant.S3_CHECKSUMS_WHEN_REQUIRED:
+		return checksums{aws.RequestChecksumCalculationWhenRequired, aws.ResponseChecksumValidationWhenRequired}, nil
+	case constant.S3_CHECKSUMS_WHEN_SUPPORTED:
+		return checksums{aws.RequestChecksumCalculationWhenSupported, aws.ResponseChecksumValidationWhenSupported}, nil
+	default:
+		return checksums{}, fmt.Errorf("s3client: unknown checksums mode %q", mode)
+	}
+}
@@ -0,0 +1,70 @@
+package s3client
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+)
+
+// operationTimeout bounds each operation, retries included, by the timeout
+// configured for its name or by the default one. A downloaded body stays
+// bounded until it is closed.
+type operationTimeout struct {
+	fallback   time.Duration
+	operations map[string]int64
+}
+
+func withOperationTimeout(config config.S3) func(*middleware.Stack) error {
+	timeout := operationTimeout{
+		fallback:   time.Duration(config.Timeout) * time.Second,
+		operations: config.OperationTimeouts,
+	}
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(timeout, middleware.After)
+	}
+}
+
+func (operationTimeout) ID() string {
+	return "OperationTimeout"
+}
+
+func (t operationTimeout) timeout(operation string) time.Duration {
+	if seconds, ok := t.operations[operation]; ok {
+		return time.Duration(seconds) * time.Second
+	}
+	return t.fallback
+}
+
+func (t operationTimeout) HandleInitialize(
+	ctx context.Context,
+	in middleware.InitializeInput,
+	next middleware.InitializeHandler,
+) (middleware.InitializeOutput, middleware.Metadata, error) {
+	timeout := t.timeout(middleware.GetOperationName(ctx))
+	if timeout <= 0 {
+		return next.HandleInitialize(ctx, in)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	if obj, ok := out.Result.(*s3.GetObjectOutput); ok && err == nil && obj.Body != nil {
+		obj.Body = cancelOnClose{obj.Body, cancel}
+		return out, metadata, nil
+	}
+	cancel()
+	return out, metadata, err
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,111 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+const clamdChunkSize = 64 * 1024
+
+// Clamd speaks the clamd INSTREAM protocol over tcp or a unix socket, see
+// https://docs.clamav.net/manual/Usage/Scanning.html#clamd
+type Clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+func NewClamd(network, address string, timeout time.Duration) *Clamd {
+	if network == "" {
+		network = "tcp"
+	}
+	return &Clamd{network, address, timeout}
+}
+
+func (c *Clamd) Scan(ctx context.Context, content io.Reader) (Verdict, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("clamd: failed to dial %s: %w", c.address, err)
+	}
+	defer conn.Close()
+
+	var deadline time.Time
+	if c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return Verdict{}, err
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Verdict{}, fmt.Errorf("clamd: failed to start stream: %w", err)
+	}
+
+	chunk := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := content.Read(chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return Verdict{}, fmt.Errorf("clamd: failed to write chunk size: %w", err)
+			}
+			if _, err := conn.Write(chunk[:n]); err != nil {
+				return Verdict{}, fmt.Errorf("clamd: failed to write chunk: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Verdict{}, err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return Verdict{}, fmt.Errorf("clamd: failed to end stream: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Verdict{}, fmt.Errorf("clamd: failed to read reply: %w", err)
+	}
+
+	return parseClamdReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+// parseClamdReply understands "stream: OK", "stream: <signature> FOUND" and
+// "<message> ERROR" replies.
+func parseClamdReply(reply string) (Verdict, error) {
+	now := time.Now()
+	_, result, ok := strings.Cut(reply, ": ")
+	if !ok {
+		result = reply
+	}
+
+	switch {
+	case result == "OK":
+		return Verdict{Status: constant.SCAN_STATUS_CLEAN, ScannedAt: now}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return Verdict{
+			Status:    constant.SCAN_STATUS_INFECTED,
+			Signature: strings.TrimSuffix(result, " FOUND"),
+			ScannedAt: now,
+		}, nil
+	default:
+		return Verdict{}, fmt.Errorf("clamd: unexpected reply %q", reply)
+	}
+}
@@ -0,0 +1,121 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+// stubClamd answers every INSTREAM session on a unix socket with reply,
+// handing the reassembled stream to received.
+func stubClamd(t *testing.T, reply string, received chan<- []byte) string {
+	t.Helper()
+	address := filepath.Join(t.TempDir(), "clamd.sock")
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				stream, err := readInstream(bufio.NewReader(conn))
+				if err != nil {
+					t.Errorf("stub clamd: %v", err)
+					return
+				}
+				if received != nil {
+					received <- stream
+				}
+				conn.Write(append([]byte(reply), 0))
+			}()
+		}
+	}()
+	return address
+}
+
+func readInstream(r *bufio.Reader) ([]byte, error) {
+	command, err := r.ReadBytes(0)
+	if err != nil {
+		return nil, err
+	}
+	if string(command) != "zINSTREAM\x00" {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var stream bytes.Buffer
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, size); err != nil {
+			return nil, err
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			return stream.Bytes(), nil
+		}
+		if n > clamdChunkSize {
+			return nil, io.ErrShortBuffer
+		}
+		if _, err := io.CopyN(&stream, r, int64(n)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func TestClamdStreamsContentInChunks(t *testing.T) {
+	received := make(chan []byte, 1)
+	clamd := NewClamd("unix", stubClamd(t, "stream: OK", received), time.Second)
+
+	content := bytes.Repeat([]byte("0123456789"), clamdChunkSize/4)
+	verdict, err := clamd.Scan(context.Background(), bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verdict.Status != constant.SCAN_STATUS_CLEAN {
+		t.Fatalf("status = %q, want %q", verdict.Status, constant.SCAN_STATUS_CLEAN)
+	}
+	if got := <-received; !bytes.Equal(got, content) {
+		t.Fatalf("clamd received %d bytes, want %d", len(got), len(content))
+	}
+}
+
+func TestClamdReportsSignature(t *testing.T) {
+	clamd := NewClamd("unix", stubClamd(t, "stream: Eicar-Signature FOUND", nil), time.Second)
+
+	verdict, err := clamd.Scan(context.Background(), bytes.NewReader([]byte("eicar")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verdict.Status != constant.SCAN_STATUS_INFECTED || verdict.Signature != "Eicar-Signature" {
+		t.Fatalf("verdict = %+v, want infected with Eicar-Signature", verdict)
+	}
+}
+
+func TestClamdFailsOnErrorReply(t *testing.T) {
+	clamd := NewClamd("unix", stubClamd(t, "INSTREAM size limit exceeded. ERROR", nil), time.Second)
+
+	if _, err := clamd.Scan(context.Background(), bytes.NewReader([]byte("large"))); err == nil {
+		t.Fatal("expected an error for an ERROR reply")
+	}
+}
+
+func TestClamdFailsWhenUnreachable(t *testing.T) {
+	clamd := NewClamd("unix", filepath.Join(t.TempDir(), "missing.sock"), time.Second)
+
+	if _, err := clamd.Scan(context.Background(), bytes.NewReader([]byte("content"))); err == nil {
+		t.Fatal("expected an error for an unreachable clamd")
+	}
+}
@@ -0,0 +1,40 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+type Verdict struct {
+	Status    string
+	Signature string
+	ScannedAt time.Time
+}
+
+// Scanner inspects plaintext content before it is encrypted and stored.
+type Scanner interface {
+	Scan(ctx context.Context, content io.Reader) (Verdict, error)
+}
+
+// New builds the scanner selected by config, falling back to Disabled.
+func New(config config.Scanner) Scanner {
+	if !config.Enabled {
+		return Disabled{}
+	}
+	return NewClamd(
+		config.Network,
+		config.Address,
+		time.Duration(config.Timeout)*time.Second,
+	)
+}
+
+// Disabled marks every file as unscanned without inspecting it.
+type Disabled struct{}
+
+func (Disabled) Scan(context.Context, io.Reader) (Verdict, error) {
+	return Verdict{Status: constant.SCAN_STATUS_UNSCANNED}, nil
+}
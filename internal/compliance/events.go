@@ -0,0 +1,138 @@
+package compliance
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+const auditEventColumns = `e.seq, e.id, e.action, e.subject, e.client_ip, e.user_agent, e.operation_id,
+	e.document_id, e.case_id, e.outcome, e.purpose, e.detail, e.created_at, e.hash`
+
+// auditQuery renders the filter into a query over audit events joined with
+// the documents and cases they touched, returning it with its arguments.
+func auditQuery(filter AuditFilter, extra ...string) (string, []any) {
+	conditions := append(make([]string, 0), extra...)
+	args := make([]any, 0)
+	where := func(format string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, strings.ReplaceAll(format, "%s", fmt.Sprintf("$%d", len(args))))
+	}
+
+	if filter.Subject != "" {
+		where("(d.created_by = %s OR c.subject = %s)", filter.Subject)
+	}
+	if filter.Actor != "" {
+		where("e.subject = %s", filter.Actor)
+	}
+	if filter.DocumentId != "" {
+		where("e.document_id = %s", filter.DocumentId)
+	}
+	if filter.Kind != "" {
+		where("d.kind = %s", filter.Kind)
+	}
+	if filter.Operation != "" {
+		where("e.operation_id = %s", filter.Operation)
+	}
+	if filter.Action != "" {
+		where("e.action = %s", filter.Action)
+	}
+	if filter.Outcome != "" {
+		where("e.outcome = %s", filter.Outcome)
+	}
+	if filter.Purpose != "" {
+		where("e.purpose = %s", filter.Purpose)
+	}
+	// created_at holds UTC wall clock time
+	if !filter.From.IsZero() {
+		where("e.created_at >= %s", filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where("e.created_at < %s", filter.To.UTC())
+	}
+
+	query := fmt.Sprintf(`SELECT %s
+		FROM audit_events e
+		LEFT JOIN documents d ON d.id = e.document_id
+		LEFT JOIN kyc_cases c ON c.id = e.case_id`, auditEventColumns)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return query, args
+}
+
+func scanAuditEvent(row pgx.Row) (AuditEvent, error) {
+	var (
+		event  AuditEvent
+		detail *string
+		hash   []byte
+	)
+	err := row.Scan(
+		&event.Seq,
+		&event.Id,
+		&event.Action,
+		&event.Actor,
+		&event.ClientIp,
+		&event.UserAgent,
+		&event.OperationId,
+		&event.DocumentId,
+		&event.CaseId,
+		&event.Outcome,
+		&event.Purpose,
+		&detail,
+		&event.CreatedAt,
+		&hash,
+	)
+	if detail != nil {
+		event.Detail = []byte(*detail)
+	}
+	event.Hash = hex.EncodeToString(hash)
+	return event, err
+}
+
+func (h handler) ListAuditEvents(ctx context.Context, request *struct {
+	AuditFilter
+	Cursor int64 `query:"cursor" minimum:"1" doc:"Seq of the last event from the previous page"`
+	Limit  int   `query:"limit" minimum:"1" maximum:"500" default:"50"`
+}) (_ *struct {
+	Body AuditEventPage
+}, err error) {
+	event := &audit.Event{
+		Action: constant.AUDIT_ACTION_AUDIT_QUERY,
+		Detail: map[string]any{"filter": request.AuditFilter},
+	}
+	defer func() { err = audit.RecordAccess(ctx, h.pool, event, err) }()
+
+	extra := make([]string, 0)
+	if request.Cursor > 0 {
+		// the cursor is an integer, rendered rather than bound
+		extra = append(extra, fmt.Sprintf("e.seq < %d", request.Cursor))
+	}
+	query, args := auditQuery(request.AuditFilter, extra...)
+	args = append(args, request.Limit+1)
+	query += fmt.Sprintf(" ORDER BY e.seq DESC LIMIT $%d", len(args))
+
+	rows, err := h.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (AuditEvent, error) {
+		return scanAuditEvent(row)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	page := AuditEventPage{Items: events}
+	if len(events) > request.Limit {
+		page.Items = events[:request.Limit]
+		page.NextCursor = page.Items[request.Limit-1].Seq
+	}
+
+	return &struct{ Body AuditEventPage }{Body: page}, nil
+}
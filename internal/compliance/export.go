@@ -0,0 +1,241 @@
+package compliance
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// exportFlushEvery is how many events are written between flushes, so the
+// client sees progress without a flush per row.
+const exportFlushEvery = 500
+
+var csvHeader = []string{
+	"seq", "id", "created_at", "action", "actor", "client_ip", "user_agent", "operation_id",
+	"document_id", "case_id", "outcome", "purpose", "detail", "hash",
+}
+
+// countingHasher tracks the size and digest of everything written through it.
+type countingHasher struct {
+	hash  hash.Hash
+	bytes int64
+}
+
+func (c *countingHasher) Write(p []byte) (int, error) {
+	c.bytes += int64(len(p))
+	return c.hash.Write(p)
+}
+
+// csvCell neutralizes values a spreadsheet would otherwise run as a formula.
+func csvCell(value *string) string {
+	if value == nil {
+		return ""
+	}
+	if *value != "" && strings.ContainsRune("=+-@\t\r", rune((*value)[0])) {
+		return "'" + *value
+	}
+	return *value
+}
+
+// ExportAuditEvents streams the matching events oldest first, straight from
+// the database cursor to the client. The manifest is signed and stored only
+// once the last row went out, an interrupted export leaves none behind.
+func (h handler) ExportAuditEvents(ctx context.Context, request *struct {
+	AuditFilter
+	Format string `query:"format" enum:"jsonl,csv" default:"jsonl"`
+}) (_ *huma.StreamResponse, err error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	exportId := ulid.Make().String()
+	event := &audit.Event{
+		Action: constant.AUDIT_ACTION_AUDIT_EXPORT,
+		Detail: map[string]any{"exportId": exportId, "format": request.Format, "filter": request.AuditFilter},
+	}
+	defer func() { err = audit.RecordAccess(ctx, h.pool, event, err) }()
+
+	query, args := auditQuery(request.AuditFilter)
+	rows, err := h.pool.Query(ctx, query+" ORDER BY e.seq", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &huma.StreamResponse{Body: func(hctx huma.Context) {
+		defer rows.Close()
+
+		contentType := "application/x-ndjson"
+		if request.Format == constant.AUDIT_EXPORT_FORMAT_CSV {
+			contentType = "text/csv; charset=utf-8"
+		}
+		hctx.SetHeader("Content-Type", contentType)
+		hctx.SetHeader("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.%s"`, exportId, request.Format))
+		hctx.SetHeader("X-Export-Id", exportId)
+		hctx.SetStatus(http.StatusOK)
+
+		body := hctx.BodyWriter()
+		flusher, _ := body.(http.Flusher)
+		digest := &countingHasher{hash: sha256.New()}
+		writer := io.MultiWriter(body, digest)
+
+		var csvWriter *csv.Writer
+		if request.Format == constant.AUDIT_EXPORT_FORMAT_CSV {
+			csvWriter = csv.NewWriter(writer)
+			if err := csvWriter.Write(csvHeader); err != nil {
+				log.Warn().Err(err).Str("export", exportId).Msg("audit: export interrupted")
+				return
+			}
+		}
+
+		manifest := ExportManifest{
+			Id:          exportId,
+			Format:      request.Format,
+			RequestedBy: principal.Subject,
+			Filter:      request.AuditFilter,
+		}
+		for rows.Next() {
+			event, err := scanAuditEvent(rows)
+			if err != nil {
+				log.Error().Err(err).Str("export", exportId).Msg("audit: failed to read event")
+				return
+			}
+
+			if csvWriter != nil {
+				detail := string(event.Detail)
+				err = csvWriter.Write([]string{
+					strconv.FormatInt(event.Seq, 10),
+					event.Id,
+					event.CreatedAt.UTC().Format(time.RFC3339Nano),
+					event.Action,
+					csvCell(event.Actor),
+					csvCell(event.ClientIp),
+					csvCell(event.UserAgent),
+					csvCell(event.OperationId),
+					csvCell(event.DocumentId),
+					csvCell(event.CaseId),
+					event.Outcome,
+					csvCell(event.Purpose),
+					csvCell(&detail),
+					event.Hash,
+				})
+			} else {
+				var line []byte
+				line, err = json.Marshal(event)
+				if err == nil {
+					_, err = writer.Write(append(line, '\n'))
+				}
+			}
+			if err != nil {
+				log.Warn().Err(err).Str("export", exportId).Msg("audit: export interrupted")
+				return
+			}
+
+			if manifest.FirstSeq == 0 {
+				manifest.FirstSeq = event.Seq
+			}
+			manifest.LastSeq, manifest.LastHash = event.Seq, event.Hash
+			manifest.Events++
+			if manifest.Events%exportFlushEvery == 0 {
+				if csvWriter != nil {
+					csvWriter.Flush()
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		}
+		if err := rows.Err(); err != nil {
+			log.Error().Err(err).Str("export", exportId).Msg("audit: failed to read events")
+			return
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				log.Warn().Err(err).Str("export", exportId).Msg("audit: export interrupted")
+				return
+			}
+		}
+
+		manifest.Bytes = digest.bytes
+		manifest.Sha256 = hex.EncodeToString(digest.hash.Sum(nil))
+		manifest.CreatedAt = time.Now().UTC()
+		if err := h.signExport(context.WithoutCancel(hctx.Context()), manifest); err != nil {
+			log.Error().Err(err).Str("export", exportId).Msg("audit: failed to sign export manifest")
+		}
+	}}, nil
+}
+
+func (h handler) signExport(ctx context.Context, manifest ExportManifest) error {
+	encoded, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	signature, err := h.keyservice.Sign(ctx, encoded)
+	if err != nil {
+		return err
+	}
+	_, err = h.pool.Exec(ctx, `
+		INSERT INTO audit_exports (id, requested_by, format, manifest, signature, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		manifest.Id,
+		manifest.RequestedBy,
+		manifest.Format,
+		string(encoded),
+		signature,
+		manifest.CreatedAt,
+	)
+	return err
+}
+
+// GetAuditExport returns a stored manifest with its signature, checked again
+// against the signing key. A file is unaltered when its SHA256 matches the
+// manifest and the signature is valid.
+func (h handler) GetAuditExport(ctx context.Context, request *struct {
+	Id string `path:"id"`
+}) (*struct {
+	Body AuditExport
+}, error) {
+	var (
+		export   AuditExport
+		manifest string
+	)
+	err := h.pool.QueryRow(ctx, `
+		SELECT manifest, signature
+		FROM audit_exports
+		WHERE id = $1`,
+		request.Id,
+	).Scan(&manifest, &export.Signature)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, huma.Error404NotFound("no such export")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	export.Manifest = json.RawMessage(manifest)
+	export.SignatureValid, err = h.keyservice.VerifySignature(ctx, []byte(manifest), export.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body AuditExport }{Body: export}, nil
+}
@@ -0,0 +1,91 @@
+package compliance
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+// PutLegalHold places or lifts a legal hold on a document. Held documents
+// are skipped by the retention purge however long expired.
+func (h handler) PutLegalHold(ctx context.Context, request *struct {
+	Id   string `path:"id" doc:"Document id"`
+	Body LegalHoldRequest
+}) (*struct {
+	Body LegalHold
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+	if request.Body.Hold && request.Body.Reason == "" {
+		return nil, huma.Error422UnprocessableEntity("a reason is required to place a legal hold")
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var purgedAt *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT purged_at
+		FROM documents
+		WHERE id = $1
+		FOR UPDATE`,
+		request.Id,
+	).Scan(&purgedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, huma.Error404NotFound("no such document")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if purgedAt != nil {
+		return nil, huma.Error409Conflict("document was already purged")
+	}
+
+	hold := LegalHold{DocumentId: request.Id}
+	if request.Body.Hold {
+		now := time.Now()
+		hold.Reason, hold.SetBy, hold.SetAt = &request.Body.Reason, &principal.Subject, &now
+	}
+	if err := tx.QueryRow(ctx, `
+		UPDATE documents
+		SET legal_hold = $2, legal_hold_reason = $3, legal_hold_by = $4, legal_hold_at = $5
+		WHERE id = $1
+		RETURNING legal_hold, retention_until`,
+		request.Id,
+		request.Body.Hold,
+		hold.Reason,
+		hold.SetBy,
+		hold.SetAt,
+	).Scan(&hold.Hold, &hold.RetentionUntil); err != nil {
+		return nil, err
+	}
+
+	detail := map[string]any{"hold": request.Body.Hold}
+	if request.Body.Reason != "" {
+		detail["reason"] = request.Body.Reason
+	}
+	if err := audit.Append(ctx, tx, audit.Event{
+		Action:     constant.AUDIT_ACTION_DOCUMENT_LEGAL_HOLD,
+		DocumentId: request.Id,
+		Outcome:    constant.AUDIT_OUTCOME_SUCCESS,
+		Detail:     detail,
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body LegalHold }{Body: hold}, nil
+}
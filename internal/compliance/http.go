@@ -0,0 +1,87 @@
+package compliance
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/keyservice"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/middleware"
+)
+
+type handler struct {
+	config     config.Config
+	keyservice keyservice.KeyService
+	pool       *pgxpool.Pool
+}
+
+func RegisterHandler(
+	ctx context.Context,
+	router huma.API,
+	middleware middleware.Middleware,
+	config config.Config,
+	keyservice keyservice.KeyService,
+	pool *pgxpool.Pool,
+) {
+	h := handler{config, keyservice, pool}
+
+	huma.Register(router, huma.Operation{
+		OperationID: "list-audit-events",
+		Method:      http.MethodGet,
+		Path:        "/audit/events",
+		Summary:     "Search the document access audit log",
+		Tags:        []string{constant.OAPI_TAG_COMPLIANCE},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Compliance),
+		},
+	}, h.ListAuditEvents)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "export-audit-events",
+		Method:      http.MethodGet,
+		Path:        "/audit/events/export",
+		Summary:     "Export the document access audit log",
+		Description: "Streams matching events as JSONL or CSV. Once the download completes, " +
+			"a signed manifest of the file is available under the id sent in the X-Export-Id header.",
+		Tags:     []string{constant.OAPI_TAG_COMPLIANCE},
+		Security: []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Compliance),
+		},
+	}, h.ExportAuditEvents)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "get-audit-export",
+		Method:      http.MethodGet,
+		Path:        "/audit/exports/{id}",
+		Summary:     "Get the signed manifest of an audit export",
+		Tags:        []string{constant.OAPI_TAG_COMPLIANCE},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Compliance),
+		},
+	}, h.GetAuditExport)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "put-document-legal-hold",
+		Method:      http.MethodPut,
+		Path:        "/assets/{id}/legal-hold",
+		Summary:     "Place or lift a legal hold on a document",
+		Description: "Documents under legal hold are kept past their retention period until the hold is lifted.",
+		Tags:        []string{constant.OAPI_TAG_COMPLIANCE},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Parameters:  []*huma.Param{middleware.IdempotencyKeyParam()},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Compliance),
+			middleware.NewIdempotency(),
+		},
+	}, h.PutLegalHold)
+}
@@ -0,0 +1,79 @@
+package compliance
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditFilter narrows audit events down. Subject is the customer whose
+// documents or case were touched, actor whoever touched them.
+type AuditFilter struct {
+	Subject    string    `query:"subject" json:"subject,omitempty" doc:"Customer owning the accessed document or case"`
+	Actor      string    `query:"actor" json:"actor,omitempty" doc:"Subject who performed the action"`
+	DocumentId string    `query:"document_id" json:"documentId,omitempty"`
+	Kind       string    `query:"kind" json:"kind,omitempty" enum:"ktp,salary_slip,unknown" doc:"Kind of the accessed document"`
+	Operation  string    `query:"operation" json:"operation,omitempty" doc:"OpenAPI operation id"`
+	Action     string    `query:"action" json:"action,omitempty"`
+	Outcome    string    `query:"outcome" json:"outcome,omitempty" enum:"success,denied,not_found,failure"`
+	Purpose    string    `query:"purpose" json:"purpose,omitempty" doc:"Purpose stated for the access"`
+	From       time.Time `query:"from" json:"from,omitzero" doc:"Recorded at or after this instant"`
+	To         time.Time `query:"to" json:"to,omitzero" doc:"Recorded before this instant"`
+}
+
+type AuditEvent struct {
+	Seq         int64           `json:"seq"`
+	Id          string          `json:"id"`
+	Action      string          `json:"action"`
+	Actor       *string         `json:"actor,omitempty"`
+	ClientIp    *string         `json:"clientIp,omitempty"`
+	UserAgent   *string         `json:"userAgent,omitempty"`
+	OperationId *string         `json:"operationId,omitempty"`
+	DocumentId  *string         `json:"documentId,omitempty"`
+	CaseId      *string         `json:"caseId,omitempty"`
+	Outcome     string          `json:"outcome"`
+	Purpose     *string         `json:"purpose,omitempty"`
+	Detail      json.RawMessage `json:"detail,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	Hash        string          `json:"hash" doc:"Hex encoded chain hash of the event"`
+}
+
+type AuditEventPage struct {
+	Items      []AuditEvent `json:"items"`
+	NextCursor int64        `json:"nextCursor,omitempty" doc:"Seq to pass as cursor for the next page"`
+}
+
+// ExportManifest describes an export file. Its JSON encoding, exactly as
+// stored, is what the signature covers.
+type ExportManifest struct {
+	Id          string      `json:"id"`
+	Format      string      `json:"format"`
+	RequestedBy string      `json:"requestedBy"`
+	Filter      AuditFilter `json:"filter"`
+	Events      int64       `json:"events"`
+	Bytes       int64       `json:"bytes"`
+	Sha256      string      `json:"sha256" doc:"Hex encoded SHA256 of the exported file"`
+	FirstSeq    int64       `json:"firstSeq,omitempty"`
+	LastSeq     int64       `json:"lastSeq,omitempty"`
+	LastHash    string      `json:"lastHash,omitempty" doc:"Chain hash of the last exported event"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
+
+type AuditExport struct {
+	Manifest       json.RawMessage `json:"manifest" doc:"The signed manifest, byte for byte"`
+	Signature      string          `json:"signature" doc:"Vault transit signature over the manifest"`
+	SignatureValid bool            `json:"signatureValid"`
+}
+
+type LegalHoldRequest struct {
+	Hold   bool   `json:"hold"`
+	Reason string `json:"reason,omitempty" maxLength:"1024" doc:"Why the document is held, required when placing a hold"`
+}
+
+type LegalHold struct {
+	DocumentId     string     `json:"documentId"`
+	Hold           bool       `json:"hold"`
+	Reason         *string    `json:"reason,omitempty"`
+	SetBy          *string    `json:"setBy,omitempty"`
+	SetAt          *time.Time `json:"setAt,omitempty"`
+	RetentionUntil *time.Time `json:"retentionUntil,omitempty" doc:"When the document is purged unless held, absent when kept indefinitely"`
+}
@@ -0,0 +1,279 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/cryptography"
+)
+
+type archivedDocument struct {
+	Id             string          `json:"id"`
+	Filename       string          `json:"filename"`
+	Kind           string          `json:"kind"`
+	Version        int             `json:"version"`
+	PreviousId     *string         `json:"previousId,omitempty"`
+	Status         string          `json:"status"`
+	ScanStatus     string          `json:"scanStatus"`
+	Metadata       json.RawMessage `json:"metadata"`
+	ConsentId      *string         `json:"consentId,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	RetentionUntil *time.Time      `json:"retentionUntil,omitempty"`
+	PurgedAt       *time.Time      `json:"purgedAt,omitempty"`
+	File           string          `json:"file,omitempty"`
+	Omitted        string          `json:"omitted,omitempty"`
+
+	objectKey string
+	current   bool
+}
+
+// archivedEvent is an audit event about the subject. Staff are not named,
+// only whether the subject, staff or the system acted.
+type archivedEvent struct {
+	Seq        int64     `json:"seq"`
+	Action     string    `json:"action"`
+	Actor      string    `json:"actor"`
+	DocumentId *string   `json:"documentId,omitempty"`
+	CaseId     *string   `json:"caseId,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Purpose    *string   `json:"purpose,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type archiveManifest struct {
+	ExportId    string         `json:"exportId"`
+	Subject     string         `json:"subject"`
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Entries     map[string]int `json:"entries"`
+}
+
+// writeSubjectArchive gathers everything held about subject into archive:
+// document rows and their files, extracted fields with their edits, the KYC
+// case with its history, consents, the recorded identity and audit events.
+func (h handler) writeSubjectArchive(ctx context.Context, archive *cryptography.ZipWriter, exportId, subject string) error {
+	now := time.Now()
+	manifest := archiveManifest{
+		ExportId:    exportId,
+		Subject:     subject,
+		GeneratedAt: now.UTC(),
+		Entries:     make(map[string]int),
+	}
+	addJson := func(name string, v any, count int) error {
+		encoded, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		manifest.Entries[name] = count
+		return archive.Add(name, encoded, now)
+	}
+
+	documents, err := h.archivedDocuments(ctx, subject)
+	if err != nil {
+		return err
+	}
+	for i := range documents {
+		document := &documents[i]
+		switch {
+		case document.PurgedAt != nil:
+			document.Omitted = "purged"
+		case document.ScanStatus == constant.SCAN_STATUS_INFECTED:
+			document.Omitted = "quarantined"
+		case !document.current:
+			// uploads predating versioning were keyed by filename, a later
+			// upload overwrote it
+			document.Omitted = "superseded"
+		default:
+			content, err := h.getDecrypted(ctx, document.objectKey)
+			if err != nil {
+				return fmt.Errorf("export: document %s: %w", document.Id, err)
+			}
+			document.File = fmt.Sprintf("files/%s-%s", document.Id, archiveName(document.Filename))
+			if err := archive.Add(document.File, content, document.CreatedAt); err != nil {
+				return err
+			}
+		}
+	}
+	if err := addJson("documents.json", documents, len(documents)); err != nil {
+		return err
+	}
+
+	extractions := make([]DocumentExtraction, 0)
+	for _, document := range documents {
+		if document.PurgedAt != nil {
+			continue
+		}
+		extraction, err := h.openExtraction(ctx, document.Id)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		extraction.Edits, err = h.extractionEdits(ctx, document.Id)
+		if err != nil {
+			return err
+		}
+		extractions = append(extractions, extraction)
+	}
+	if err := addJson("extractions.json", extractions, len(extractions)); err != nil {
+		return err
+	}
+
+	cases := make([]Case, 0, 1)
+	c, err := findCase(ctx, h.pool, "subject", subject, false)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if err == nil {
+		c.History, err = caseHistory(ctx, h.pool, c.Id)
+		if err != nil {
+			return err
+		}
+		cases = append(cases, c)
+	}
+	if err := addJson("cases.json", cases, len(cases)); err != nil {
+		return err
+	}
+
+	rows, err := h.pool.Query(ctx, `
+		SELECT `+consentColumns+`
+		FROM consents
+		WHERE subject = $1
+		ORDER BY id`,
+		subject,
+	)
+	if err != nil {
+		return err
+	}
+	consents, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Consent, error) {
+		return scanConsent(row)
+	})
+	if err != nil {
+		return err
+	}
+	if err := addJson("consents.json", consents, len(consents)); err != nil {
+		return err
+	}
+
+	identities := make([]SubjectIdentity, 0, 1)
+	if h.config.FieldEncryption.Enabled {
+		identity, err := h.subjectIdentity(ctx, subject)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if err == nil {
+			identities = append(identities, identity)
+		}
+	}
+	if err := addJson("identity.json", identities, len(identities)); err != nil {
+		return err
+	}
+
+	events, err := h.archivedEvents(ctx, subject)
+	if err != nil {
+		return err
+	}
+	if err := addJson("audit-events.json", events, len(events)); err != nil {
+		return err
+	}
+
+	return addJson("manifest.json", manifest, len(manifest.Entries))
+}
+
+func isNotFound(err error) bool {
+	var status huma.StatusError
+	return errors.As(err, &status) && status.GetStatus() == http.StatusNotFound
+}
+
+// archiveName keeps uploaded filenames from escaping their directory.
+func archiveName(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if name == "." || name == "/" || name == ".." {
+		return "file"
+	}
+	return name
+}
+
+func (h handler) archivedDocuments(ctx context.Context, subject string) ([]archivedDocument, error) {
+	rows, err := h.pool.Query(ctx, `
+		SELECT d.id, d.filename, d.kind, d.version, d.previous_id, d.status, d.scan_status, d.metadata, d.consent_id,
+			d.created_at, d.retention_until, d.purged_at, d.object_key,
+			NOT EXISTS (SELECT 1 FROM documents o WHERE o.object_key = d.object_key AND o.id > d.id)
+		FROM documents d
+		WHERE d.created_by = $1
+		ORDER BY d.id`,
+		subject,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (archivedDocument, error) {
+		var document archivedDocument
+		err := row.Scan(
+			&document.Id,
+			&document.Filename,
+			&document.Kind,
+			&document.Version,
+			&document.PreviousId,
+			&document.Status,
+			&document.ScanStatus,
+			&document.Metadata,
+			&document.ConsentId,
+			&document.CreatedAt,
+			&document.RetentionUntil,
+			&document.PurgedAt,
+			&document.objectKey,
+			&document.current,
+		)
+		return document, err
+	})
+}
+
+func (h handler) archivedEvents(ctx context.Context, subject string) ([]archivedEvent, error) {
+	rows, err := h.pool.Query(ctx, `
+		SELECT e.seq, e.action, e.subject, e.document_id, e.case_id, e.outcome, e.purpose, e.created_at
+		FROM audit_events e
+		LEFT JOIN documents d ON d.id = e.document_id
+		LEFT JOIN kyc_cases c ON c.id = e.case_id
+		WHERE e.subject = $1 OR d.created_by = $1 OR c.subject = $1
+		ORDER BY e.seq`,
+		subject,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (archivedEvent, error) {
+		var (
+			event archivedEvent
+			actor *string
+		)
+		err := row.Scan(
+			&event.Seq,
+			&event.Action,
+			&actor,
+			&event.DocumentId,
+			&event.CaseId,
+			&event.Outcome,
+			&event.Purpose,
+			&event.CreatedAt,
+		)
+		switch {
+		case actor != nil && *actor == subject:
+			event.Actor = "self"
+		case actor == nil || strings.HasPrefix(*actor, "system"):
+			event.Actor = "system"
+		default:
+			event.Actor = "staff"
+		}
+		return event, err
+	})
+}
@@ -0,0 +1,588 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/middleware"
+	"github.com/oklog/ulid/v2"
+)
+
+// caseTransitions lists, for every state, the states a case may move to.
+// Approved and rejected cases are final.
+var caseTransitions = map[string][]string{
+	constant.CASE_STATE_DRAFT:              {constant.CASE_STATE_SUBMITTED},
+	constant.CASE_STATE_NEEDS_RESUBMISSION: {constant.CASE_STATE_SUBMITTED},
+	constant.CASE_STATE_SUBMITTED:          {constant.CASE_STATE_IN_REVIEW},
+	constant.CASE_STATE_IN_REVIEW: {
+		constant.CASE_STATE_APPROVED,
+		constant.CASE_STATE_REJECTED,
+		constant.CASE_STATE_NEEDS_RESUBMISSION,
+		constant.CASE_STATE_SUBMITTED,
+	},
+}
+
+// editableCaseStates are the states in which the subject may change the
+// documents linked to their case.
+var editableCaseStates = []string{
+	constant.CASE_STATE_DRAFT,
+	constant.CASE_STATE_NEEDS_RESUBMISSION,
+}
+
+const caseColumns = `id, subject, state, reviewer, reason_code, reason_note,
+	created_at, updated_at, submitted_at, claimed_at, lease_expires_at, decided_at`
+
+func canTransition(from, to string) bool {
+	return slices.Contains(caseTransitions[from], to)
+}
+
+func scanCase(row pgx.Row) (Case, error) {
+	var c Case
+	err := row.Scan(
+		&c.Id,
+		&c.Subject,
+		&c.State,
+		&c.Reviewer,
+		&c.ReasonCode,
+		&c.ReasonNote,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.SubmittedAt,
+		&c.ClaimedAt,
+		&c.LeaseUntil,
+		&c.DecidedAt,
+	)
+	return c, err
+}
+
+// findCase loads a case by the given column, locking the row when queried
+// inside a transaction with lock set.
+func findCase(ctx context.Context, q querier, column, value string, lock bool) (Case, error) {
+	query := fmt.Sprintf("SELECT %s FROM kyc_cases WHERE %s = $1", caseColumns, column)
+	if lock {
+		query += " FOR UPDATE"
+	}
+	c, err := scanCase(q.QueryRow(ctx, query, value))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Case{}, huma.Error404NotFound("no such case")
+	}
+	if err != nil {
+		return Case{}, err
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT document_id
+		FROM kyc_case_documents
+		WHERE case_id = $1
+		ORDER BY document_id`,
+		c.Id,
+	)
+	if err != nil {
+		return Case{}, err
+	}
+	c.DocumentIds, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return Case{}, err
+	}
+
+	return c, nil
+}
+
+func caseHistory(ctx context.Context, q querier, caseId string) ([]CaseTransition, error) {
+	rows, err := q.Query(ctx, `
+		SELECT from_state, to_state, actor, reason_code, reason_note, created_at
+		FROM kyc_case_transitions
+		WHERE case_id = $1
+		ORDER BY id`,
+		caseId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (CaseTransition, error) {
+		var t CaseTransition
+		err := row.Scan(&t.FromState, &t.ToState, &t.Actor, &t.ReasonCode, &t.ReasonNote, &t.CreatedAt)
+		return t, err
+	})
+}
+
+// transitionCase moves a locked case to the next state, stamping the
+// timestamps belonging to that state and appending to the history. It returns
+// the audit event of the transition, for the caller to append last.
+func transitionCase(
+	ctx context.Context,
+	tx pgx.Tx,
+	c *Case,
+	to,
+	actor string,
+	reasonCode,
+	reasonNote *string,
+) (audit.Event, error) {
+	if !canTransition(c.State, to) {
+		return audit.Event{}, huma.Error409Conflict(fmt.Sprintf("case cannot move from %s to %s", c.State, to))
+	}
+	now := time.Now()
+
+	switch to {
+	case constant.CASE_STATE_SUBMITTED:
+		// a released claim keeps its place in the queue
+		if c.State != constant.CASE_STATE_IN_REVIEW {
+			c.SubmittedAt = &now
+		}
+		c.Reviewer, c.ClaimedAt, c.LeaseUntil = nil, nil, nil
+		c.ReasonCode, c.ReasonNote = nil, nil
+	case constant.CASE_STATE_IN_REVIEW:
+		c.Reviewer = &actor
+		c.ClaimedAt = &now
+	case constant.CASE_STATE_APPROVED,
+		constant.CASE_STATE_REJECTED,
+		constant.CASE_STATE_NEEDS_RESUBMISSION:
+		// who decided is in the history, a decided case is claimed by nobody
+		c.DecidedAt = &now
+		c.Reviewer, c.LeaseUntil = nil, nil
+		c.ReasonCode, c.ReasonNote = reasonCode, reasonNote
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE kyc_cases
+		SET state = $2, reviewer = $3, reason_code = $4, reason_note = $5, updated_at = $6,
+			submitted_at = $7, claimed_at = $8, lease_expires_at = $9, decided_at = $10
+		WHERE id = $1`,
+		c.Id,
+		to,
+		c.Reviewer,
+		c.ReasonCode,
+		c.ReasonNote,
+		now,
+		c.SubmittedAt,
+		c.ClaimedAt,
+		c.LeaseUntil,
+		c.DecidedAt,
+	); err != nil {
+		return audit.Event{}, err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO kyc_case_transitions (id, case_id, from_state, to_state, actor, reason_code, reason_note, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		ulid.Make().String(),
+		c.Id,
+		c.State,
+		to,
+		actor,
+		reasonCode,
+		reasonNote,
+		now,
+	); err != nil {
+		return audit.Event{}, err
+	}
+	detail := map[string]any{"from": c.State, "to": to}
+	if reasonCode != nil {
+		detail["reasonCode"] = *reasonCode
+	}
+	event := audit.Event{
+		Action:  constant.AUDIT_ACTION_CASE_TRANSITION,
+		Subject: actor,
+		CaseId:  c.Id,
+		Outcome: constant.AUDIT_OUTCOME_SUCCESS,
+		Detail:  detail,
+	}
+
+	c.State = to
+	c.UpdatedAt = now
+	return event, nil
+}
+
+func (h handler) GetMyCase(ctx context.Context, _ *struct{}) (*struct {
+	Body Case
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	c, err := findCase(ctx, h.pool, "subject", principal.Subject, false)
+	if err != nil {
+		return nil, err
+	}
+	c.History, err = caseHistory(ctx, h.pool, c.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body Case }{Body: c}, nil
+}
+
+// PutMyCaseDocuments replaces the documents linked to the caller's case,
+// opening a draft case on first use.
+func (h handler) PutMyCaseDocuments(ctx context.Context, request *struct {
+	Body CaseDocumentsRequest
+}) (*struct {
+	Body Case
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO kyc_cases (id, subject, state, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (subject) DO NOTHING`,
+		ulid.Make().String(),
+		principal.Subject,
+		constant.CASE_STATE_DRAFT,
+		now,
+	); err != nil {
+		return nil, err
+	}
+	c, err := findCase(ctx, tx, "subject", principal.Subject, true)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(editableCaseStates, c.State) {
+		return nil, huma.Error409Conflict(fmt.Sprintf("documents of a %s case cannot be changed", c.State))
+	}
+
+	var owned int
+	if err := tx.QueryRow(ctx, `
+		SELECT count(*)
+		FROM documents
+		WHERE id = ANY($1) AND created_by = $2 AND scan_status <> $3 AND purged_at IS NULL AND is_current
+			AND (consent_id IS NULL OR consent_id IN (SELECT id FROM consents WHERE withdrawn_at IS NULL))`,
+		request.Body.DocumentIds,
+		principal.Subject,
+		constant.SCAN_STATUS_INFECTED,
+	).Scan(&owned); err != nil {
+		return nil, err
+	}
+	slices.Sort(request.Body.DocumentIds)
+	documentIds := slices.Compact(request.Body.DocumentIds)
+	if owned != len(documentIds) {
+		return nil, huma.Error422UnprocessableEntity("every document must be the current version of an uploaded, unflagged document of yours whose consent stands")
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM kyc_case_documents WHERE case_id = $1`, c.Id); err != nil {
+		return nil, err
+	}
+	rows := make([][]interface{}, len(documentIds))
+	for i, documentId := range documentIds {
+		rows[i] = []interface{}{c.Id, documentId}
+	}
+	if _, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{constant.TABLE_KYC_CASE_DOCUMENTS},
+		[]string{"case_id", "document_id"},
+		pgx.CopyFromRows(rows),
+	); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE kyc_cases SET updated_at = $2 WHERE id = $1`, c.Id, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	c.DocumentIds = documentIds
+	c.UpdatedAt = now
+	return &struct{ Body Case }{Body: c}, nil
+}
+
+// SubmitMyCase hands the caller's case over for review once it carries at
+// least a KTP and a salary slip, flagging identity discrepancies and
+// documents reused from other subjects on the way.
+func (h handler) SubmitMyCase(ctx context.Context, _ *struct{}) (*struct {
+	Body Case
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	c, err := findCase(ctx, tx, "subject", principal.Subject, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// documents replaced since they were linked must be linked again
+	var replaced bool
+	if err := tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM kyc_case_documents cd
+			JOIN documents d ON d.id = cd.document_id
+			WHERE cd.case_id = $1 AND NOT d.is_current
+		)`,
+		c.Id,
+	).Scan(&replaced); err != nil {
+		return nil, err
+	}
+	if replaced {
+		return nil, huma.Error422UnprocessableEntity("case links a document that was replaced since, link its current version")
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT d.kind
+		FROM kyc_case_documents cd
+		JOIN documents d ON d.id = cd.document_id
+		WHERE cd.case_id = $1`,
+		c.Id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	kinds, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	for _, required := range []string{constant.DOCUMENT_KIND_KTP, constant.DOCUMENT_KIND_SALARY_SLIP} {
+		if !slices.Contains(kinds, required) {
+			return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("case is missing a %s document", required))
+		}
+	}
+
+	if err := h.checkIdentity(ctx, tx, c, principal); err != nil {
+		return nil, err
+	}
+	if err := h.checkDuplicates(ctx, tx, c); err != nil {
+		return nil, err
+	}
+	event, err := transitionCase(ctx, tx, &c, constant.CASE_STATE_SUBMITTED, principal.Subject, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := audit.Append(ctx, tx, event); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body Case }{Body: c}, nil
+}
+
+func (h handler) ListCases(ctx context.Context, request *struct {
+	Cursor   string `query:"cursor" doc:"Id of the last case from the previous page"`
+	Limit    int    `query:"limit" minimum:"1" maximum:"100" default:"20"`
+	State    string `query:"state" enum:"draft,submitted,in_review,approved,rejected,needs_resubmission"`
+	Reviewer string `query:"reviewer"`
+	Subject  string `query:"subject"`
+}) (*struct {
+	Body CasePage
+}, error) {
+	conditions := make([]string, 0)
+	args := make([]any, 0)
+	where := func(format string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, fmt.Sprintf("$%d", len(args))))
+	}
+
+	if request.Cursor != "" {
+		if _, err := ulid.ParseStrict(request.Cursor); err != nil {
+			return nil, huma.Error400BadRequest("malformed cursor")
+		}
+		where("id < %s", request.Cursor)
+	}
+	if request.State != "" {
+		where("state = %s", request.State)
+	}
+	if request.Reviewer != "" {
+		where("reviewer = %s", request.Reviewer)
+	}
+	if request.Subject != "" {
+		where("subject = %s", request.Subject)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM kyc_cases", caseColumns)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, request.Limit+1)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := h.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	cases, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Case, error) {
+		return scanCase(row)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	page := CasePage{Items: cases}
+	if len(cases) > request.Limit {
+		page.Items = cases[:request.Limit]
+		page.NextCursor = page.Items[request.Limit-1].Id
+	}
+
+	return &struct{ Body CasePage }{Body: page}, nil
+}
+
+func (h handler) GetCase(ctx context.Context, request *struct {
+	Id string `path:"id"`
+}) (*struct {
+	Body Case
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	c, err := findCase(ctx, h.pool, "id", request.Id, false)
+	if err != nil {
+		return nil, err
+	}
+	if c.Subject != principal.Subject && !middleware.HasRole(ctx, h.config.Roles.Reviewer) {
+		return nil, huma.Error404NotFound("no such case")
+	}
+	c.History, err = caseHistory(ctx, h.pool, c.Id)
+	if err != nil {
+		return nil, err
+	}
+	// flags are for reviewers, duplicates point at other subjects
+	if middleware.HasRole(ctx, h.config.Roles.Reviewer) {
+		c.Flags, err = caseFlagList(ctx, h.pool, c.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &struct{ Body Case }{Body: c}, nil
+}
+
+// ClaimCase assigns a specific submitted case, or one whose lease expired, to
+// the calling reviewer.
+func (h handler) ClaimCase(ctx context.Context, request *struct {
+	Id string `path:"id"`
+}) (*struct {
+	Body Case
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := h.checkClaimCapacity(ctx, tx, principal.Subject); err != nil {
+		return nil, err
+	}
+	c, err := findCase(ctx, tx, "id", request.Id, true)
+	if err != nil {
+		return nil, err
+	}
+	if c.Subject == principal.Subject {
+		return nil, huma.Error403Forbidden("reviewers cannot review their own case")
+	}
+	events, err := h.claim(ctx, tx, &c, principal.Subject)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		if err := audit.Append(ctx, tx, event); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body Case }{Body: c}, nil
+}
+
+// DecideCase closes the review of a case claimed by the calling reviewer and
+// carries the outcome over to the linked documents.
+func (h handler) DecideCase(ctx context.Context, request *struct {
+	Id   string `path:"id"`
+	Body CaseDecisionRequest
+}) (*struct {
+	Body Case
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+	decision := request.Body
+	if decision.Decision != constant.CASE_STATE_APPROVED && decision.ReasonCode == "" {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("a reason code is required to mark a case %s", decision.Decision))
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	c, err := findCase(ctx, tx, "id", request.Id, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := holdsLease(c, principal.Subject); err != nil {
+		return nil, err
+	}
+	event, err := transitionCase(
+		ctx,
+		tx,
+		&c,
+		decision.Decision,
+		principal.Subject,
+		nullableString(decision.ReasonCode),
+		nullableString(decision.ReasonNote),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	documentStatus := constant.DOCUMENT_STATUS_PENDING
+	switch decision.Decision {
+	case constant.CASE_STATE_APPROVED:
+		documentStatus = constant.DOCUMENT_STATUS_VERIFIED
+	case constant.CASE_STATE_REJECTED:
+		documentStatus = constant.DOCUMENT_STATUS_REJECTED
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE documents
+		SET status = $2
+		WHERE id IN (SELECT document_id FROM kyc_case_documents WHERE case_id = $1)`,
+		c.Id,
+		documentStatus,
+	); err != nil {
+		return nil, err
+	}
+	if err := audit.Append(ctx, tx, event); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body Case }{Body: c}, nil
+}
@@ -0,0 +1,277 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/oklog/ulid/v2"
+)
+
+const consentColumns = `id, subject, notice_version, channel, granted_at, withdrawn_at, withdrawal_reason`
+
+func scanConsent(row pgx.Row) (Consent, error) {
+	var consent Consent
+	err := row.Scan(
+		&consent.Id,
+		&consent.Subject,
+		&consent.NoticeVersion,
+		&consent.Channel,
+		&consent.GrantedAt,
+		&consent.WithdrawnAt,
+		&consent.WithdrawalReason,
+	)
+	return consent, err
+}
+
+// checkConsent verifies that id is an active consent of subject given to the
+// current privacy notice. The row is share locked, so within a transaction
+// the consent cannot be withdrawn until it ends.
+func (h handler) checkConsent(ctx context.Context, q querier, id, subject string) error {
+	consent, err := scanConsent(q.QueryRow(ctx, `
+		SELECT `+consentColumns+`
+		FROM consents
+		WHERE id = $1 AND subject = $2
+		FOR SHARE`,
+		id,
+		subject,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf("no consent %s of yours", id))
+	}
+	if err != nil {
+		return err
+	}
+	if consent.WithdrawnAt != nil {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf("consent %s was withdrawn", id))
+	}
+	if version := h.config.Consent.NoticeVersion; version != "" && consent.NoticeVersion != version {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf(
+			"consent %s was given to privacy notice %s, consent to %s is required", id, consent.NoticeVersion, version,
+		))
+	}
+	return nil
+}
+
+// precheckConsent refuses an upload whose consent is missing or unusable
+// before any of it gets stored. The consent is checked again under lock once
+// the rows are written.
+func (h handler) precheckConsent(ctx context.Context, consentId string) error {
+	if consentId == "" && h.config.Consent.Required {
+		return huma.Error422UnprocessableEntity("uploads require the id of an active consent")
+	}
+	if principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken); ok && consentId != "" {
+		return h.checkConsent(ctx, h.pool, consentId, principal.Subject)
+	}
+	return nil
+}
+
+// GrantConsent records the caller's acceptance of the current privacy notice.
+func (h handler) GrantConsent(ctx context.Context, request *struct {
+	Body ConsentGrantRequest
+}) (*struct {
+	Body Consent
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+	if version := h.config.Consent.NoticeVersion; version != "" && request.Body.NoticeVersion != version {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("the current privacy notice is %s", version))
+	}
+
+	consent := Consent{
+		Id:            ulid.Make().String(),
+		Subject:       principal.Subject,
+		NoticeVersion: request.Body.NoticeVersion,
+		Channel:       request.Body.Channel,
+		GrantedAt:     time.Now(),
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO consents (id, subject, notice_version, channel, granted_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		consent.Id,
+		consent.Subject,
+		consent.NoticeVersion,
+		consent.Channel,
+		consent.GrantedAt,
+	); err != nil {
+		return nil, err
+	}
+	if err := audit.Append(ctx, tx, audit.Event{
+		Action:  constant.AUDIT_ACTION_CONSENT_GRANT,
+		Outcome: constant.AUDIT_OUTCOME_SUCCESS,
+		Detail: map[string]any{
+			"consentId":     consent.Id,
+			"noticeVersion": consent.NoticeVersion,
+			"channel":       consent.Channel,
+		},
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body Consent }{Body: consent}, nil
+}
+
+func (h handler) ListMyConsents(ctx context.Context, _ *struct{}) (*struct {
+	Body []Consent
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	rows, err := h.pool.Query(ctx, `
+		SELECT `+consentColumns+`
+		FROM consents
+		WHERE subject = $1
+		ORDER BY id DESC`,
+		principal.Subject,
+	)
+	if err != nil {
+		return nil, err
+	}
+	consents, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Consent, error) {
+		return scanConsent(row)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body []Consent }{Body: consents}, nil
+}
+
+// WithdrawConsent withdraws one of the caller's consents. Documents uploaded
+// under it can no longer be added to cases, and depending on configuration
+// are expired for the purge worker to crypto-shred, legal holds permitting.
+func (h handler) WithdrawConsent(ctx context.Context, request *struct {
+	Id   string `path:"id"`
+	Body ConsentWithdrawalRequest
+}) (*struct {
+	Body Consent
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	consent, err := scanConsent(tx.QueryRow(ctx, `
+		SELECT `+consentColumns+`
+		FROM consents
+		WHERE id = $1 AND subject = $2
+		FOR UPDATE`,
+		request.Id,
+		principal.Subject,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, huma.Error404NotFound("no such consent")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if consent.WithdrawnAt != nil {
+		return nil, huma.Error409Conflict("consent was already withdrawn")
+	}
+
+	now := time.Now()
+	consent.WithdrawnAt = &now
+	consent.WithdrawalReason = nullableString(request.Body.Reason)
+	if _, err := tx.Exec(ctx, `
+		UPDATE consents
+		SET withdrawn_at = $2, withdrawal_reason = $3
+		WHERE id = $1`,
+		consent.Id,
+		consent.WithdrawnAt,
+		consent.WithdrawalReason,
+	); err != nil {
+		return nil, err
+	}
+
+	action := h.config.Consent.OnWithdrawal
+	if action == "" {
+		action = constant.CONSENT_WITHDRAWAL_RETAIN
+	}
+	var affected, held int64
+	switch action {
+	case constant.CONSENT_WITHDRAWAL_RETAIN:
+	case constant.CONSENT_WITHDRAWAL_PURGE:
+		affected, held, err = expireConsentDocuments(ctx, tx, consent.Id, now)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("consent: unknown withdrawal action %q", action)
+	}
+
+	if err := audit.Append(ctx, tx, audit.Event{
+		Action:  constant.AUDIT_ACTION_CONSENT_WITHDRAW,
+		Outcome: constant.AUDIT_OUTCOME_SUCCESS,
+		Detail: map[string]any{
+			"consentId": consent.Id,
+			"action":    action,
+			"documents": affected,
+			"held":      held,
+		},
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	if affected > held {
+		h.notifyPurge()
+	}
+
+	return &struct{ Body Consent }{Body: consent}, nil
+}
+
+// expireConsentDocuments expires the documents uploaded under a withdrawn
+// consent, for the purge worker to crypto-shred once tx commits. Documents
+// under legal hold are purged once the hold is released. It reports how many
+// documents expired and how many of them are held.
+func expireConsentDocuments(ctx context.Context, tx pgx.Tx, consentId string, now time.Time) (int64, int64, error) {
+	rows, err := tx.Query(ctx, `
+		UPDATE documents
+		SET retention_until = LEAST(COALESCE(retention_until, $2), $2)
+		WHERE consent_id = $1 AND purged_at IS NULL
+		RETURNING legal_hold`,
+		consentId,
+		now,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	holds, err := pgx.CollectRows(rows, pgx.RowTo[bool])
+	if err != nil {
+		return 0, 0, err
+	}
+	var held int64
+	for _, hold := range holds {
+		if hold {
+			held++
+		}
+	}
+	return int64(len(holds)), held, nil
+}
@@ -0,0 +1,67 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+func TestWithdrawConsentLeavesPurgeToWorker(t *testing.T) {
+	h := newTestHandler(t, config.Config{
+		Consent: config.Consent{OnWithdrawal: constant.CONSENT_WITHDRAWAL_PURGE},
+	})
+	h.pool = testDatabase(t)
+	ctx := asSubject(context.Background(), "subject-a")
+
+	granted, err := h.GrantConsent(ctx, &struct {
+		Body ConsentGrantRequest
+	}{Body: ConsentGrantRequest{NoticeVersion: "v1", Channel: "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	consented, err := h.ingest(ctx, []upload{{Filename: "ktp.png", Kind: constant.DOCUMENT_KIND_KTP, Content: testPng(t, 64, 40)}}, granted.Body.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// past a retention that is not enforced
+	retained, err := h.ingest(ctx, []upload{{Filename: "slip.png", Kind: constant.DOCUMENT_KIND_SALARY_SLIP, Content: testPng(t, 64, 40)}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.pool.Exec(ctx, `UPDATE documents SET retention_until = $2 WHERE id = $1`, retained[0].Id, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.WithdrawConsent(ctx, &struct {
+		Id   string `path:"id"`
+		Body ConsentWithdrawalRequest
+	}{Id: granted.Body.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if keys := storedKeys(t, h, consented[0].ObjectKey); len(keys) == 0 {
+		t.Fatal("withdrawal deleted objects instead of leaving them to the worker")
+	}
+	select {
+	case <-h.purgeSignal:
+	default:
+		t.Fatal("withdrawal did not wake the purge worker")
+	}
+
+	for range 2 {
+		if _, err := h.purgeNextExpired(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.deletePurgedObjects(ctx, purgeDefaultBatchSize); err != nil {
+		t.Fatal(err)
+	}
+	if keys := storedKeys(t, h, consented[0].ObjectKey); len(keys) != 0 {
+		t.Fatalf("objects of the withdrawn document are left behind: %v", keys)
+	}
+	if keys := storedKeys(t, h, retained[0].ObjectKey); len(keys) == 0 {
+		t.Fatal("document was purged by a disabled retention")
+	}
+}
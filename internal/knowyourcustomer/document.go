@@ -0,0 +1,98 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/middleware"
+)
+
+// findDocument resolves ref as a document id or, for clients predating ids,
+// as a filename standing for the latest current upload of the caller. Only
+// ids reach documents of other subjects, filenames are easily guessed.
+func (h handler) findDocument(ctx context.Context, ref string) (DocumentRecord, error) {
+	var subject string
+	if principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken); ok {
+		subject = principal.Subject
+	}
+
+	var document DocumentRecord
+	err := h.pool.QueryRow(ctx, `
+		SELECT id, filename, kind, status, scan_status, metadata, created_by, created_at,
+			object_key, lineage_id, previous_id, version, is_current
+		FROM documents
+		WHERE (id = $1 OR (filename = $1 AND created_by = $2)) AND purged_at IS NULL
+		ORDER BY id = $1 DESC, is_current DESC, created_at DESC
+		LIMIT 1`,
+		ref,
+		subject,
+	).Scan(
+		&document.Id,
+		&document.Filename,
+		&document.Kind,
+		&document.Status,
+		&document.ScanStatus,
+		&document.Metadata,
+		&document.CreatedBy,
+		&document.CreatedAt,
+		&document.ObjectKey,
+		&document.LineageId,
+		&document.PreviousId,
+		&document.Version,
+		&document.IsCurrent,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DocumentRecord{}, huma.Error404NotFound(fmt.Sprintf("no document %s", ref))
+	}
+	if err != nil {
+		return DocumentRecord{}, err
+	}
+	return document, nil
+}
+
+// findVariantKey returns the object key holding a rendition of the document.
+func (h handler) findVariantKey(ctx context.Context, document DocumentRecord, variant string) (string, error) {
+	if variant == constant.VARIANT_ORIGINAL {
+		return document.ObjectKey, nil
+	}
+
+	var objectKey string
+	err := h.pool.QueryRow(ctx, `
+		SELECT object_key
+		FROM document_variants
+		WHERE document_id = $1 AND variant = $2`,
+		document.Id,
+		variant,
+	).Scan(&objectKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", huma.Error404NotFound(fmt.Sprintf("no %s variant for %s", variant, document.Id))
+	}
+	if err != nil {
+		return "", err
+	}
+	return objectKey, nil
+}
+
+// authorizeOwnerOrReviewer lets through the uploader of the document and
+// holders of the reviewer role.
+func (h handler) authorizeOwnerOrReviewer(ctx context.Context, document DocumentRecord) error {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return errors.New("missing principal token in context")
+	}
+	if principal.Subject == document.CreatedBy || middleware.HasRole(ctx, h.config.Roles.Reviewer) {
+		return nil
+	}
+	return huma.Error404NotFound(fmt.Sprintf("no document %s", document.Id))
+}
+
+// documentObjectKey is where an upload is stored. Every upload gets its own
+// key, so a replaced version is kept rather than overwritten.
+func documentObjectKey(id, filename string) string {
+	return fmt.Sprintf("%s/%s/%s", constant.DOCUMENT_OBJECT_PREFIX, id, archiveName(filename))
+}
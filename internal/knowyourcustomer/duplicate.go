@@ -0,0 +1,151 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"crypto/sha256"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/extractor"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/imaging"
+)
+
+// phashBands is the number of 16-bit bands a perceptual hash is split into for
+// lookup. Two hashes at most phashBands-1 bits apart share at least one band
+// unchanged, so an exact band match finds every candidate within that
+// distance through the GIN index.
+const phashBands = 4
+
+// fingerprint computes the keyed content HMAC of an upload, and for images
+// their perceptual hashes, taken on the upright picture. Only the SHA256 of
+// the content is sent to Vault, keeping large documents off the wire.
+func (h handler) fingerprint(ctx context.Context, content []byte, exifFields map[string]interface{}) (*Fingerprint, error) {
+	digest := sha256.Sum256(content)
+	hmac, err := h.keyservice.Hmac(ctx, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := &Fingerprint{ContentHmac: hmac}
+	if extractor.IsPdf(content) {
+		return fingerprint, nil
+	}
+
+	img, err := imaging.Decode(content)
+	if err != nil {
+		return nil, err
+	}
+	img = imaging.Orient(img, imaging.ParseOrientation(exifFields["Orientation"]))
+	phash, dhash := imaging.PHash(img), imaging.DHash(img)
+	fingerprint.PHash, fingerprint.DHash = &phash, &dhash
+	return fingerprint, nil
+}
+
+// bands splits a perceptual hash into position-tagged bands, so the same
+// 16 bits at different positions never compare equal.
+func bands(hash uint64) []int32 {
+	bands := make([]int32, phashBands)
+	for i := range bands {
+		bands[i] = int32(i<<16) | int32((hash>>(16*i))&0xFFFF)
+	}
+	return bands
+}
+
+func (f Fingerprint) row(documentId, createdBy string, createdAt time.Time) []any {
+	row := []any{documentId, createdBy, f.ContentHmac, nil, nil, nil, createdAt}
+	if f.PHash != nil && f.DHash != nil {
+		// stored as the signed reinterpretation of the bits
+		row[3], row[4], row[5] = int64(*f.PHash), int64(*f.DHash), bands(*f.PHash)
+	}
+	return row
+}
+
+// checkDuplicates flags every document of the case whose content, or picture,
+// was already uploaded by another subject. A perceptual match needs both
+// hashes within the configured distance, since all KTPs share a layout.
+func (h handler) checkDuplicates(ctx context.Context, tx pgx.Tx, c Case) error {
+	if !h.config.Duplicates.Enabled {
+		return nil
+	}
+	maxDistance := min(max(h.config.Duplicates.MaxDistance, 0), phashBands-1)
+
+	rows, err := tx.Query(ctx, `
+		SELECT f.document_id, f.content_hmac, f.phash, f.dhash
+		FROM kyc_case_documents cd
+		JOIN document_fingerprints f ON f.document_id = cd.document_id
+		WHERE cd.case_id = $1
+		ORDER BY f.document_id`,
+		c.Id,
+	)
+	if err != nil {
+		return err
+	}
+	type owned struct {
+		documentId  string
+		contentHmac string
+		phash       *int64
+		dhash       *int64
+	}
+	fingerprints, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (owned, error) {
+		var o owned
+		err := row.Scan(&o.documentId, &o.contentHmac, &o.phash, &o.dhash)
+		return o, err
+	})
+	if err != nil {
+		return err
+	}
+
+	flags := &caseFlags{caseId: c.Id, source: constant.CASE_FLAG_SOURCE_DUPLICATES}
+	for _, fingerprint := range fingerprints {
+		var phashBands []int32
+		if fingerprint.phash != nil {
+			phashBands = bands(uint64(*fingerprint.phash))
+		}
+		rows, err := tx.Query(ctx, `
+			SELECT document_id, content_hmac, phash, dhash
+			FROM document_fingerprints
+			WHERE created_by <> $1 AND (content_hmac = $2 OR phash_bands && $3)
+			ORDER BY document_id`,
+			c.Subject,
+			fingerprint.contentHmac,
+			phashBands,
+		)
+		if err != nil {
+			return err
+		}
+		candidates, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (owned, error) {
+			var o owned
+			err := row.Scan(&o.documentId, &o.contentHmac, &o.phash, &o.dhash)
+			return o, err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, candidate := range candidates {
+			if candidate.contentHmac == fingerprint.contentHmac {
+				flags.add(fingerprint.documentId, constant.CASE_FLAG_DUPLICATE_DOCUMENT, map[string]any{
+					"matchedDocumentId": candidate.documentId,
+					"match":             "exact",
+				})
+				continue
+			}
+			if fingerprint.phash == nil || candidate.phash == nil {
+				continue
+			}
+			phashDistance := imaging.HammingDistance(uint64(*fingerprint.phash), uint64(*candidate.phash))
+			dhashDistance := imaging.HammingDistance(uint64(*fingerprint.dhash), uint64(*candidate.dhash))
+			if phashDistance > maxDistance || dhashDistance > maxDistance {
+				continue
+			}
+			flags.add(fingerprint.documentId, constant.CASE_FLAG_DUPLICATE_DOCUMENT, map[string]any{
+				"matchedDocumentId": candidate.documentId,
+				"match":             "perceptual",
+				"phashDistance":     phashDistance,
+				"dhashDistance":     dhashDistance,
+			})
+		}
+	}
+
+	return flags.save(ctx, tx)
+}
@@ -0,0 +1,508 @@
+package knowyourcustomer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/cryptography"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/notifier"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/objectstore"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	exportPollInterval = time.Minute
+	// exportTimeout bounds building an export, one processing for twice as
+	// long is considered abandoned by a worker that died
+	exportTimeout = 15 * time.Minute
+	// exportPasswordSize is the entropy of passwords generated for public
+	// key recipients
+	exportPasswordSize = 24
+)
+
+const subjectExportColumns = `id, status, recipient, wrapped_password, size, error, created_at, completed_at, expires_at`
+
+func scanSubjectExport(row pgx.Row) (SubjectExport, error) {
+	var export SubjectExport
+	err := row.Scan(
+		&export.Id,
+		&export.Status,
+		&export.Recipient,
+		&export.WrappedPassword,
+		&export.Size,
+		&export.Error,
+		&export.CreatedAt,
+		&export.CompletedAt,
+		&export.ExpiresAt,
+	)
+	return export, err
+}
+
+func (h handler) notifyExport() {
+	select {
+	case h.exportSignal <- struct{}{}:
+	default:
+	}
+}
+
+// startExportWorker builds requested exports one at a time and deletes the
+// archives of expired ones.
+func (h handler) startExportWorker(ctx context.Context) {
+	if !h.config.Export.Enabled {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(exportPollInterval)
+		defer ticker.Stop()
+
+		for {
+			for {
+				processed, err := h.processNextExport(ctx)
+				if err != nil {
+					log.Error().Err(err).Msg("export: failed to build export")
+				}
+				if !processed {
+					break
+				}
+			}
+			if err := h.expireExports(ctx); err != nil {
+				log.Error().Err(err).Msg("export: failed to expire exports")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.exportSignal:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// processNextExport claims one pending export, or one whose worker
+// apparently died, and builds its archive. It reports whether a row was
+// claimed.
+func (h handler) processNextExport(ctx context.Context) (bool, error) {
+	now := time.Now()
+
+	var (
+		id, subject, recipient string
+		attempts               int
+		password               []byte
+		edek, digest           *string
+		publicKey              *string
+	)
+	err := h.pool.QueryRow(ctx, `
+		UPDATE subject_exports
+		SET status = $1, attempts = attempts + 1, started_at = $2
+		WHERE id = (
+			SELECT id
+			FROM subject_exports
+			WHERE status = $3 OR (status = $1 AND started_at < $4)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, subject, recipient, attempts, password, edek, dek_digest, public_key`,
+		constant.EXPORT_STATUS_PROCESSING,
+		now,
+		constant.EXPORT_STATUS_PENDING,
+		now.Add(-2*exportTimeout),
+	).Scan(&id, &subject, &recipient, &attempts, &password, &edek, &digest, &publicKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	objectKey := constant.EXPORT_OBJECT_PREFIX + id + ".zip"
+	buildCtx, cancel := context.WithTimeout(ctx, exportTimeout)
+	size, wrapped, buildErr := h.buildExport(buildCtx, id, subject, recipient, password, edek, digest, publicKey, objectKey)
+	cancel()
+	if buildErr != nil {
+		log.Warn().Err(buildErr).Str("export", id).Int("attempts", attempts).Msg("export: attempt failed")
+		if attempts < h.config.Export.MaxAttempts {
+			_, err := h.pool.Exec(ctx, `
+				UPDATE subject_exports
+				SET status = $2, error = $3
+				WHERE id = $1`,
+				id,
+				constant.EXPORT_STATUS_PENDING,
+				buildErr.Error(),
+			)
+			return true, err
+		}
+		// the sealed password goes with the last attempt
+		if _, err := h.pool.Exec(ctx, `
+			UPDATE subject_exports
+			SET status = $2, error = $3, password = NULL, edek = NULL, dek_digest = NULL, completed_at = $4
+			WHERE id = $1`,
+			id,
+			constant.EXPORT_STATUS_FAILED,
+			buildErr.Error(),
+			time.Now(),
+		); err != nil {
+			return true, err
+		}
+		h.sendNotification(ctx, notifier.Notification{
+			Type:    constant.NOTIFICATION_TYPE_EXPORT_FAILED,
+			Subject: subject,
+			Data:    map[string]any{"exportId": id},
+		})
+		return true, nil
+	}
+
+	completedAt := time.Now()
+	expiresAt := completedAt.Add(time.Duration(h.config.Export.Ttl) * time.Second)
+	if _, err := h.pool.Exec(ctx, `
+		UPDATE subject_exports
+		SET status = $2, object_key = $3, size = $4, wrapped_password = $5, error = NULL,
+			password = NULL, edek = NULL, dek_digest = NULL, completed_at = $6, expires_at = $7
+		WHERE id = $1`,
+		id,
+		constant.EXPORT_STATUS_READY,
+		objectKey,
+		size,
+		wrapped,
+		completedAt,
+		expiresAt,
+	); err != nil {
+		return true, err
+	}
+	h.sendNotification(ctx, notifier.Notification{
+		Type:    constant.NOTIFICATION_TYPE_EXPORT_READY,
+		Subject: subject,
+		Data:    map[string]any{"exportId": id, "expiresAt": expiresAt.UTC()},
+	})
+	return true, nil
+}
+
+// buildExport writes the archive of subject to objectKey, encrypted with the
+// sealed password, or a generated one wrapped for the public key. It
+// returns the archive size and, for public key recipients, the wrapped
+// password.
+func (h handler) buildExport(
+	ctx context.Context,
+	id,
+	subject,
+	recipient string,
+	sealedPassword []byte,
+	edek,
+	digest,
+	publicKey *string,
+	objectKey string,
+) (int64, *string, error) {
+	var (
+		password string
+		wrapped  *string
+	)
+	switch recipient {
+	case constant.EXPORT_RECIPIENT_PASSWORD:
+		if sealedPassword == nil || edek == nil || digest == nil {
+			return 0, nil, errors.New("export: password is gone")
+		}
+		if err := h.openJson(ctx, sealedPassword, *edek, *digest, &password); err != nil {
+			return 0, nil, err
+		}
+	case constant.EXPORT_RECIPIENT_PUBLIC_KEY:
+		if publicKey == nil {
+			return 0, nil, errors.New("export: public key is gone")
+		}
+		key, err := cryptography.ParseRecipientKey([]byte(*publicKey))
+		if err != nil {
+			return 0, nil, err
+		}
+		secret := make([]byte, exportPasswordSize)
+		if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+			return 0, nil, err
+		}
+		password = base64.RawURLEncoding.EncodeToString(secret)
+		ciphertext, err := cryptography.WrapForRecipient(key, []byte(password))
+		if err != nil {
+			return 0, nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(ciphertext)
+		wrapped = &encoded
+	default:
+		return 0, nil, fmt.Errorf("export: unknown recipient %q", recipient)
+	}
+
+	buffer := new(bytes.Buffer)
+	archive, err := cryptography.NewZipWriter(buffer, password)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := h.writeSubjectArchive(ctx, archive, id, subject); err != nil {
+		return 0, nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return 0, nil, err
+	}
+
+	// the archive is encrypted already and stored as is
+	size := int64(buffer.Len())
+	if err := h.objects.Put(ctx, objectKey, bytes.NewReader(buffer.Bytes()), size, objectstore.PutOptions{
+		ContentType: "application/zip",
+	}); err != nil {
+		return 0, nil, err
+	}
+	return size, wrapped, nil
+}
+
+// expireExports deletes the archives of exports past their expiry.
+func (h handler) expireExports(ctx context.Context) error {
+	for {
+		expired, err := h.expireNextExport(ctx)
+		if err != nil || !expired {
+			return err
+		}
+	}
+}
+
+func (h handler) expireNextExport(ctx context.Context) (bool, error) {
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id, objectKey string
+	err = tx.QueryRow(ctx, `
+		SELECT id, object_key
+		FROM subject_exports
+		WHERE status = $1 AND expires_at <= $2
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`,
+		constant.EXPORT_STATUS_READY,
+		time.Now(),
+	).Scan(&id, &objectKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := h.objects.Delete(ctx, objectKey); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE subject_exports
+		SET status = $2, object_key = NULL, wrapped_password = NULL
+		WHERE id = $1`,
+		id,
+		constant.EXPORT_STATUS_EXPIRED,
+	); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+func (h handler) sendNotification(ctx context.Context, notification notifier.Notification) {
+	notification.CreatedAt = time.Now().UTC()
+	if err := h.notifier.Notify(ctx, notification); err != nil {
+		log.Warn().Err(err).Str("type", notification.Type).Msg("notifier: failed to notify")
+	}
+}
+
+// RequestMyExport queues an export of everything held about the caller.
+// The archive is encrypted with the given password, or with a generated one
+// encrypted to the given public key.
+func (h handler) RequestMyExport(ctx context.Context, request *struct {
+	Body SubjectExportRequest
+}) (*struct {
+	Body SubjectExport
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+	if !h.config.Export.Enabled {
+		return nil, huma.Error404NotFound("exports are not available")
+	}
+	if (request.Body.Password == "") == (request.Body.PublicKey == "") {
+		return nil, huma.Error422UnprocessableEntity("exactly one of password or publicKey is required")
+	}
+
+	export := SubjectExport{
+		Id:        ulid.Make().String(),
+		Status:    constant.EXPORT_STATUS_PENDING,
+		Recipient: constant.EXPORT_RECIPIENT_PASSWORD,
+		CreatedAt: time.Now(),
+	}
+	var (
+		sealedPassword []byte
+		edek, digest   *string
+		publicKey      *string
+	)
+	if request.Body.PublicKey != "" {
+		if _, err := cryptography.ParseRecipientKey([]byte(request.Body.PublicKey)); err != nil {
+			return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("unusable public key: %s", err))
+		}
+		export.Recipient = constant.EXPORT_RECIPIENT_PUBLIC_KEY
+		publicKey = &request.Body.PublicKey
+	} else {
+		ciphertext, key, err := h.sealJson(ctx, request.Body.Password)
+		if err != nil {
+			return nil, err
+		}
+		sealedPassword, edek, digest = ciphertext, &key.CiphertextEncoded, &key.DigestEncoded
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// serializes requests of the same subject so only one runs at a time
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "subject_exports:"+principal.Subject); err != nil {
+		return nil, err
+	}
+	var running bool
+	if err := tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM subject_exports
+			WHERE subject = $1 AND status IN ($2, $3)
+		)`,
+		principal.Subject,
+		constant.EXPORT_STATUS_PENDING,
+		constant.EXPORT_STATUS_PROCESSING,
+	).Scan(&running); err != nil {
+		return nil, err
+	}
+	if running {
+		return nil, huma.Error409Conflict("an export is already being prepared")
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO subject_exports (id, subject, status, recipient, password, edek, dek_digest, public_key, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		export.Id,
+		principal.Subject,
+		export.Status,
+		export.Recipient,
+		sealedPassword,
+		edek,
+		digest,
+		publicKey,
+		export.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if err := audit.Append(ctx, tx, audit.Event{
+		Action:  constant.AUDIT_ACTION_SUBJECT_EXPORT,
+		Outcome: constant.AUDIT_OUTCOME_SUCCESS,
+		Detail:  map[string]any{"exportId": export.Id, "recipient": export.Recipient},
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	h.notifyExport()
+
+	return &struct{ Body SubjectExport }{Body: export}, nil
+}
+
+// GetMyExport reports on the caller's latest export.
+func (h handler) GetMyExport(ctx context.Context, _ *struct{}) (*struct {
+	Body SubjectExport
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	export, err := scanSubjectExport(h.pool.QueryRow(ctx, `
+		SELECT `+subjectExportColumns+`
+		FROM subject_exports
+		WHERE subject = $1
+		ORDER BY id DESC
+		LIMIT 1`,
+		principal.Subject,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, huma.Error404NotFound("no export was requested")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body SubjectExport }{Body: export}, nil
+}
+
+// DownloadMyExport hands out the encrypted archive of a ready export.
+func (h handler) DownloadMyExport(ctx context.Context, request *struct {
+	Id string `path:"id"`
+}) (_ *struct {
+	ContentType        string `header:"Content-Type"`
+	ContentDisposition string `header:"Content-Disposition"`
+	Body               []byte
+}, err error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+	event := &audit.Event{
+		Action: constant.AUDIT_ACTION_SUBJECT_EXPORT_DOWNLOAD,
+		Detail: map[string]any{"exportId": request.Id},
+	}
+	defer func() { err = audit.RecordAccess(ctx, h.pool, event, err) }()
+
+	var (
+		status    string
+		objectKey *string
+	)
+	err = h.pool.QueryRow(ctx, `
+		SELECT status, object_key
+		FROM subject_exports
+		WHERE id = $1 AND subject = $2`,
+		request.Id,
+		principal.Subject,
+	).Scan(&status, &objectKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, huma.Error404NotFound("no such export")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status != constant.EXPORT_STATUS_READY || objectKey == nil {
+		return nil, huma.Error409Conflict(fmt.Sprintf("export is %s", status))
+	}
+
+	obj, err := h.objects.Get(ctx, *objectKey)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+	archive, err := io.ReadAll(obj.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct {
+		ContentType        string `header:"Content-Type"`
+		ContentDisposition string `header:"Content-Disposition"`
+		Body               []byte
+	}{
+		ContentType:        "application/zip",
+		ContentDisposition: fmt.Sprintf(`attachment; filename="export-%s.zip"`, request.Id),
+		Body:               archive,
+	}, nil
+}
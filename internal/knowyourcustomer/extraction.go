@@ -0,0 +1,265 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/extractor"
+	"github.com/rs/zerolog/log"
+)
+
+const extractionPollInterval = 30 * time.Second
+
+// extractableKinds are the document kinds queued for extraction on upload.
+var extractableKinds = []string{
+	constant.DOCUMENT_KIND_KTP,
+	constant.DOCUMENT_KIND_SALARY_SLIP,
+}
+
+func (h handler) shouldExtract(file File) bool {
+	return h.config.Extraction.Enabled &&
+		slices.Contains(extractableKinds, file.Kind) &&
+		file.Scan.Status != constant.SCAN_STATUS_INFECTED
+}
+
+// notifyExtraction wakes an idle worker up, pending rows are otherwise picked
+// up on the next poll.
+func (h handler) notifyExtraction() {
+	select {
+	case h.extractionSignal <- struct{}{}:
+	default:
+	}
+}
+
+// startExtractionWorkers runs the configured number of workers draining the
+// document_extractions table. Work is claimed from the database, so uploads
+// queued before a restart are still processed.
+func (h handler) startExtractionWorkers(ctx context.Context) {
+	if !h.config.Extraction.Enabled {
+		return
+	}
+	// attempts outliving twice the timeout are taken over, without one every
+	// running attempt would be
+	if h.config.Extraction.Timeout <= 0 {
+		log.Fatal().Int64("timeout", h.config.Extraction.Timeout).Msg("extraction: timeout must be positive")
+	}
+	for range max(1, h.config.Extraction.Workers) {
+		go h.runExtractionWorker(ctx)
+	}
+}
+
+func (h handler) runExtractionWorker(ctx context.Context) {
+	ticker := time.NewTicker(extractionPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			processed, err := h.processNextExtraction(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("extraction: failed to process document")
+			}
+			if !processed {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.extractionSignal:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processNextExtraction claims one pending extraction, or one whose worker
+// apparently died, and runs it. It reports whether a row was claimed.
+func (h handler) processNextExtraction(ctx context.Context) (bool, error) {
+	timeout := time.Duration(h.config.Extraction.Timeout) * time.Second
+	now := time.Now()
+
+	var (
+		documentId string
+		attempts   int
+	)
+	err := h.pool.QueryRow(ctx, `
+		UPDATE document_extractions
+		SET status = $1, attempts = attempts + 1, started_at = $2
+		WHERE document_id = (
+			SELECT document_id
+			FROM document_extractions
+			WHERE status = $3 OR (status = $1 AND started_at < $4)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING document_id, attempts`,
+		constant.EXTRACTION_STATUS_PROCESSING,
+		now,
+		constant.EXTRACTION_STATUS_PENDING,
+		now.Add(-2*timeout),
+	).Scan(&documentId, &attempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	fields, extractErr := h.extract(ctx, documentId, timeout)
+	if extractErr != nil {
+		status := constant.EXTRACTION_STATUS_PENDING
+		if attempts >= h.config.Extraction.MaxAttempts {
+			status = constant.EXTRACTION_STATUS_FAILED
+		}
+		log.Warn().Err(extractErr).Str("document", documentId).Int("attempts", attempts).Msg("extraction: attempt failed")
+		_, err := h.pool.Exec(ctx, `
+			UPDATE document_extractions
+			SET status = $2, error = $3
+			WHERE document_id = $1`,
+			documentId,
+			status,
+			extractErr.Error(),
+		)
+		return true, err
+	}
+
+	ciphertext, key, err := h.sealJson(ctx, fields)
+	if err != nil {
+		return true, err
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return true, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE document_extractions
+		SET status = $2, extractor = $3, fields = $4, edek = $5, dek_digest = $6,
+			error = NULL, completed_at = $7
+		WHERE document_id = $1`,
+		documentId,
+		constant.EXTRACTION_STATUS_COMPLETED,
+		h.extractor.Name(),
+		ciphertext,
+		key.CiphertextEncoded,
+		key.DigestEncoded,
+		time.Now(),
+	); err != nil {
+		return true, err
+	}
+	if err := h.recordIdentity(ctx, tx, documentId, fields); err != nil {
+		return true, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+func (h handler) extract(ctx context.Context, documentId string, timeout time.Duration) (extractor.Fields, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	document, err := h.findDocument(ctx, documentId)
+	if err != nil {
+		return nil, err
+	}
+	content, err := h.getDecrypted(ctx, document.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	return h.extractor.Extract(ctx, document.Kind, content)
+}
+
+// openExtraction loads the extraction of a document, unsealing its fields
+// once completed.
+func (h handler) openExtraction(ctx context.Context, documentId string) (DocumentExtraction, error) {
+	extraction, err := h.loadExtraction(ctx, documentId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DocumentExtraction{}, huma.Error404NotFound("document has no extraction")
+	}
+	return extraction, err
+}
+
+// loadExtraction is openExtraction for callers telling a document without an
+// extraction apart themselves, reported as pgx.ErrNoRows.
+func (h handler) loadExtraction(ctx context.Context, documentId string) (DocumentExtraction, error) {
+	var (
+		extraction DocumentExtraction
+		ciphertext []byte
+		edek       *string
+		digest     *string
+	)
+	err := h.pool.QueryRow(ctx, `
+		SELECT document_id, status, attempts, extractor, fields, edek, dek_digest, error, created_at, completed_at
+		FROM document_extractions
+		WHERE document_id = $1`,
+		documentId,
+	).Scan(
+		&extraction.DocumentId,
+		&extraction.Status,
+		&extraction.Attempts,
+		&extraction.Extractor,
+		&ciphertext,
+		&edek,
+		&digest,
+		&extraction.Error,
+		&extraction.CreatedAt,
+		&extraction.CompletedAt,
+	)
+	if err != nil {
+		return DocumentExtraction{}, err
+	}
+	if extraction.Status != constant.EXTRACTION_STATUS_COMPLETED || edek == nil {
+		return extraction, nil
+	}
+
+	if err := h.openJson(ctx, ciphertext, *edek, *digest, &extraction.Fields); err != nil {
+		return DocumentExtraction{}, err
+	}
+	return extraction, nil
+}
+
+func (h handler) GetAssetExtraction(ctx context.Context, request *struct {
+	Id string `path:"id" doc:"Document id, or the filename of its latest upload"`
+	AccessJustification
+}) (_ *struct {
+	Body DocumentExtraction
+}, err error) {
+	event := &audit.Event{
+		Action: constant.AUDIT_ACTION_DOCUMENT_EXTRACTION_READ,
+		Detail: map[string]any{"reference": request.Id},
+	}
+	defer func() { err = audit.RecordAccess(ctx, h.pool, event, err) }()
+
+	document, err := h.findDocument(ctx, request.Id)
+	if err != nil {
+		return nil, err
+	}
+	event.DocumentId = document.Id
+	if err := h.authorizeOwnerOrReviewer(ctx, document); err != nil {
+		return nil, err
+	}
+	if err := h.justifyAccess(ctx, document.CreatedBy, request.AccessJustification, event); err != nil {
+		return nil, err
+	}
+	extraction, err := h.openExtraction(ctx, document.Id)
+	if err != nil {
+		return nil, err
+	}
+	extraction.Edits, err = h.extractionEdits(ctx, document.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body DocumentExtraction }{Body: extraction}, nil
+}
@@ -0,0 +1,261 @@
+package knowyourcustomer
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/barasher/go-exiftool"
+	"github.com/coreos/go-oidc/v3/oidc"
+	vaultApi "github.com/hashicorp/vault/api"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/keyservice"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/notifier"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/objectstore"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/scanner"
+	"github.com/oklog/ulid/v2"
+)
+
+// testDatabaseEnv names a PostgreSQL database tests needing one run
+// against, each in a schema of its own. They are skipped without it.
+const testDatabaseEnv = "KYC_TEST_DATABASE_URL"
+
+// fakeWrapPrefix marks a DEK as wrapped by fakeTransit, which only encodes
+// it, so unwrapping anything it did not wrap fails like it would in Vault.
+const fakeWrapPrefix = "vault:v1:"
+
+// fakeTransit serves the transit endpoints the handler calls, under the
+// paths configured in vault.
+func fakeTransit(t *testing.T, vault config.Vault) keyservice.KeyService {
+	t.Helper()
+	reply := func(w http.ResponseWriter, data map[string]any) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}
+	base := "/v1/" + vault.TransitBasePath
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			BatchInput []keyservice.TransitEncryptRequest `json:"batch_input"`
+			Ciphertext string                             `json:"ciphertext"`
+			Input      string                             `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Path {
+		case path.Join(base, "encrypt", vault.TransitKey):
+			results := make([]map[string]any, len(request.BatchInput))
+			for i, input := range request.BatchInput {
+				results[i] = map[string]any{"ciphertext": fakeWrapPrefix + input.Plaintext}
+			}
+			reply(w, map[string]any{"batch_results": results})
+		case path.Join(base, "decrypt", vault.TransitKey):
+			plaintext, ok := strings.CutPrefix(request.Ciphertext, fakeWrapPrefix)
+			if !ok {
+				http.Error(w, `{"errors":["invalid ciphertext"]}`, http.StatusBadRequest)
+				return
+			}
+			reply(w, map[string]any{"plaintext": plaintext})
+		case path.Join(base, "hmac", vault.HmacKey, "sha2-256"):
+			input, err := base64.StdEncoding.DecodeString(request.Input)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			mac := hmac.New(sha256.New, []byte(vault.HmacKey))
+			mac.Write(input)
+			reply(w, map[string]any{"hmac": fakeWrapPrefix + base64.StdEncoding.EncodeToString(mac.Sum(nil))})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	vaultConfig := vaultApi.DefaultConfig()
+	vaultConfig.Address = server.URL
+	client, err := vaultApi.NewClient(vaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken("test")
+	return keyservice.New(client, vault)
+}
+
+// stubExif reports every file as an upright PNG, in place of exiftool.
+type stubExif struct{}
+
+func (stubExif) ExtractMetadata(files ...string) []exiftool.FileMetadata {
+	metadata := make([]exiftool.FileMetadata, len(files))
+	for i, file := range files {
+		metadata[i] = exiftool.FileMetadata{
+			File: file,
+			Fields: map[string]interface{}{
+				"FileType":    "PNG",
+				"MIMEType":    "image/png",
+				"Orientation": "Horizontal (normal)",
+			},
+		}
+	}
+	return metadata
+}
+
+// flagAll flags every file as infected.
+type flagAll struct{}
+
+func (flagAll) Scan(context.Context, io.Reader) (scanner.Verdict, error) {
+	return scanner.Verdict{
+		Status:    constant.SCAN_STATUS_INFECTED,
+		Signature: "Eicar-Signature",
+		ScannedAt: time.Now(),
+	}, nil
+}
+
+// newTestHandler builds a handler storing objects in memory, with keys
+// wrapped by fakeTransit and no database.
+func newTestHandler(t *testing.T, config config.Config) handler {
+	t.Helper()
+	if config.Vault.TransitBasePath == "" {
+		config.Vault.TransitBasePath = "transit"
+		config.Vault.TransitKey = "documents"
+		config.Vault.HmacKey = "fingerprints"
+	}
+	return handler{
+		config:           config,
+		objects:          objectstore.NewMemory(),
+		exif:             stubExif{},
+		keyservice:       fakeTransit(t, config.Vault),
+		scanner:          scanner.Disabled{},
+		notifier:         notifier.Disabled{},
+		extractionSignal: make(chan struct{}, 1),
+		exportSignal:     make(chan struct{}, 1),
+		purgeSignal:      make(chan struct{}, 1),
+	}
+}
+
+// testDatabase connects to the database named by testDatabaseEnv, in a
+// fresh schema holding every migration, dropped again after the test.
+func testDatabase(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv(testDatabaseEnv)
+	if url == "" {
+		t.Skipf("%s is not set", testDatabaseEnv)
+	}
+	ctx := context.Background()
+
+	schema := "kyc_test_" + strings.ToLower(ulid.Make().String())
+	poolConfig, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolConfig.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := pool.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+		pool.Close()
+	})
+
+	if _, err := pool.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(migrations)
+	for _, migration := range migrations {
+		content, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, up, _ := strings.Cut(string(content), "-- +goose Up")
+		up, _, _ = strings.Cut(up, "-- +goose Down")
+		if _, err := pool.Exec(ctx, up); err != nil {
+			t.Fatalf("migrate %s: %v", filepath.Base(migration), err)
+		}
+	}
+	return pool
+}
+
+// asSubject authenticates ctx as subject, holding roles.
+func asSubject(ctx context.Context, subject string, roles ...string) context.Context {
+	ctx = context.WithValue(ctx, constant.CONTEXT_KEY_PRINCIPAL, &oidc.IDToken{Subject: subject})
+	return context.WithValue(ctx, constant.CONTEXT_KEY_ROLES, roles)
+}
+
+// testPng encodes a width by height image of noise, which does not
+// compress, so the encoded size follows the dimensions.
+func testPng(t *testing.T, width, height int) []byte {
+	t.Helper()
+	random := rand.New(rand.NewPCG(uint64(width), uint64(height)))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(random.UintN(256)),
+				G: uint8(random.UintN(256)),
+				B: uint8(random.UintN(256)),
+				A: 0xff,
+			})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+	return encoded.Bytes()
+}
+
+// storedObject reads the raw content and metadata stored under key.
+func storedObject(t *testing.T, h handler, key string) ([]byte, map[string]string) {
+	t.Helper()
+	obj, err := h.objects.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	defer obj.Body.Close()
+	content, err := io.ReadAll(obj.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content, obj.Metadata
+}
+
+// storedKeys lists the keys of every stored object under prefix.
+func storedKeys(t *testing.T, h handler, prefix string) []string {
+	t.Helper()
+	listed, err := h.objects.List(context.Background(), prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, len(listed))
+	for i, info := range listed {
+		keys[i] = info.Key
+	}
+	return keys
+}
@@ -3,44 +3,54 @@ package knowyourcustomer
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
-	"time"
+	"slices"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/barasher/go-exiftool"
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/danielgtaylor/huma/v2"
-	vaultApi "github.com/hashicorp/vault/api"
-	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
 	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
 	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
 	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/cryptography"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/extractor"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/keyservice"
 	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/middleware"
-	"github.com/oklog/ulid/v2"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/notifier"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/objectstore"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/scanner"
 	"github.com/rs/zerolog/log"
 )
 
 var pngMagicBytes = []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
 
+// acceptedSignature reports whether content is a PNG, or a PDF for salary
+// slips, which payroll systems usually issue as text PDFs.
+func acceptedSignature(kind string, content []byte) bool {
+	if bytes.HasPrefix(content, pngMagicBytes) {
+		return true
+	}
+	return kind == constant.DOCUMENT_KIND_SALARY_SLIP && extractor.IsPdf(content)
+}
+
 type handler struct {
-	config            config.Config
-	s3client          *s3.Client
-	s3presignedClient *s3.PresignClient
-	exif              *exiftool.Exiftool
-	vault             *vaultApi.Client
-	pool              *pgxpool.Pool
+	config           config.Config
+	objects          objectstore.ObjectStore
+	exif             metadataReader
+	keyservice       keyservice.KeyService
+	fieldCipher      cryptography.FieldCipher
+	scanner          scanner.Scanner
+	extractor        extractor.Extractor
+	notifier         notifier.Notifier
+	pool             *pgxpool.Pool
+	extractionSignal chan struct{}
+	exportSignal     chan struct{}
+	purgeSignal      chan struct{}
 }
 
 func RegisterHandler(
@@ -48,13 +58,33 @@ func RegisterHandler(
 	router huma.API,
 	middleware middleware.Middleware,
 	config config.Config,
-	s3client *s3.Client,
-	s3presignedClient *s3.PresignClient,
+	objects objectstore.ObjectStore,
 	exif *exiftool.Exiftool,
-	vault *vaultApi.Client,
+	keyservice keyservice.KeyService,
+	fieldCipher cryptography.FieldCipher,
+	scanner scanner.Scanner,
+	extractor extractor.Extractor,
+	notifier notifier.Notifier,
 	pool *pgxpool.Pool,
 ) {
-	h := handler{config, s3client, s3presignedClient, exif, vault, pool}
+	h := handler{
+		config,
+		objects,
+		exif,
+		keyservice,
+		fieldCipher,
+		scanner,
+		extractor,
+		notifier,
+		pool,
+		make(chan struct{}, 1),
+		make(chan struct{}, 1),
+		make(chan struct{}, 1),
+	}
+	h.startExtractionWorkers(ctx)
+	h.startPurgeWorker(ctx)
+	h.startExportWorker(ctx)
+	h.startTusSweeper(ctx)
 
 	huma.Register(router, huma.Operation{
 		OperationID: "upload-document",
@@ -63,97 +93,481 @@ func RegisterHandler(
 		Summary:     "Upload KTP & Slip Gaji",
 		Tags:        []string{constant.OAPI_TAG_KYC},
 		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
-		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
+		Parameters:  []*huma.Param{middleware.IdempotencyKeyParam()},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewIdempotency(),
+		},
 	}, h.PostAsset)
 
+	huma.Register(router, huma.Operation{
+		OperationID: "open-upload-session",
+		Method:      http.MethodPost,
+		Path:        "/uploads",
+		Summary:     "Open a direct upload of KTP & Slip Gaji",
+		Description: UploadEnvelopeFormat,
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Parameters:  []*huma.Param{middleware.IdempotencyKeyParam()},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewIdempotency(),
+		},
+	}, h.OpenUploadSession)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "get-upload-session",
+		Method:      http.MethodGet,
+		Path:        "/uploads/{id}",
+		Summary:     "Get a direct upload",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
+	}, h.GetUploadSession)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "finalize-upload-session",
+		Method:      http.MethodPost,
+		Path:        "/uploads/{id}/complete",
+		Summary:     "Register a directly uploaded KTP & Slip Gaji",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Parameters:  []*huma.Param{middleware.IdempotencyKeyParam()},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewIdempotency(),
+		},
+	}, h.FinalizeUploadSession)
+
+	tus := huma.Middlewares{tusProtocol(router), middleware.NewOidcAuthorization(ctx)}
+	huma.Register(router, huma.Operation{
+		OperationID:   "describe-tus",
+		Method:        http.MethodOptions,
+		Path:          "/tus",
+		Summary:       "Describe the supported tus protocol",
+		Tags:          []string{constant.OAPI_TAG_KYC},
+		DefaultStatus: http.StatusNoContent,
+		Middlewares:   huma.Middlewares{tusProtocol(router)},
+	}, h.DescribeTus)
+
+	huma.Register(router, huma.Operation{
+		OperationID:   "create-tus-upload",
+		Method:        http.MethodPost,
+		Path:          "/tus",
+		Summary:       "Start a resumable upload of KTP & Slip Gaji",
+		Description:   "Creation as of tus 1.0. Upload-Metadata carries the filename, kind and consentId of the document.",
+		Tags:          []string{constant.OAPI_TAG_KYC},
+		DefaultStatus: http.StatusCreated,
+		Security:      []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares:   tus,
+	}, h.CreateTusUpload)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "head-tus-upload",
+		Method:      http.MethodHead,
+		Path:        "/tus/{id}",
+		Summary:     "Get the offset of a resumable upload",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: tus,
+	}, h.HeadTusUpload)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "patch-tus-upload",
+		Method:      http.MethodPatch,
+		Path:        "/tus/{id}",
+		Summary:     "Append to a resumable upload",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		RequestBody: &huma.RequestBody{
+			Required: true,
+			Content: map[string]*huma.MediaType{
+				constant.TUS_CONTENT_TYPE: {Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}},
+			},
+		},
+		DefaultStatus: http.StatusNoContent,
+		Security:      []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares:   tus,
+	}, h.PatchTusUpload)
+
+	huma.Register(router, huma.Operation{
+		OperationID:   "terminate-tus-upload",
+		Method:        http.MethodDelete,
+		Path:          "/tus/{id}",
+		Summary:       "Abandon a resumable upload",
+		Tags:          []string{constant.OAPI_TAG_KYC},
+		DefaultStatus: http.StatusNoContent,
+		Security:      []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares:   tus,
+	}, h.TerminateTusUpload)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "list-documents",
+		Method:      http.MethodGet,
+		Path:        "/assets",
+		Summary:     "List KTP & Slip Gaji",
+		Description: "Reviewers may list any subject's documents, everyone else only their own.",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
+	}, h.ListAssets)
+
 	huma.Register(router, huma.Operation{
 		OperationID: "download-document",
 		Method:      http.MethodGet,
-		Path:        "/assets/{filename}",
+		Path:        "/assets/{id}",
 		Summary:     "Download KTP & Slip gaji",
 		Tags:        []string{constant.OAPI_TAG_KYC},
 		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
 		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
 	}, h.DownloadAsset)
 
+	huma.Register(router, huma.Operation{
+		OperationID: "replace-document",
+		Method:      http.MethodPut,
+		Path:        "/assets/{id}",
+		Summary:     "Replace KTP & Slip Gaji with a new version",
+		Description: "The upload becomes the current version of the document. Replaced versions are kept and listed in its history.",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Parameters:  []*huma.Param{middleware.IdempotencyKeyParam()},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewIdempotency(),
+		},
+	}, h.ReplaceAsset)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "list-document-versions",
+		Method:      http.MethodGet,
+		Path:        "/assets/{id}/versions",
+		Summary:     "List the versions of KTP & Slip Gaji",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
+	}, h.ListAssetVersions)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "create-document-link",
+		Method:      http.MethodPost,
+		Path:        "/assets/{id}/links",
+		Summary:     "Create a single-use download link for KTP & Slip Gaji",
+		Description: "The link downloads the document once, without credentials, until it expires.",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
+	}, h.CreateDownloadLink)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "redeem-document-link",
+		Method:      http.MethodGet,
+		Path:        "/links/{token}",
+		Summary:     "Download KTP & Slip Gaji through a download link",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{},
+	}, h.RedeemDownloadLink)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "head-document",
+		Method:      http.MethodHead,
+		Path:        "/assets/{id}",
+		Summary:     "Check KTP & Slip Gaji size and type",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
+	}, h.HeadAsset)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "get-document-metadata",
+		Method:      http.MethodGet,
+		Path:        "/assets/{id}/metadata",
+		Summary:     "Get KTP & Slip Gaji metadata",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
+	}, h.GetAssetMetadata)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "get-document-extraction",
+		Method:      http.MethodGet,
+		Path:        "/assets/{id}/extraction",
+		Summary:     "Get fields extracted from KTP & Slip Gaji",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Reviewer),
+		},
+	}, h.GetAssetExtraction)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "override-document-extraction",
+		Method:      http.MethodPatch,
+		Path:        "/assets/{id}/extraction",
+		Summary:     "Correct fields extracted from KTP & Slip Gaji",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Reviewer),
+		},
+	}, h.OverrideAssetExtraction)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "lookup-subjects",
+		Method:      http.MethodPost,
+		Path:        "/subjects/lookup",
+		Summary:     "Find customers by NIK or name",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Reviewer),
+		},
+	}, h.LookupSubjects)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "get-my-case",
+		Method:      http.MethodGet,
+		Path:        "/cases/me",
+		Summary:     "Get my verification case",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
+	}, h.GetMyCase)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "put-my-case-documents",
+		Method:      http.MethodPut,
+		Path:        "/cases/me/documents",
+		Summary:     "Link documents to my verification case",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Parameters:  []*huma.Param{middleware.IdempotencyKeyParam()},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewIdempotency(),
+		},
+	}, h.PutMyCaseDocuments)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "submit-my-case",
+		Method:      http.MethodPost,
+		Path:        "/cases/me/submit",
+		Summary:     "Submit my verification case for review",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Parameters:  []*huma.Param{middleware.IdempotencyKeyParam()},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewIdempotency(),
+		},
+	}, h.SubmitMyCase)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "list-cases",
+		Method:      http.MethodGet,
+		Path:        "/cases",
+		Summary:     "List verification cases",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Reviewer),
+		},
+	}, h.ListCases)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "get-case",
+		Method:      http.MethodGet,
+		Path:        "/cases/{id}",
+		Summary:     "Get a verification case",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
+	}, h.GetCase)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "claim-case",
+		Method:      http.MethodPost,
+		Path:        "/cases/{id}/claim",
+		Summary:     "Claim a submitted verification case",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Reviewer),
+		},
+	}, h.ClaimCase)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "decide-case",
+		Method:      http.MethodPost,
+		Path:        "/cases/{id}/decision",
+		Summary:     "Decide a claimed verification case",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Parameters:  []*huma.Param{middleware.IdempotencyKeyParam()},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Reviewer),
+			middleware.NewIdempotency(),
+		},
+	}, h.DecideCase)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "claim-next-case",
+		Method:      http.MethodPost,
+		Path:        "/cases/queue/claim",
+		Summary:     "Claim the longest waiting verification case",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Reviewer),
+		},
+	}, h.ClaimNextCase)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "get-queue-stats",
+		Method:      http.MethodGet,
+		Path:        "/cases/queue/stats",
+		Summary:     "Get review queue statistics",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Reviewer),
+		},
+	}, h.GetQueueStats)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "renew-case-lease",
+		Method:      http.MethodPost,
+		Path:        "/cases/{id}/lease",
+		Summary:     "Renew the lease on a claimed verification case",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Reviewer),
+		},
+	}, h.RenewCaseLease)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "release-case",
+		Method:      http.MethodPost,
+		Path:        "/cases/{id}/release",
+		Summary:     "Return a claimed verification case to the queue",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewRoleAuthorization(config.Roles.Reviewer),
+		},
+	}, h.ReleaseCase)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "grant-consent",
+		Method:      http.MethodPost,
+		Path:        "/consents",
+		Summary:     "Consent to the processing of my documents under the current privacy notice",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Parameters:  []*huma.Param{middleware.IdempotencyKeyParam()},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewIdempotency(),
+		},
+	}, h.GrantConsent)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "list-my-consents",
+		Method:      http.MethodGet,
+		Path:        "/consents",
+		Summary:     "List my consents",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
+	}, h.ListMyConsents)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "withdraw-consent",
+		Method:      http.MethodPost,
+		Path:        "/consents/{id}/withdraw",
+		Summary:     "Withdraw one of my consents",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Parameters:  []*huma.Param{middleware.IdempotencyKeyParam()},
+		Middlewares: huma.Middlewares{
+			middleware.NewOidcAuthorization(ctx),
+			middleware.NewIdempotency(),
+		},
+	}, h.WithdrawConsent)
+
+	huma.Register(router, huma.Operation{
+		OperationID:   "request-my-export",
+		Method:        http.MethodPost,
+		Path:          "/me/export",
+		Summary:       "Request an export of everything held about me",
+		Description:   "The archive is a ZIP encrypted with WinZip AES, under the given password or a generated one encrypted to the given public key.",
+		Tags:          []string{constant.OAPI_TAG_KYC},
+		DefaultStatus: http.StatusAccepted,
+		Security:      []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Parameters:    []*huma.Param{middleware.IdempotencyKeyParam()},
+		Middlewares:   huma.Middlewares{middleware.NewOidcAuthorization(ctx), middleware.NewIdempotency()},
+	}, h.RequestMyExport)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "get-my-export",
+		Method:      http.MethodGet,
+		Path:        "/me/export",
+		Summary:     "Get the status of my latest export",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
+	}, h.GetMyExport)
+
+	huma.Register(router, huma.Operation{
+		OperationID: "download-my-export",
+		Method:      http.MethodGet,
+		Path:        "/me/export/{id}/archive",
+		Summary:     "Download the encrypted archive of my export",
+		Tags:        []string{constant.OAPI_TAG_KYC},
+		Security:    []map[string][]string{{constant.OAPI_SECURITY_SCHEME: {}}},
+		Middlewares: huma.Middlewares{middleware.NewOidcAuthorization(ctx)},
+	}, h.DownloadMyExport)
+
 }
 
 func (h handler) PostAsset(ctx context.Context, req *struct {
 	RawBody multipart.Form
-}) (*struct {
+}) (_ *struct {
 	Body []string
-}, error) {
+}, err error) {
+	// successful uploads are audited per document along with their rows
+	defer func() {
+		if err != nil {
+			err = audit.RecordAccess(ctx, h.pool, &audit.Event{Action: constant.AUDIT_ACTION_DOCUMENT_UPLOAD}, err)
+		}
+	}()
+
 	attachments, ok := req.RawBody.File[constant.MULTIPART_KEY_ATTACHMENTS]
 	if !ok {
 		return nil, errors.New("missing attachments in multipart")
 	}
-
-	path := fmt.Sprintf(
-		"%s/encrypt/%s",
-		h.config.Vault.TransitBasePath,
-		h.config.Vault.TransitKey,
-	)
-
-	keys := make([]SecretKey, len(attachments))
-	inputs := make([]TransitEncryptRequest, len(keys))
-	for i := range keys {
-		key := make([]byte, 32)
-		if _, err := io.ReadFull(rand.Reader, key); err != nil {
-			return nil, err
-		}
-		keyEncoded := base64.StdEncoding.EncodeToString(key)
-
-		hf := sha256.New()
-		if _, err := hf.Write(key); err != nil {
-			return nil, err
-		}
-		digest := hf.Sum(nil)
-		digestEncoded := base64.StdEncoding.EncodeToString(digest)
-
-		keys[i] = SecretKey{
-			Data:          key,
-			Encoded:       keyEncoded,
-			DigestEncoded: digestEncoded,
-		}
-		inputs[i] = TransitEncryptRequest{Plaintext: keyEncoded}
-	}
-
-	secret, err := h.vault.Logical().WriteWithRequest(ctx,
-		vaultApi.NewLogicalWriteRequest(
-			path,
-			map[string]interface{}{"batch_input": inputs},
-			make(http.Header),
-		),
-	)
+	kinds, err := attachmentKinds(req.RawBody.Value[constant.MULTIPART_KEY_KINDS], len(attachments))
 	if err != nil {
 		return nil, err
 	}
-	resultsUntyped, ok := secret.Data["batch_results"]
-	if !ok {
-		return nil, errors.New("vault transit secrets engine missing batch_results response field")
-	}
-	results, ok := resultsUntyped.([]interface{})
-	if !ok {
-		return nil, errors.New("body.batch_results is not the correct type")
+	var consentId string
+	if values := req.RawBody.Value[constant.MULTIPART_KEY_CONSENT]; len(values) > 0 {
+		consentId = values[0]
 	}
-	for i := range results {
-		resultUntyped, ok := results[i].(map[string]interface{})
-		if !ok {
-			continue
-		}
-		untyped, ok := resultUntyped["ciphertext"]
-		if !ok {
-			continue
-		}
-		ciphertext, ok := untyped.(string)
-		if !ok {
-			continue
-		}
-		keys[i].CiphertextEncoded = ciphertext
+	if err := h.precheckConsent(ctx, consentId); err != nil {
+		return nil, err
 	}
 
-	filenames := make([]string, len(attachments))
-	files := make([]File, len(attachments))
+	uploads := make([]upload, len(attachments))
 	for i, header := range attachments {
 		_file, err := header.Open()
 		if err != nil {
@@ -162,150 +576,106 @@ func (h handler) PostAsset(ctx context.Context, req *struct {
 		defer _file.Close()
 
 		body := new(bytes.Buffer)
-		written, err := io.Copy(body, _file)
-		if err != nil {
+		if _, err := io.Copy(body, _file); err != nil {
 			return nil, err
 		}
 		if err := _file.Close(); err != nil {
 			log.Warn().Err(err).Msg("failed to close file")
 		}
-
-		if written < 8 {
-			return nil, errors.New("invalid file")
-		}
-		if !bytes.Equal(body.Bytes()[:8], pngMagicBytes) {
-			return nil, errors.New("invalid file bytes signature")
-		}
-
-		ciphertext, err := cryptography.EncryptAesGcm(keys[i].Data, body.Bytes())
-		if err != nil {
-			return nil, err
-		}
-
-		f := bytes.NewReader(ciphertext)
-
-		_, err = h.s3client.PutObject(ctx, &s3.PutObjectInput{
-			Key:    aws.String(header.Filename),
-			Body:   f,
-			Bucket: aws.String(h.config.S3.DefaultBucket),
-			Metadata: map[string]string{
-				constant.EDEK_HEADER: keys[i].CiphertextEncoded,
-				constant.DEK_DIGEST:  keys[i].DigestEncoded},
-		})
-		if err != nil {
-			return nil, err
-		}
-
-		filenames[i] = header.Filename
-
-		tmpFilename := fmt.Sprintf("modalrakyat-%s", header.Filename)
-		tmpFilepath := filepath.Join(os.TempDir(), tmpFilename)
-		if err := os.WriteFile(tmpFilepath, body.Bytes(), 0644); err != nil {
-			return nil, err
-		}
-		defer os.Remove(tmpFilepath)
-
-		exif := h.exif.ExtractMetadata(tmpFilepath)
-		os.Remove(tmpFilepath)
-
-		if len(exif) < 1 {
-			return nil, errors.New("empty exif metadata")
-		}
-		jsonMetas, err := json.Marshal(exif[0].Fields)
-		if err != nil {
-			return nil, err
-		}
-
-		files[i] = File{
-			Filename: header.Filename,
-			Metadata: jsonMetas,
-		}
+		uploads[i] = upload{Filename: header.Filename, Kind: kinds[i], Content: body.Bytes()}
 	}
 
-	principalToken, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
-	if !ok {
-		log.Warn().Msg("missing principal token in context, skipping db insertion")
-		return &struct{ Body []string }{Body: filenames}, nil
+	files, err := h.ingest(ctx, uploads, consentId)
+	if err != nil {
+		return nil, err
+	}
+	if err := quarantineError(files); err != nil {
+		return nil, err
 	}
 
-	rows := make([][]interface{}, len(files))
+	filenames := make([]string, len(files))
 	for i, file := range files {
-		row := rows[i]
-		row = append(row, ulid.Make().String())
-		row = append(row, file.Filename)
-		row = append(row, file.Metadata)
-		row = append(row, principalToken.Subject)
-		row = append(row, time.Now())
-		rows[i] = row
+		filenames[i] = file.Filename
 	}
+	return &struct{ Body []string }{Body: filenames}, nil
+}
 
-	if _, err := h.pool.CopyFrom(
-		ctx,
-		pgx.Identifier{constant.TABLE_DOCUMENTS},
-		[]string{"id", "filename", "metadata", "created_by", "created_at"},
-		pgx.CopyFromRows(rows),
-	); err != nil {
-		return nil, err
+// attachmentKinds pairs every attachment with its declared kind, in order.
+// Uploads without any kind field keep the unknown kind for compatibility.
+func attachmentKinds(values []string, attachments int) ([]string, error) {
+	kinds := make([]string, attachments)
+	if len(values) == 0 {
+		for i := range kinds {
+			kinds[i] = constant.DOCUMENT_KIND_UNKNOWN
+		}
+		return kinds, nil
 	}
-
-	return &struct{ Body []string }{Body: filenames}, nil
+	if len(values) != attachments {
+		return nil, huma.Error400BadRequest(fmt.Sprintf(
+			"expected %d %s values, one per attachment, got %d",
+			attachments,
+			constant.MULTIPART_KEY_KINDS,
+			len(values),
+		))
+	}
+	for i, kind := range values {
+		if !slices.Contains(constant.DOCUMENT_KINDS, kind) {
+			return nil, huma.Error400BadRequest(fmt.Sprintf("unknown document kind %q", kind))
+		}
+		kinds[i] = kind
+	}
+	return kinds, nil
 }
 
 func (h handler) DownloadAsset(ctx context.Context, request *struct {
-	Filename string `path:"filename"`
-}) (*struct {
+	Id      string `path:"id" doc:"Document id, or the filename of its latest upload"`
+	Variant string `query:"variant" enum:"original,normalised,preview" default:"original" doc:"Rendition of the document to download"`
+	AccessJustification
+}) (_ *struct {
 	Body []byte
-}, error) {
-	obj, err := h.s3client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(h.config.S3.DefaultBucket),
-		Key:    aws.String(request.Filename),
-	})
-	if err != nil {
-		return nil, err
-	}
-	edek, ok := obj.Metadata[constant.EDEK_HEADER]
-	if !ok {
-		return nil, errors.New("missing stored edek in object metadata")
+}, err error) {
+	event := &audit.Event{
+		Action: constant.AUDIT_ACTION_DOCUMENT_DOWNLOAD,
+		Detail: map[string]any{"reference": request.Id, "variant": request.Variant},
 	}
+	defer func() { err = audit.RecordAccess(ctx, h.pool, event, err) }()
 
-	path := fmt.Sprintf(
-		"%s/decrypt/%s",
-		h.config.Vault.TransitBasePath,
-		h.config.Vault.TransitKey,
-	)
-	secret, err := h.vault.Logical().WriteWithRequest(ctx,
-		vaultApi.NewLogicalWriteRequest(
-			path,
-			map[string]interface{}{"ciphertext": edek},
-			make(http.Header),
-		))
+	document, err := h.findDocument(ctx, request.Id)
 	if err != nil {
 		return nil, err
 	}
-	untyped, ok := secret.Data["plaintext"]
-	if !ok {
-		return nil, errors.New("missing plaintext response from vault")
+	event.DocumentId = document.Id
+	if err := h.authorizeOwnerOrReviewer(ctx, document); err != nil {
+		return nil, err
 	}
-	dekEncoded, ok := untyped.(string)
-	if !ok {
-		return nil, errors.New("stored dek is not a valid string type")
+	if err := h.justifyAccess(ctx, document.CreatedBy, request.AccessJustification, event); err != nil {
+		return nil, err
+	}
+	if document.ScanStatus == constant.SCAN_STATUS_INFECTED {
+		return nil, huma.Error403Forbidden(fmt.Sprintf("document %s is quarantined", request.Id))
 	}
-	dek, err := base64.StdEncoding.DecodeString(dekEncoded)
+	objectKey, err := h.findVariantKey(ctx, document, request.Variant)
 	if err != nil {
 		return nil, err
 	}
 
-	buf := new(bytes.Buffer)
-	if _, err := io.Copy(buf, obj.Body); err != nil {
+	plaintext, err := h.getDecrypted(ctx, objectKey)
+	if err != nil {
 		return nil, err
 	}
-	defer obj.Body.Close()
 
-	plaintext, err := cryptography.DecryptAesGcm(dek, buf.Bytes())
-	if err != nil {
-		return nil, err
+	if h.mustWatermark(ctx) {
+		principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+		if !ok {
+			return nil, errors.New("missing principal token in context")
+		}
+		var watermarkId string
+		plaintext, watermarkId, err = h.watermarkCopy(ctx, document.Id, request.Variant, principal.Subject, request.Purpose, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		event.Detail["watermarkId"] = watermarkId
 	}
 
 	return &struct{ Body []byte }{Body: plaintext}, nil
-
 }
@@ -0,0 +1,157 @@
+package knowyourcustomer
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/imaging"
+	"github.com/oklog/ulid/v2"
+)
+
+func requestDownload(h handler, ctx context.Context, ref, variant string, justification AccessJustification) ([]byte, error) {
+	downloaded, err := h.DownloadAsset(ctx, &struct {
+		Id      string `path:"id" doc:"Document id, or the filename of its latest upload"`
+		Variant string `query:"variant" enum:"original,normalised,preview" default:"original" doc:"Rendition of the document to download"`
+		AccessJustification
+	}{Id: ref, Variant: variant, AccessJustification: justification})
+	if err != nil {
+		return nil, err
+	}
+	return downloaded.Body, nil
+}
+
+func downloadAsset(t *testing.T, h handler, ctx context.Context, ref string) []byte {
+	t.Helper()
+	downloaded, err := requestDownload(h, ctx, ref, constant.VARIANT_ORIGINAL, AccessJustification{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return downloaded
+}
+
+// newDocumentHandler builds a handler keeping documents in memory and their
+// rows in the test database, with reviewers needing a purpose.
+func newDocumentHandler(t *testing.T) handler {
+	t.Helper()
+	h := newTestHandler(t, config.Config{
+		Roles:    config.Roles{Reviewer: "reviewer"},
+		Variants: config.Variants{Enabled: true, MaxDimension: 48, PreviewDimension: 24},
+		Access:   config.Access{Purposes: []string{"kyc-review"}},
+	})
+	h.pool = testDatabase(t)
+	return h
+}
+
+func TestDownloadAsset(t *testing.T) {
+	h := newDocumentHandler(t)
+	ctx := asSubject(context.Background(), "subject-a")
+	content := testPng(t, 64, 40)
+	files, err := h.ingest(ctx, []upload{{Filename: "ktp.png", Kind: constant.DOCUMENT_KIND_KTP, Content: content}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if downloaded := downloadAsset(t, h, ctx, files[0].Id); !bytes.Equal(downloaded, content) {
+		t.Fatal("document does not download as uploaded")
+	}
+	// the filename finds the caller's latest upload
+	if downloaded := downloadAsset(t, h, ctx, "ktp.png"); !bytes.Equal(downloaded, content) {
+		t.Fatal("document does not download by filename")
+	}
+	preview, err := requestDownload(h, ctx, files[0].Id, constant.VARIANT_PREVIEW, AccessJustification{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(preview, pngMagicBytes) || bytes.Equal(preview, content) {
+		t.Fatal("preview does not download as its rendition")
+	}
+}
+
+func TestDownloadAssetOfAnotherSubject(t *testing.T) {
+	h := newDocumentHandler(t)
+	files, err := h.ingest(asSubject(context.Background(), "subject-a"), []upload{{
+		Filename: "ktp.png",
+		Kind:     constant.DOCUMENT_KIND_KTP,
+		Content:  testPng(t, 64, 40),
+	}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	review := AccessJustification{Purpose: "kyc-review"}
+
+	// a purpose grants no access by itself
+	other := asSubject(context.Background(), "subject-b")
+	_, err = requestDownload(h, other, files[0].Id, constant.VARIANT_ORIGINAL, review)
+	requireStatus(t, err, http.StatusNotFound)
+	_, err = requestDownload(h, other, "ktp.png", constant.VARIANT_ORIGINAL, review)
+	requireStatus(t, err, http.StatusNotFound)
+
+	reviewer := asSubject(context.Background(), "subject-r", "reviewer")
+	_, err = requestDownload(h, reviewer, files[0].Id, constant.VARIANT_ORIGINAL, AccessJustification{})
+	requireStatus(t, err, http.StatusForbidden)
+	if _, err := requestDownload(h, reviewer, files[0].Id, constant.VARIANT_ORIGINAL, review); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadQuarantinedAsset(t *testing.T) {
+	h := newDocumentHandler(t)
+	h.scanner = flagAll{}
+	ctx := asSubject(context.Background(), "subject-a")
+	files, err := h.ingest(ctx, []upload{{Filename: "ktp.png", Kind: constant.DOCUMENT_KIND_KTP, Content: testPng(t, 64, 40)}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = requestDownload(h, ctx, files[0].Id, constant.VARIANT_ORIGINAL, AccessJustification{})
+	requireStatus(t, err, http.StatusForbidden)
+}
+
+func TestDownloadAssetRecordsWatermark(t *testing.T) {
+	h := newDocumentHandler(t)
+	h.config.Watermark = config.Watermark{Roles: []string{"reviewer"}, Invisible: true}
+	files, err := h.ingest(asSubject(context.Background(), "subject-a"), []upload{{
+		Filename: "ktp.png",
+		Kind:     constant.DOCUMENT_KIND_KTP,
+		Content:  testPng(t, 64, 40),
+	}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reviewer := asSubject(context.Background(), "subject-r", "reviewer")
+	downloaded, err := requestDownload(h, reviewer, files[0].Id, constant.VARIANT_ORIGINAL, AccessJustification{Purpose: "kyc-review"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := imaging.Decode(downloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := imaging.ExtractIdentifier(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id ulid.ULID
+	copy(id[:], payload)
+
+	// the download's audit event names the watermark the copy carries
+	var watermarkId string
+	if err := h.pool.QueryRow(reviewer, `
+		SELECT w.id
+		FROM audit_events e
+		JOIN document_watermarks w ON w.id = e.detail::jsonb->>'watermarkId'
+		WHERE e.action = $1 AND e.document_id = $2`,
+		constant.AUDIT_ACTION_DOCUMENT_DOWNLOAD,
+		files[0].Id,
+	).Scan(&watermarkId); err != nil {
+		t.Fatal(err)
+	}
+	if watermarkId != id.String() {
+		t.Fatalf("download recorded watermark %s, the copy carries %s", watermarkId, id)
+	}
+}
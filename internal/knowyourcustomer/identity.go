@@ -0,0 +1,209 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/extractor"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/nik"
+	"github.com/oklog/ulid/v2"
+)
+
+// profileClaims are the standard OIDC profile claims compared against the
+// identity printed on the KTP. Each is optional.
+type profileClaims struct {
+	Name       string `json:"name"`
+	GivenName  string `json:"given_name"`
+	FamilyName string `json:"family_name"`
+	Birthdate  string `json:"birthdate"`
+	Gender     string `json:"gender"`
+}
+
+func (c profileClaims) fullName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return strings.TrimSpace(c.GivenName + " " + c.FamilyName)
+}
+
+// caseFlags collects the discrepancies found on a case. Details never carry
+// the compared values themselves, reviewers read those from the extraction.
+type caseFlags struct {
+	caseId string
+	source string
+	rows   [][]any
+}
+
+func (f *caseFlags) add(documentId, code string, detail map[string]any) {
+	if detail == nil {
+		detail = map[string]any{}
+	}
+	encoded, _ := json.Marshal(detail)
+	f.rows = append(f.rows, []any{
+		ulid.Make().String(),
+		f.caseId,
+		nullableString(documentId),
+		f.source,
+		code,
+		encoded,
+		time.Now(),
+	})
+}
+
+// save replaces the flags previously raised by the same source.
+func (f *caseFlags) save(ctx context.Context, tx pgx.Tx) error {
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM kyc_case_flags
+		WHERE case_id = $1 AND source = $2`,
+		f.caseId,
+		f.source,
+	); err != nil {
+		return err
+	}
+	_, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{constant.TABLE_KYC_CASE_FLAGS},
+		[]string{"id", "case_id", "document_id", "source", "code", "detail", "created_at"},
+		pgx.CopyFromRows(f.rows),
+	)
+	return err
+}
+
+func caseFlagList(ctx context.Context, q querier, caseId string) ([]CaseFlag, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, document_id, source, code, detail, created_at
+		FROM kyc_case_flags
+		WHERE case_id = $1
+		ORDER BY id`,
+		caseId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (CaseFlag, error) {
+		var f CaseFlag
+		err := row.Scan(&f.Id, &f.DocumentId, &f.Source, &f.Code, &f.Detail, &f.CreatedAt)
+		return f, err
+	})
+}
+
+// checkIdentity validates the NIK of every KTP on the case and cross-checks
+// what it encodes against the printed fields and the caller's OIDC profile.
+// It runs on submission, the only moment the subject's token is at hand.
+func (h handler) checkIdentity(ctx context.Context, tx pgx.Tx, c Case, principal *oidc.IDToken) error {
+	var claims profileClaims
+	if err := principal.Claims(&claims); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT d.id
+		FROM kyc_case_documents cd
+		JOIN documents d ON d.id = cd.document_id
+		WHERE cd.case_id = $1 AND d.kind = $2
+		ORDER BY d.id`,
+		c.Id,
+		constant.DOCUMENT_KIND_KTP,
+	)
+	if err != nil {
+		return err
+	}
+	documentIds, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	flags := &caseFlags{caseId: c.Id, source: constant.CASE_FLAG_SOURCE_IDENTITY}
+	seen := ""
+	for _, documentId := range documentIds {
+		extraction, err := h.loadExtraction(ctx, documentId)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if err != nil || extraction.Status != constant.EXTRACTION_STATUS_COMPLETED {
+			flags.add(documentId, constant.CASE_FLAG_EXTRACTION_INCOMPLETE, nil)
+			continue
+		}
+		fields := extraction.Fields
+
+		raw, ok := fields[extractor.KTP_FIELD_NIK]
+		if !ok {
+			flags.add(documentId, constant.CASE_FLAG_NIK_UNREADABLE, nil)
+			continue
+		}
+		decoded, err := nik.Parse(raw.Value, time.Now())
+		if err != nil {
+			flags.add(documentId, constant.CASE_FLAG_NIK_INVALID, map[string]any{"reason": err.Error()})
+			continue
+		}
+		if seen != "" && seen != decoded.Raw {
+			flags.add(documentId, constant.CASE_FLAG_NIK_CONFLICT, nil)
+		}
+		seen = decoded.Raw
+
+		birthDate := decoded.BirthDate.Format(time.DateOnly)
+		if printed, ok := fields[extractor.KTP_FIELD_BIRTH_DATE]; ok && printed.Value != birthDate {
+			flags.add(documentId, constant.CASE_FLAG_BIRTH_DATE_MISMATCH, map[string]any{"against": "ktp"})
+		}
+		if claims.Birthdate != "" && claims.Birthdate != birthDate {
+			flags.add(documentId, constant.CASE_FLAG_BIRTH_DATE_MISMATCH, map[string]any{"against": "profile"})
+		}
+
+		gender := "male"
+		if decoded.Female {
+			gender = "female"
+		}
+		if printed, ok := fields[extractor.KTP_FIELD_GENDER]; ok && printed.Value != gender {
+			flags.add(documentId, constant.CASE_FLAG_GENDER_MISMATCH, map[string]any{"against": "ktp"})
+		}
+		if claimed := strings.ToLower(claims.Gender); (claimed == "male" || claimed == "female") && claimed != gender {
+			flags.add(documentId, constant.CASE_FLAG_GENDER_MISMATCH, map[string]any{"against": "profile"})
+		}
+
+		printed, ok := fields[extractor.KTP_FIELD_NAME]
+		if profile := claims.fullName(); ok && profile != "" && !namesMatch(printed.Value, profile) {
+			flags.add(documentId, constant.CASE_FLAG_NAME_MISMATCH, map[string]any{
+				"against":       "profile",
+				"ocrConfidence": printed.Confidence,
+			})
+		}
+	}
+
+	return flags.save(ctx, tx)
+}
+
+// namesMatch reports whether every word of the shorter name occurs in the
+// longer one, so that a profile carrying only part of the name on the KTP
+// still matches.
+func namesMatch(a, b string) bool {
+	wordsA, wordsB := nameWords(a), nameWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return false
+	}
+	if len(wordsA) > len(wordsB) {
+		wordsA, wordsB = wordsB, wordsA
+	}
+	set := make(map[string]bool, len(wordsB))
+	for _, word := range wordsB {
+		set[word] = true
+	}
+	for _, word := range wordsA {
+		if !set[word] {
+			return false
+		}
+	}
+	return true
+}
+
+func nameWords(name string) []string {
+	return strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
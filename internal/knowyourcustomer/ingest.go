@@ -0,0 +1,406 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/extractor"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/keyservice"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// upload is a received document on its way into storage. Staged uploads
+// were already stored encrypted by the client, under Key, and are copied into
+// place rather than encrypted again. Uploads replacing a document become its
+// next version.
+type upload struct {
+	Filename string
+	Kind     string
+	Content  []byte
+	Staged   string
+	Key      *keyservice.SecretKey
+	Replaces *DocumentRecord
+}
+
+// ingest checks, scans, stores and registers uploads, along with their
+// renditions, extraction jobs and fingerprints. Quarantined uploads are
+// stored and registered too, quarantineError tells the client about them.
+// Objects stored for uploads that end up unregistered are removed again.
+func (h handler) ingest(ctx context.Context, uploads []upload, consentId string) (_ []File, err error) {
+	stored := make([]string, 0)
+	defer func() {
+		if err != nil {
+			h.removeObjects(context.WithoutCancel(ctx), stored)
+		}
+	}()
+
+	keysPerFile := 1
+	if h.config.Variants.Enabled {
+		keysPerFile += len(renditionVariants)
+	}
+	keys, err := h.keyservice.GenerateDataKeys(ctx, len(uploads)*keysPerFile)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]File, len(uploads))
+	for i, upload := range uploads {
+		if len(upload.Content) < 8 {
+			return nil, errors.New("invalid file")
+		}
+		if !acceptedSignature(upload.Kind, upload.Content) {
+			return nil, errors.New("invalid file bytes signature")
+		}
+
+		verdict, err := h.scan(ctx, upload.Content)
+		if err != nil {
+			return nil, err
+		}
+		key := keys[i*keysPerFile]
+		if upload.Key != nil {
+			key = *upload.Key
+		}
+		id := ulid.Make().String()
+		objectKey := documentObjectKey(id, upload.Filename)
+
+		if verdict.Status == constant.SCAN_STATUS_INFECTED {
+			if err := h.storeUpload(ctx, upload, quarantineObjectKey(objectKey), key, map[string]string{
+				constant.SOURCE_KEY: upload.Filename,
+			}); err != nil {
+				return nil, err
+			}
+			stored = append(stored, quarantineObjectKey(objectKey))
+			log.Warn().
+				Str("filename", upload.Filename).
+				Str("signature", verdict.Signature).
+				Msg("scanner: quarantined flagged upload")
+			files[i] = File{
+				Id:        id,
+				Filename:  upload.Filename,
+				Kind:      upload.Kind,
+				ObjectKey: quarantineObjectKey(objectKey),
+				LineageId: id,
+				Version:   1,
+				IsCurrent: true,
+				Metadata:  json.RawMessage("{}"),
+				Scan:      verdict,
+			}
+			continue
+		}
+
+		if err := h.storeUpload(ctx, upload, objectKey, key, nil); err != nil {
+			return nil, err
+		}
+		stored = append(stored, objectKey)
+
+		tmpFilename := fmt.Sprintf("modalrakyat-%s", upload.Filename)
+		tmpFilepath := filepath.Join(os.TempDir(), tmpFilename)
+		if err := os.WriteFile(tmpFilepath, upload.Content, 0644); err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmpFilepath)
+
+		exif := h.exif.ExtractMetadata(tmpFilepath)
+		os.Remove(tmpFilepath)
+
+		if len(exif) < 1 {
+			return nil, errors.New("empty exif metadata")
+		}
+		jsonMetas, err := json.Marshal(exif[0].Fields)
+		if err != nil {
+			return nil, err
+		}
+
+		files[i] = File{
+			Id:        id,
+			Filename:  upload.Filename,
+			Kind:      upload.Kind,
+			ObjectKey: objectKey,
+			LineageId: id,
+			Version:   1,
+			IsCurrent: true,
+			Metadata:  jsonMetas,
+			Scan:      verdict,
+		}
+		if h.config.Duplicates.Enabled {
+			files[i].Fingerprint, err = h.fingerprint(ctx, upload.Content, exif[0].Fields)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// variants are image renditions, PDFs are kept as uploaded
+		if !h.config.Variants.Enabled || extractor.IsPdf(upload.Content) {
+			continue
+		}
+		renditions, err := h.renderVariants(upload.Content, exif[0].Fields)
+		if err != nil {
+			return nil, err
+		}
+		for j, rendition := range renditions {
+			variantKey := variantObjectKey(rendition.Variant, objectKey)
+			if err := h.putEncrypted(ctx, variantKey, rendition.Content, keys[i*keysPerFile+1+j], map[string]string{
+				constant.SOURCE_KEY: upload.Filename,
+				constant.VARIANT:    rendition.Variant,
+			}); err != nil {
+				return nil, err
+			}
+			stored = append(stored, variantKey)
+			files[i].Variants = append(files[i].Variants, Variant{
+				Id:        ulid.Make().String(),
+				Variant:   rendition.Variant,
+				ObjectKey: variantKey,
+			})
+		}
+	}
+
+	principalToken, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		log.Warn().Msg("missing principal token in context, skipping db insertion")
+		return files, nil
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if consentId != "" {
+		if err := h.checkConsent(ctx, tx, consentId, principalToken.Subject); err != nil {
+			return nil, err
+		}
+	}
+	for i, upload := range uploads {
+		if upload.Replaces != nil {
+			if err := h.supersede(ctx, tx, &files[i], *upload.Replaces); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	now := time.Now()
+	rows := make([][]interface{}, len(files))
+	variantRows := make([][]interface{}, 0)
+	extractionRows := make([][]interface{}, 0)
+	fingerprintRows := make([][]interface{}, 0)
+	for i, file := range files {
+		row := rows[i]
+		row = append(row, file.Id)
+		row = append(row, file.Filename)
+		row = append(row, file.Metadata)
+		row = append(row, principalToken.Subject)
+		row = append(row, now)
+		row = append(row, file.Scan.Status)
+		row = append(row, nullableString(file.Scan.Signature))
+		row = append(row, nullableTime(file.Scan.ScannedAt))
+		row = append(row, file.Kind)
+		row = append(row, h.retentionUntil(file.Kind, now))
+		row = append(row, nullableString(consentId))
+		row = append(row, file.ObjectKey)
+		row = append(row, file.LineageId)
+		row = append(row, file.PreviousId)
+		row = append(row, file.Version)
+		row = append(row, file.IsCurrent)
+		rows[i] = row
+
+		if file.Fingerprint != nil {
+			fingerprintRows = append(fingerprintRows, file.Fingerprint.row(file.Id, principalToken.Subject, now))
+		}
+		if h.shouldExtract(file) {
+			extractionRows = append(extractionRows, []interface{}{
+				file.Id,
+				constant.EXTRACTION_STATUS_PENDING,
+				now,
+			})
+		}
+
+		for _, variant := range file.Variants {
+			variantRows = append(variantRows, []interface{}{
+				variant.Id,
+				file.Id,
+				variant.Variant,
+				variant.ObjectKey,
+				now,
+			})
+		}
+	}
+
+	if _, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{constant.TABLE_DOCUMENTS},
+		[]string{
+			"id",
+			"filename",
+			"metadata",
+			"created_by",
+			"created_at",
+			"scan_status",
+			"scan_signature",
+			"scanned_at",
+			"kind",
+			"retention_until",
+			"consent_id",
+			"object_key",
+			"lineage_id",
+			"previous_id",
+			"version",
+			"is_current",
+		},
+		pgx.CopyFromRows(rows),
+	); err != nil {
+		return nil, err
+	}
+	if _, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{constant.TABLE_DOCUMENT_VARIANTS},
+		[]string{"id", "document_id", "variant", "object_key", "created_at"},
+		pgx.CopyFromRows(variantRows),
+	); err != nil {
+		return nil, err
+	}
+	if _, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{constant.TABLE_DOCUMENT_EXTRACTIONS},
+		[]string{"document_id", "status", "created_at"},
+		pgx.CopyFromRows(extractionRows),
+	); err != nil {
+		return nil, err
+	}
+	if _, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{constant.TABLE_DOCUMENT_FINGERPRINTS},
+		[]string{"document_id", "created_by", "content_hmac", "phash", "dhash", "phash_bands", "created_at"},
+		pgx.CopyFromRows(fingerprintRows),
+	); err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		event := audit.Event{
+			Action:     constant.AUDIT_ACTION_DOCUMENT_UPLOAD,
+			DocumentId: file.Id,
+			Outcome:    constant.AUDIT_OUTCOME_SUCCESS,
+			Detail:     map[string]any{"kind": file.Kind, "scanStatus": file.Scan.Status},
+		}
+		if file.PreviousId != nil {
+			event.Action = constant.AUDIT_ACTION_DOCUMENT_REPLACE
+			event.Detail["previousId"] = *file.PreviousId
+			event.Detail["version"] = file.Version
+		}
+		if err := audit.Append(ctx, tx, event); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	if len(extractionRows) > 0 {
+		h.notifyExtraction()
+	}
+
+	return files, nil
+}
+
+// supersede makes file the next version of previous, which it replaces as
+// the current one unless it was flagged by the content scanner.
+func (h handler) supersede(ctx context.Context, tx pgx.Tx, file *File, previous DocumentRecord) error {
+	var current bool
+	err := tx.QueryRow(ctx, `
+		SELECT is_current
+		FROM documents
+		WHERE id = $1 AND purged_at IS NULL
+		FOR UPDATE`,
+		previous.Id,
+	).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return huma.Error404NotFound(fmt.Sprintf("no document %s", previous.Id))
+	}
+	if err != nil {
+		return err
+	}
+	if !current {
+		return huma.Error409Conflict(fmt.Sprintf("document %s was already replaced", previous.Id))
+	}
+
+	file.LineageId = previous.LineageId
+	file.PreviousId = &previous.Id
+	if err := tx.QueryRow(ctx, `
+		SELECT max(version) + 1
+		FROM documents
+		WHERE lineage_id = $1`,
+		previous.LineageId,
+	).Scan(&file.Version); err != nil {
+		return err
+	}
+	if file.Scan.Status == constant.SCAN_STATUS_INFECTED {
+		file.IsCurrent = false
+		return nil
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE documents SET is_current = false WHERE id = $1`, previous.Id)
+	return err
+}
+
+// removeObjects deletes objects stored for uploads that were not registered.
+func (h handler) removeObjects(ctx context.Context, objectKeys []string) {
+	for _, objectKey := range objectKeys {
+		if err := h.objects.Delete(ctx, objectKey); err != nil {
+			log.Warn().Err(err).Str("key", objectKey).Msg("upload: failed to remove unregistered object")
+		}
+	}
+}
+
+// storeUpload puts the upload under objectKey, encrypting it with key, or
+// for staged uploads copies the client's ciphertext there. The staged object
+// is left for the caller to remove once the upload is registered.
+func (h handler) storeUpload(
+	ctx context.Context,
+	upload upload,
+	objectKey string,
+	key keyservice.SecretKey,
+	metadata map[string]string,
+) error {
+	if upload.Staged == "" {
+		return h.putEncrypted(ctx, objectKey, upload.Content, key, metadata)
+	}
+
+	objectMetadata := map[string]string{
+		constant.EDEK_HEADER:       key.CiphertextEncoded,
+		constant.DEK_DIGEST:        key.DigestEncoded,
+		constant.ENCRYPTION_FORMAT: constant.ENCRYPTION_FORMAT_STREAM,
+	}
+	maps.Copy(objectMetadata, metadata)
+
+	return h.objects.Copy(ctx, upload.Staged, objectKey, objectMetadata)
+}
+
+// quarantineError refuses the uploads flagged by the content scanner, once
+// they are safely stored away.
+func quarantineError(files []File) error {
+	details := make([]error, 0)
+	for _, file := range files {
+		if file.Scan.Status != constant.SCAN_STATUS_INFECTED {
+			continue
+		}
+		details = append(details, &huma.ErrorDetail{
+			Message:  fmt.Sprintf("flagged as %s", file.Scan.Signature),
+			Location: file.Filename,
+		})
+	}
+	if len(details) == 0 {
+		return nil
+	}
+	return huma.Error422UnprocessableEntity("attachments flagged by content scanner", details...)
+}
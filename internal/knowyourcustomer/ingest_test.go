@@ -0,0 +1,120 @@
+package knowyourcustomer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+func TestIngestEncryptsAtRest(t *testing.T) {
+	h := newTestHandler(t, config.Config{
+		Variants: config.Variants{Enabled: true, MaxDimension: 48, PreviewDimension: 24, PreviewWatermark: "PREVIEW"},
+	})
+	content := testPng(t, 64, 40)
+
+	files, err := h.ingest(context.Background(), []upload{{
+		Filename: "ktp.png",
+		Kind:     constant.DOCUMENT_KIND_KTP,
+		Content:  content,
+	}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("ingested %d files, want 1", len(files))
+	}
+	file := files[0]
+
+	stored, metadata := storedObject(t, h, file.ObjectKey)
+	if bytes.Contains(stored, pngMagicBytes) {
+		t.Fatal("document is stored in plaintext")
+	}
+	if metadata[constant.ENCRYPTION_FORMAT] != constant.ENCRYPTION_FORMAT_STREAM || metadata[constant.EDEK_HEADER] == "" {
+		t.Fatalf("document metadata = %v", metadata)
+	}
+	plaintext, err := h.getDecrypted(context.Background(), file.ObjectKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, content) {
+		t.Fatal("document does not decrypt to the upload")
+	}
+
+	if len(file.Variants) != len(renditionVariants) {
+		t.Fatalf("rendered %d variants, want %d", len(file.Variants), len(renditionVariants))
+	}
+	edeks := []string{metadata[constant.EDEK_HEADER]}
+	for _, variant := range file.Variants {
+		_, metadata := storedObject(t, h, variant.ObjectKey)
+		if slices.Contains(edeks, metadata[constant.EDEK_HEADER]) {
+			t.Fatalf("variant %s shares a DEK", variant.Variant)
+		}
+		edeks = append(edeks, metadata[constant.EDEK_HEADER])
+
+		plaintext, err := h.getDecrypted(context.Background(), variant.ObjectKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(plaintext, pngMagicBytes) {
+			t.Fatalf("variant %s does not decrypt to a PNG", variant.Variant)
+		}
+	}
+}
+
+func TestIngestRemovesObjectsOfRefusedUploads(t *testing.T) {
+	h := newTestHandler(t, config.Config{
+		Variants: config.Variants{Enabled: true, MaxDimension: 48, PreviewDimension: 24},
+	})
+
+	_, err := h.ingest(context.Background(), []upload{
+		{Filename: "ktp.png", Kind: constant.DOCUMENT_KIND_KTP, Content: testPng(t, 64, 40)},
+		{Filename: "slip.png", Kind: constant.DOCUMENT_KIND_SALARY_SLIP, Content: []byte("not an image at all")},
+	}, "")
+	if err == nil {
+		t.Fatal("ingested an upload of no accepted type")
+	}
+	if keys := storedKeys(t, h, ""); len(keys) != 0 {
+		t.Fatalf("objects of the refused batch are left behind: %v", keys)
+	}
+}
+
+func TestIngestQuarantinesFlaggedUploads(t *testing.T) {
+	h := newTestHandler(t, config.Config{
+		Variants: config.Variants{Enabled: true, MaxDimension: 48, PreviewDimension: 24},
+	})
+	h.scanner = flagAll{}
+	content := testPng(t, 64, 40)
+
+	files, err := h.ingest(context.Background(), []upload{{
+		Filename: "ktp.png",
+		Kind:     constant.DOCUMENT_KIND_KTP,
+		Content:  content,
+	}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := storedKeys(t, h, "")
+	if !slices.Equal(keys, []string{files[0].ObjectKey}) || files[0].ObjectKey != quarantineObjectKey(documentObjectKey(files[0].Id, "ktp.png")) {
+		t.Fatalf("stored %v, want the quarantined upload only", keys)
+	}
+	plaintext, err := h.getDecrypted(context.Background(), files[0].ObjectKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, content) {
+		t.Fatal("quarantined upload does not decrypt to the upload")
+	}
+
+	var status huma.StatusError
+	if err := quarantineError(files); !errors.As(err, &status) || status.GetStatus() != http.StatusUnprocessableEntity {
+		t.Fatalf("quarantine error = %v, want 422", err)
+	}
+}
@@ -0,0 +1,225 @@
+package knowyourcustomer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// signLink computes the signature half of a link token. Tokens are the link
+// id and its signature, so forged or mistyped ones are turned away without
+// touching the database.
+func (h handler) signLink(ctx context.Context, id string) (string, error) {
+	mac, err := h.keyservice.Hmac(ctx, []byte("download_link:"+id))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(mac)), nil
+}
+
+// verifyLink returns the link id of a token carrying a valid signature.
+func (h handler) verifyLink(ctx context.Context, token string) (string, bool, error) {
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", false, nil
+	}
+	if _, err := ulid.ParseStrict(id); err != nil {
+		return "", false, nil
+	}
+	expected, err := h.signLink(ctx, id)
+	if err != nil {
+		return "", false, err
+	}
+	return id, subtle.ConstantTimeCompare([]byte(signature), []byte(expected)) == 1, nil
+}
+
+// CreateDownloadLink mints a link to a document rendition which a browser
+// can follow without credentials. Access is authorized and justified, and
+// watermarking decided now, for the caller, the redemption only replays that.
+func (h handler) CreateDownloadLink(ctx context.Context, request *struct {
+	Id   string `path:"id" doc:"Document id, or the filename of its latest upload"`
+	Body DownloadLinkRequest
+}) (_ *struct {
+	Body DownloadLink
+}, err error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+	variant := request.Body.Variant
+	if variant == "" {
+		variant = constant.VARIANT_ORIGINAL
+	}
+	event := &audit.Event{
+		Action: constant.AUDIT_ACTION_DOCUMENT_LINK_CREATE,
+		Detail: map[string]any{"reference": request.Id, "variant": variant},
+	}
+	defer func() { err = audit.RecordAccess(ctx, h.pool, event, err) }()
+
+	document, err := h.findDocument(ctx, request.Id)
+	if err != nil {
+		return nil, err
+	}
+	event.DocumentId = document.Id
+	if err := h.authorizeOwnerOrReviewer(ctx, document); err != nil {
+		return nil, err
+	}
+	if err := h.justifyAccess(ctx, document.CreatedBy, request.Body.AccessJustification, event); err != nil {
+		return nil, err
+	}
+	if document.ScanStatus == constant.SCAN_STATUS_INFECTED {
+		return nil, huma.Error403Forbidden(fmt.Sprintf("document %s is quarantined", request.Id))
+	}
+	if _, err := h.findVariantKey(ctx, document, variant); err != nil {
+		return nil, err
+	}
+
+	id := ulid.Make().String()
+	event.Detail["linkId"] = id
+	signature, err := h.signLink(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(h.config.Links.Ttl) * time.Second)
+	if _, err := h.pool.Exec(ctx, `
+		INSERT INTO download_links (id, document_id, variant, created_by, purpose, ticket, watermark, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		id,
+		document.Id,
+		variant,
+		principal.Subject,
+		nullableString(request.Body.Purpose),
+		nullableString(request.Body.Ticket),
+		h.mustWatermark(ctx),
+		now,
+		expiresAt,
+	); err != nil {
+		return nil, err
+	}
+
+	token := id + "." + signature
+	return &struct{ Body DownloadLink }{Body: DownloadLink{
+		Url:       strings.TrimSuffix(h.config.Links.BaseUrl, "/") + "/links/" + token,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	}}, nil
+}
+
+// RedeemDownloadLink spends a link and streams the decrypted rendition. The
+// redemption is audited on behalf of whoever created the link.
+func (h handler) RedeemDownloadLink(ctx context.Context, request *struct {
+	Token string `path:"token" maxLength:"256"`
+}) (_ *huma.StreamResponse, err error) {
+	event := &audit.Event{Action: constant.AUDIT_ACTION_DOCUMENT_LINK_REDEEM}
+	defer func() { err = audit.RecordAccess(ctx, h.pool, event, err) }()
+
+	id, valid, err := h.verifyLink(ctx, request.Token)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, huma.Error404NotFound("no such download link")
+	}
+	event.Detail = map[string]any{"linkId": id}
+
+	var (
+		documentId, variant, createdBy string
+		purpose, ticket                *string
+		watermark                      bool
+	)
+	err = h.pool.QueryRow(ctx, `
+		UPDATE download_links
+		SET redeemed_at = $2
+		WHERE id = $1 AND redeemed_at IS NULL AND expires_at > $2
+		RETURNING document_id, variant, created_by, purpose, ticket, watermark`,
+		id,
+		time.Now(),
+	).Scan(&documentId, &variant, &createdBy, &purpose, &ticket, &watermark)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, huma.Error410Gone("download link is expired or already used")
+	}
+	if err != nil {
+		return nil, err
+	}
+	event.Subject, event.DocumentId = createdBy, documentId
+	event.Detail["variant"] = variant
+	if purpose != nil {
+		event.Purpose = *purpose
+	}
+	if ticket != nil {
+		event.Detail["ticket"] = *ticket
+	}
+
+	document, err := h.findDocument(ctx, documentId)
+	if err != nil {
+		return nil, err
+	}
+	if document.ScanStatus == constant.SCAN_STATUS_INFECTED {
+		return nil, huma.Error403Forbidden(fmt.Sprintf("document %s is quarantined", documentId))
+	}
+	objectKey, err := h.findVariantKey(ctx, document, variant)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := h.openDecrypted(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	if watermark {
+		content, err := io.ReadAll(plaintext)
+		plaintext.Close()
+		if err != nil {
+			return nil, err
+		}
+		content, watermarkId, err := h.watermarkCopy(ctx, documentId, variant, createdBy, event.Purpose, content)
+		if err != nil {
+			return nil, err
+		}
+		event.Detail["watermarkId"] = watermarkId
+		plaintext = io.NopCloser(bytes.NewReader(content))
+	}
+
+	// sniffing opens the first segment, failing before any header is sent
+	buffered := bufio.NewReaderSize(plaintext, 512)
+	head, err := buffered.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		plaintext.Close()
+		return nil, err
+	}
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": archiveName(document.Filename)})
+
+	return &huma.StreamResponse{Body: func(hctx huma.Context) {
+		defer plaintext.Close()
+
+		hctx.SetHeader("Content-Type", http.DetectContentType(head))
+		hctx.SetHeader("Content-Disposition", disposition)
+		hctx.SetHeader("Cache-Control", "no-store")
+		hctx.SetStatus(http.StatusOK)
+
+		if _, err := io.Copy(hctx.BodyWriter(), buffered); err != nil {
+			log.Error().Err(err).Str("link", id).Msg("download link: transfer interrupted")
+			// a truncated body must not pass as the whole document
+			panic(http.ErrAbortHandler)
+		}
+	}}, nil
+}
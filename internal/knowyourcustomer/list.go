@@ -0,0 +1,122 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/middleware"
+	"github.com/oklog/ulid/v2"
+)
+
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9:_-]{1,64}$`)
+
+func (h handler) ListAssets(ctx context.Context, request *struct {
+	Cursor    string    `query:"cursor" doc:"Id of the last document from the previous page"`
+	Limit     int       `query:"limit" minimum:"1" maximum:"100" default:"20"`
+	Kind      string    `query:"kind" enum:"ktp,salary_slip,unknown"`
+	Status    string    `query:"status" enum:"pending,verified,rejected"`
+	CreatedBy string    `query:"created_by" doc:"Subject who uploaded the documents, reviewers only"`
+	From      time.Time `query:"from" doc:"Uploaded at or after this instant"`
+	To        time.Time `query:"to" doc:"Uploaded before this instant"`
+	Metadata  []string  `query:"metadata,explode" doc:"Stored metadata field filter as key:value, repeatable"`
+}) (*struct {
+	Body DocumentPage
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	createdBy := request.CreatedBy
+	if !middleware.HasRole(ctx, h.config.Roles.Reviewer) {
+		if createdBy != "" && createdBy != principal.Subject {
+			return nil, huma.Error403Forbidden("only reviewers may list other subjects' documents")
+		}
+		createdBy = principal.Subject
+	}
+
+	// replaced versions are listed in the history of their document only
+	conditions := []string{"purged_at IS NULL", "is_current"}
+	args := make([]any, 0)
+	where := func(format string, values ...any) {
+		placeholders := make([]any, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conditions = append(conditions, fmt.Sprintf(format, placeholders...))
+	}
+
+	if request.Cursor != "" {
+		if _, err := ulid.ParseStrict(request.Cursor); err != nil {
+			return nil, huma.Error400BadRequest("malformed cursor")
+		}
+		where("id < %s", request.Cursor)
+	}
+	if createdBy != "" {
+		where("created_by = %s", createdBy)
+	}
+	if request.Kind != "" {
+		where("kind = %s", request.Kind)
+	}
+	if request.Status != "" {
+		where("status = %s", request.Status)
+	}
+	if !request.From.IsZero() {
+		where("created_at >= %s", request.From)
+	}
+	if !request.To.IsZero() {
+		where("created_at < %s", request.To)
+	}
+	for _, filter := range request.Metadata {
+		key, value, ok := strings.Cut(filter, ":")
+		if !ok || !metadataKeyPattern.MatchString(key) {
+			return nil, huma.Error400BadRequest(fmt.Sprintf("malformed metadata filter %q", filter))
+		}
+		where("metadata ->> %s = %s", key, value)
+	}
+
+	query := `
+		SELECT id, filename, kind, status, scan_status, created_by, created_at
+		FROM documents`
+	query += " WHERE " + strings.Join(conditions, " AND ")
+	args = append(args, request.Limit+1)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := h.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	documents, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Document, error) {
+		var document Document
+		err := row.Scan(
+			&document.Id,
+			&document.Filename,
+			&document.Kind,
+			&document.Status,
+			&document.ScanStatus,
+			&document.CreatedBy,
+			&document.CreatedAt,
+		)
+		return document, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	page := DocumentPage{Items: documents}
+	if len(documents) > request.Limit {
+		page.Items = documents[:request.Limit]
+		page.NextCursor = page.Items[request.Limit-1].Id
+	}
+
+	return &struct{ Body DocumentPage }{Body: page}, nil
+}
@@ -0,0 +1,146 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/barasher/go-exiftool"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/cryptography"
+)
+
+// metadataReader extracts the metadata of files on disk, it is satisfied by
+// *exiftool.Exiftool.
+type metadataReader interface {
+	ExtractMetadata(files ...string) []exiftool.FileMetadata
+}
+
+// exposedMetadataFields is the allowlist of extracted fields safe to hand
+// back. Anything else, e.g. GPS position, device serials or the server-side
+// temporary path exiftool saw, stays in the database only.
+var exposedMetadataFields = []string{
+	"MIMEType",
+	"FileType",
+	"FileTypeExtension",
+	"ImageWidth",
+	"ImageHeight",
+	"ImageSize",
+	"Megapixels",
+	"BitDepth",
+	"ColorType",
+	"Compression",
+	"Interlace",
+	"Orientation",
+	"PageCount",
+}
+
+func sanitizeMetadata(raw json.RawMessage) (map[string]any, error) {
+	fields := make(map[string]any)
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	sanitized := make(map[string]any)
+	for _, field := range exposedMetadataFields {
+		if value, ok := fields[field]; ok {
+			sanitized[field] = value
+		}
+	}
+	return sanitized, nil
+}
+
+// describe builds the document metadata out of its row and the stored object
+// size, without unwrapping any key.
+func (h handler) describe(ctx context.Context, document DocumentRecord) (DocumentMetadata, error) {
+	object, err := h.objects.Head(ctx, document.ObjectKey)
+	if err != nil {
+		return DocumentMetadata{}, err
+	}
+	size := object.Size - cryptography.AesGcmOverhead
+	if object.Metadata[constant.ENCRYPTION_FORMAT] == constant.ENCRYPTION_FORMAT_STREAM {
+		size = cryptography.StreamPlaintextSize(object.Size)
+	}
+
+	metadata, err := sanitizeMetadata(document.Metadata)
+	if err != nil {
+		return DocumentMetadata{}, err
+	}
+	mimeType, ok := metadata["MIMEType"].(string)
+	if !ok {
+		mimeType = "application/octet-stream"
+	}
+
+	return DocumentMetadata{
+		Id:         document.Id,
+		Filename:   document.Filename,
+		Kind:       document.Kind,
+		Status:     document.Status,
+		ScanStatus: document.ScanStatus,
+		MimeType:   mimeType,
+		Size:       max(0, size),
+		CreatedBy:  document.CreatedBy,
+		UploadedAt: document.CreatedAt,
+		Metadata:   metadata,
+	}, nil
+}
+
+func (h handler) GetAssetMetadata(ctx context.Context, request *struct {
+	Id string `path:"id" doc:"Document id, or the filename of its latest upload"`
+}) (_ *struct {
+	Body DocumentMetadata
+}, err error) {
+	event := &audit.Event{
+		Action: constant.AUDIT_ACTION_DOCUMENT_METADATA,
+		Detail: map[string]any{"reference": request.Id},
+	}
+	defer func() { err = audit.RecordAccess(ctx, h.pool, event, err) }()
+
+	document, err := h.findDocument(ctx, request.Id)
+	if err != nil {
+		return nil, err
+	}
+	event.DocumentId = document.Id
+	if err := h.authorizeOwnerOrReviewer(ctx, document); err != nil {
+		return nil, err
+	}
+
+	metadata, err := h.describe(ctx, document)
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body DocumentMetadata }{Body: metadata}, nil
+}
+
+func (h handler) HeadAsset(ctx context.Context, request *struct {
+	Id string `path:"id" doc:"Document id, or the filename of its latest upload"`
+}) (_ *DocumentHeaders, err error) {
+	event := &audit.Event{
+		Action: constant.AUDIT_ACTION_DOCUMENT_METADATA,
+		Detail: map[string]any{"reference": request.Id},
+	}
+	defer func() { err = audit.RecordAccess(ctx, h.pool, event, err) }()
+
+	document, err := h.findDocument(ctx, request.Id)
+	if err != nil {
+		return nil, err
+	}
+	event.DocumentId = document.Id
+	if err := h.authorizeOwnerOrReviewer(ctx, document); err != nil {
+		return nil, err
+	}
+
+	metadata, err := h.describe(ctx, document)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DocumentHeaders{
+		ContentType:    metadata.MimeType,
+		ContentLength:  metadata.Size,
+		LastModified:   metadata.UploadedAt,
+		Kind:           metadata.Kind,
+		DocumentStatus: metadata.Status,
+		ScanStatus:     metadata.ScanStatus,
+	}, nil
+}
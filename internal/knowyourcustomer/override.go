@@ -0,0 +1,201 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/extractor"
+	"github.com/oklog/ulid/v2"
+)
+
+func (h handler) extractionEdits(ctx context.Context, documentId string) ([]ExtractionEdit, error) {
+	rows, err := h.pool.Query(ctx, `
+		SELECT id, editor, note, changes, edek, dek_digest, created_at
+		FROM document_extraction_edits
+		WHERE document_id = $1
+		ORDER BY id`,
+		documentId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (ExtractionEdit, error) {
+		var (
+			edit       ExtractionEdit
+			ciphertext []byte
+			edek       string
+			digest     string
+		)
+		if err := row.Scan(&edit.Id, &edit.Editor, &edit.Note, &ciphertext, &edek, &digest, &edit.CreatedAt); err != nil {
+			return ExtractionEdit{}, err
+		}
+		err := h.openJson(ctx, ciphertext, edek, digest, &edit.Changes)
+		return edit, err
+	})
+}
+
+// OverrideAssetExtraction lets a reviewer correct extracted fields. Set values
+// get full confidence, and the previous values are kept, sealed, in the edit
+// history. Documents never extracted may be filled in by hand this way too.
+func (h handler) OverrideAssetExtraction(ctx context.Context, request *struct {
+	Id   string `path:"id" doc:"Document id, or the filename of its latest upload"`
+	Body ExtractionOverrideRequest
+}) (*struct {
+	Body DocumentExtraction
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	document, err := h.findDocument(ctx, request.Id)
+	if err != nil {
+		return nil, err
+	}
+	allowed, ok := extractor.KindFields[document.Kind]
+	if !ok {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("%s documents have no extractable fields", document.Kind))
+	}
+	for name, value := range request.Body.Fields {
+		if !slices.Contains(allowed, name) {
+			return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("unknown field %s for %s documents", name, document.Kind))
+		}
+		if value == "" {
+			continue
+		}
+		if err := extractor.ValidateField(name, value); err != nil {
+			return nil, huma.Error422UnprocessableEntity(err.Error())
+		}
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// the row lock keeps concurrent overrides, and a worker reclaiming the
+	// row, from interleaving with this edit
+	var status string
+	err = tx.QueryRow(ctx, `
+		SELECT status
+		FROM document_extractions
+		WHERE document_id = $1
+		FOR UPDATE`,
+		document.Id,
+	).Scan(&status)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if status == constant.EXTRACTION_STATUS_PENDING || status == constant.EXTRACTION_STATUS_PROCESSING {
+		return nil, huma.Error409Conflict("extraction is still running")
+	}
+
+	fields := make(extractor.Fields)
+	if status == constant.EXTRACTION_STATUS_COMPLETED {
+		current, err := h.openExtraction(ctx, document.Id)
+		if err != nil {
+			return nil, err
+		}
+		if current.Fields != nil {
+			fields = current.Fields
+		}
+	}
+
+	changes := make(map[string]FieldChange)
+	for name, value := range request.Body.Fields {
+		var change FieldChange
+		if previous, ok := fields[name]; ok {
+			if previous.Value == value && previous.Confidence == 1 {
+				continue
+			}
+			change.From = &previous.Value
+		}
+		if value == "" {
+			if change.From == nil {
+				continue
+			}
+			delete(fields, name)
+		} else {
+			change.To = &value
+			fields[name] = extractor.Field{Value: value, Confidence: 1}
+		}
+		changes[name] = change
+	}
+
+	if len(changes) > 0 {
+		now := time.Now()
+		sealedFields, fieldsKey, err := h.sealJson(ctx, fields)
+		if err != nil {
+			return nil, err
+		}
+		sealedChanges, changesKey, err := h.sealJson(ctx, changes)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO document_extractions (document_id, status, fields, edek, dek_digest, created_at, completed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $6)
+			ON CONFLICT (document_id) DO UPDATE
+			SET status = EXCLUDED.status, fields = EXCLUDED.fields, edek = EXCLUDED.edek,
+				dek_digest = EXCLUDED.dek_digest, error = NULL, completed_at = EXCLUDED.completed_at`,
+			document.Id,
+			constant.EXTRACTION_STATUS_COMPLETED,
+			sealedFields,
+			fieldsKey.CiphertextEncoded,
+			fieldsKey.DigestEncoded,
+			now,
+		); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO document_extraction_edits (id, document_id, editor, note, changes, edek, dek_digest, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			ulid.Make().String(),
+			document.Id,
+			principal.Subject,
+			nullableString(request.Body.Note),
+			sealedChanges,
+			changesKey.CiphertextEncoded,
+			changesKey.DigestEncoded,
+			now,
+		); err != nil {
+			return nil, err
+		}
+		if err := h.recordIdentity(ctx, tx, document.Id, fields); err != nil {
+			return nil, err
+		}
+		if err := audit.Append(ctx, tx, audit.Event{
+			Action:     constant.AUDIT_ACTION_DOCUMENT_EXTRACTION_OVERRIDE,
+			DocumentId: document.Id,
+			Outcome:    constant.AUDIT_OUTCOME_SUCCESS,
+			Detail:     map[string]any{"fields": slices.Sorted(maps.Keys(changes))},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	extraction, err := h.openExtraction(ctx, document.Id)
+	if err != nil {
+		return nil, err
+	}
+	extraction.Edits, err = h.extractionEdits(ctx, document.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body DocumentExtraction }{Body: extraction}, nil
+}
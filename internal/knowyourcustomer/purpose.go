@@ -0,0 +1,50 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+// justifyAccess checks the purpose stated for reading data owned by owner and
+// records it on the audit event. Owners need not state one, anyone else is
+// refused without a configured purpose. A purpose never grants access, callers
+// authorize the read first.
+func (h handler) justifyAccess(ctx context.Context, owner string, justification AccessJustification, event *audit.Event) error {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return errors.New("missing principal token in context")
+	}
+
+	event.Purpose = justification.Purpose
+	if justification.Ticket != "" {
+		if event.Detail == nil {
+			event.Detail = make(map[string]any)
+		}
+		event.Detail["ticket"] = justification.Ticket
+	}
+
+	purposes := h.config.Access.Purposes
+	if len(purposes) == 0 {
+		return nil
+	}
+	if justification.Purpose == "" {
+		if principal.Subject == owner {
+			return nil
+		}
+		return huma.Error403Forbidden("a purpose is required to access data of another subject")
+	}
+	if !slices.Contains(purposes, justification.Purpose) {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf(
+			"unknown purpose %q, expected one of %s", justification.Purpose, strings.Join(purposes, ", "),
+		))
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+func (h handler) leaseDuration() time.Duration {
+	return time.Duration(h.config.Queue.LeaseDuration) * time.Second
+}
+
+func leaseExpired(c Case, now time.Time) bool {
+	return c.State == constant.CASE_STATE_IN_REVIEW && c.LeaseUntil != nil && !c.LeaseUntil.After(now)
+}
+
+// holdsLease reports whether reviewer may still act on the case.
+func holdsLease(c Case, reviewer string) error {
+	if c.State != constant.CASE_STATE_IN_REVIEW || c.Reviewer == nil || *c.Reviewer != reviewer {
+		return huma.Error409Conflict("case is not claimed by you")
+	}
+	if leaseExpired(c, time.Now()) {
+		return huma.Error409Conflict("your lease on this case expired, claim it again")
+	}
+	return nil
+}
+
+// checkClaimCapacity serializes the claims of a reviewer for the rest of the
+// transaction and refuses new ones past the configured concurrency cap.
+func (h handler) checkClaimCapacity(ctx context.Context, tx pgx.Tx, reviewer string) error {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, reviewer); err != nil {
+		return err
+	}
+	if h.config.Queue.MaxClaimsPerReviewer < 1 {
+		return nil
+	}
+
+	var active int
+	if err := tx.QueryRow(ctx, `
+		SELECT count(*)
+		FROM kyc_cases
+		WHERE state = $1 AND reviewer = $2 AND lease_expires_at > $3`,
+		constant.CASE_STATE_IN_REVIEW,
+		reviewer,
+		time.Now(),
+	).Scan(&active); err != nil {
+		return err
+	}
+	if active >= h.config.Queue.MaxClaimsPerReviewer {
+		return huma.Error429TooManyRequests(fmt.Sprintf(
+			"you already hold %d claimed cases, decide or release one first",
+			active,
+		))
+	}
+	return nil
+}
+
+// claim puts a locked case under the reviewer's lease. A case whose previous
+// lease lapsed is first handed back to the queue so its history shows it. It
+// returns the audit events of the transitions, for the caller to append last.
+func (h handler) claim(ctx context.Context, tx pgx.Tx, c *Case, reviewer string) ([]audit.Event, error) {
+	now := time.Now()
+	if c.State == constant.CASE_STATE_IN_REVIEW && !leaseExpired(*c, now) {
+		return nil, huma.Error409Conflict("case is already claimed")
+	}
+	events := make([]audit.Event, 0, 2)
+	if leaseExpired(*c, now) {
+		event, err := transitionCase(
+			ctx,
+			tx,
+			c,
+			constant.CASE_STATE_SUBMITTED,
+			constant.CASE_ACTOR_SYSTEM,
+			nullableString(constant.CASE_REASON_LEASE_EXPIRED),
+			nil,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	event, err := transitionCase(ctx, tx, c, constant.CASE_STATE_IN_REVIEW, reviewer, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, event)
+	return events, h.extendLease(ctx, tx, c)
+}
+
+func (h handler) extendLease(ctx context.Context, tx pgx.Tx, c *Case) error {
+	leaseUntil := time.Now().Add(h.leaseDuration())
+	if _, err := tx.Exec(ctx, `
+		UPDATE kyc_cases
+		SET lease_expires_at = $2
+		WHERE id = $1`,
+		c.Id,
+		leaseUntil,
+	); err != nil {
+		return err
+	}
+	c.LeaseUntil = &leaseUntil
+	return nil
+}
+
+// ClaimNextCase hands the calling reviewer the longest waiting case. Rows
+// locked by concurrent claims are skipped rather than waited on.
+func (h handler) ClaimNextCase(ctx context.Context, _ *struct{}) (*struct {
+	Body Case
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := h.checkClaimCapacity(ctx, tx, principal.Subject); err != nil {
+		return nil, err
+	}
+
+	c, err := scanCase(tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM kyc_cases
+		WHERE subject <> $1
+			AND (state = $2 OR (state = $3 AND lease_expires_at <= $4))
+		ORDER BY submitted_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`, caseColumns),
+		principal.Subject,
+		constant.CASE_STATE_SUBMITTED,
+		constant.CASE_STATE_IN_REVIEW,
+		time.Now(),
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, huma.Error404NotFound("no case is waiting for review")
+	}
+	if err != nil {
+		return nil, err
+	}
+	events, err := h.claim(ctx, tx, &c, principal.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `SELECT document_id FROM kyc_case_documents WHERE case_id = $1 ORDER BY document_id`, c.Id)
+	if err != nil {
+		return nil, err
+	}
+	c.DocumentIds, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		if err := audit.Append(ctx, tx, event); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body Case }{Body: c}, nil
+}
+
+// RenewCaseLease pushes the lease of a case the caller still holds.
+func (h handler) RenewCaseLease(ctx context.Context, request *struct {
+	Id string `path:"id"`
+}) (*struct {
+	Body Case
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	c, err := findCase(ctx, tx, "id", request.Id, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := holdsLease(c, principal.Subject); err != nil {
+		return nil, err
+	}
+	if err := h.extendLease(ctx, tx, &c); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body Case }{Body: c}, nil
+}
+
+// ReleaseCase returns a case the caller still holds to the queue without
+// deciding it.
+func (h handler) ReleaseCase(ctx context.Context, request *struct {
+	Id string `path:"id"`
+}) (*struct {
+	Body Case
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	c, err := findCase(ctx, tx, "id", request.Id, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := holdsLease(c, principal.Subject); err != nil {
+		return nil, err
+	}
+	event, err := transitionCase(ctx, tx, &c, constant.CASE_STATE_SUBMITTED, principal.Subject, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := audit.Append(ctx, tx, event); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body Case }{Body: c}, nil
+}
+
+func (h handler) GetQueueStats(ctx context.Context, _ *struct{}) (*struct {
+	Body QueueStats
+}, error) {
+	now := time.Now()
+	var stats QueueStats
+	if err := h.pool.QueryRow(ctx, `
+		SELECT
+			count(*) FILTER (WHERE state = $1),
+			count(*) FILTER (WHERE state = $2 AND lease_expires_at <= $3),
+			count(*) FILTER (WHERE state = $2 AND lease_expires_at > $3),
+			min(submitted_at) FILTER (WHERE state = $1 OR (state = $2 AND lease_expires_at <= $3))
+		FROM kyc_cases`,
+		constant.CASE_STATE_SUBMITTED,
+		constant.CASE_STATE_IN_REVIEW,
+		now,
+	).Scan(
+		&stats.Submitted,
+		&stats.ExpiredLeases,
+		&stats.InReview,
+		&stats.OldestWaitingSince,
+	); err != nil {
+		return nil, err
+	}
+	stats.Depth = stats.Submitted + stats.ExpiredLeases
+
+	rows, err := h.pool.Query(ctx, `
+		SELECT reviewer, count(*)
+		FROM kyc_cases
+		WHERE state = $1 AND lease_expires_at > $2
+		GROUP BY reviewer
+		ORDER BY count(*) DESC, reviewer`,
+		constant.CASE_STATE_IN_REVIEW,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	stats.Reviewers, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (ReviewerLoad, error) {
+		var load ReviewerLoad
+		err := row.Scan(&load.Reviewer, &load.ActiveClaims)
+		return load, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body QueueStats }{Body: stats}, nil
+}
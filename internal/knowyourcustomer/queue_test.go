@@ -0,0 +1,115 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/oklog/ulid/v2"
+)
+
+// newQueueHandler builds a handler over a test database holding one case of
+// subject-a waiting for review.
+func newQueueHandler(t *testing.T) handler {
+	t.Helper()
+	h := newTestHandler(t, config.Config{
+		Roles: config.Roles{Reviewer: "reviewer"},
+		Queue: config.Queue{LeaseDuration: 600},
+	})
+	h.pool = testDatabase(t)
+
+	now := time.Now()
+	if _, err := h.pool.Exec(context.Background(), `
+		INSERT INTO kyc_cases (id, subject, state, created_at, updated_at, submitted_at)
+		VALUES ($1, $2, $3, $4, $4, $4)`,
+		ulid.Make().String(),
+		"subject-a",
+		constant.CASE_STATE_SUBMITTED,
+		now,
+	); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func claimNextCase(t *testing.T, h handler, ctx context.Context) Case {
+	t.Helper()
+	claimed, err := h.ClaimNextCase(ctx, &struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claimed.Body
+}
+
+func releaseCase(h handler, ctx context.Context, id string) (Case, error) {
+	released, err := h.ReleaseCase(ctx, &struct {
+		Id string `path:"id"`
+	}{Id: id})
+	if err != nil {
+		return Case{}, err
+	}
+	return released.Body, nil
+}
+
+func TestReleaseCase(t *testing.T) {
+	h := newQueueHandler(t)
+	ctx := asSubject(context.Background(), "subject-r", "reviewer")
+	claimed := claimNextCase(t, h, ctx)
+
+	released, err := releaseCase(h, ctx, claimed.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if released.State != constant.CASE_STATE_SUBMITTED || released.Reviewer != nil {
+		t.Fatalf("released case is %s, reviewed by %v", released.State, released.Reviewer)
+	}
+	if !released.SubmittedAt.Equal(*claimed.SubmittedAt) {
+		t.Fatal("released case lost its place in the queue")
+	}
+}
+
+func TestReleaseDecidedCase(t *testing.T) {
+	h := newQueueHandler(t)
+	ctx := asSubject(context.Background(), "subject-r", "reviewer")
+	claimed := claimNextCase(t, h, ctx)
+
+	decided, err := h.DecideCase(ctx, &struct {
+		Id   string `path:"id"`
+		Body CaseDecisionRequest
+	}{Id: claimed.Id, Body: CaseDecisionRequest{
+		Decision:   constant.CASE_STATE_NEEDS_RESUBMISSION,
+		ReasonCode: constant.CASE_REASON_DOCUMENT_UNREADABLE,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decided.Body.Reviewer != nil || decided.Body.LeaseUntil != nil {
+		t.Fatal("decided case is still claimed")
+	}
+
+	_, err = releaseCase(h, ctx, claimed.Id)
+	requireStatus(t, err, http.StatusConflict)
+}
+
+func TestReleaseCaseOfAnotherReviewer(t *testing.T) {
+	h := newQueueHandler(t)
+	claimed := claimNextCase(t, h, asSubject(context.Background(), "subject-r", "reviewer"))
+
+	_, err := releaseCase(h, asSubject(context.Background(), "subject-s", "reviewer"), claimed.Id)
+	requireStatus(t, err, http.StatusConflict)
+}
+
+func TestReleaseCaseAfterLeaseExpired(t *testing.T) {
+	h := newQueueHandler(t)
+	ctx := asSubject(context.Background(), "subject-r", "reviewer")
+	claimed := claimNextCase(t, h, ctx)
+	if _, err := h.pool.Exec(ctx, `UPDATE kyc_cases SET lease_expires_at = $2 WHERE id = $1`, claimed.Id, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := releaseCase(h, ctx, claimed.Id)
+	requireStatus(t, err, http.StatusConflict)
+}
@@ -0,0 +1,298 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	purgeMinInterval      = time.Minute
+	purgeDefaultBatchSize = 100
+)
+
+// retentionUntil is when a document of kind uploaded at uploadedAt expires,
+// nil when it is kept indefinitely.
+func (h handler) retentionUntil(kind string, uploadedAt time.Time) *time.Time {
+	days, ok := h.config.Retention.Kinds[kind]
+	if !ok {
+		days = h.config.Retention.Default
+	}
+	if days <= 0 {
+		return nil
+	}
+	until := uploadedAt.AddDate(0, 0, int(days))
+	return &until
+}
+
+// notifyPurge wakes an idle purge worker up, expired documents are otherwise
+// picked up on the next interval.
+func (h handler) notifyPurge() {
+	select {
+	case h.purgeSignal <- struct{}{}:
+	default:
+	}
+}
+
+// startPurgeWorker periodically purges documents past their retention, and
+// those of withdrawn consents when withdrawals purge.
+func (h handler) startPurgeWorker(ctx context.Context) {
+	if !h.config.Retention.Enabled && h.config.Consent.OnWithdrawal != constant.CONSENT_WITHDRAWAL_PURGE {
+		return
+	}
+	interval := max(purgeMinInterval, time.Duration(h.config.Retention.Interval)*time.Second)
+	batchSize := h.config.Retention.BatchSize
+	if batchSize <= 0 {
+		batchSize = purgeDefaultBatchSize
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		if h.config.Retention.Enabled {
+			if err := h.backfillRetention(ctx); err != nil {
+				log.Error().Err(err).Msg("retention: failed to backfill retention")
+			}
+		}
+		for {
+			for range batchSize {
+				purged, err := h.purgeNextExpired(ctx)
+				if err != nil {
+					log.Error().Err(err).Msg("retention: failed to purge document")
+				}
+				if !purged {
+					break
+				}
+			}
+			if err := h.deletePurgedObjects(ctx, batchSize); err != nil {
+				log.Error().Err(err).Msg("retention: failed to delete objects of purged documents")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.purgeSignal:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// backfillRetention schedules documents without a retention, such as those
+// uploaded before retention existed, as if the configured periods applied
+// when they were uploaded. The periods live in the configuration, so this
+// runs on start rather than in a migration.
+func (h handler) backfillRetention(ctx context.Context) error {
+	kinds := make([]string, 0, len(h.config.Retention.Kinds))
+	for kind, days := range h.config.Retention.Kinds {
+		kinds = append(kinds, kind)
+		if days <= 0 {
+			continue
+		}
+		if _, err := h.pool.Exec(ctx, `
+			UPDATE documents
+			SET retention_until = created_at + make_interval(days => $2)
+			WHERE kind = $1 AND retention_until IS NULL AND purged_at IS NULL`,
+			kind,
+			days,
+		); err != nil {
+			return err
+		}
+	}
+	if h.config.Retention.Default <= 0 {
+		return nil
+	}
+	_, err := h.pool.Exec(ctx, `
+		UPDATE documents
+		SET retention_until = created_at + make_interval(days => $2)
+		WHERE kind <> ALL($1) AND retention_until IS NULL AND purged_at IS NULL`,
+		kinds,
+		h.config.Retention.Default,
+	)
+	return err
+}
+
+// purgeNextExpired crypto-shreds one expired document not under legal hold.
+// With retention disabled, only documents of withdrawn consents expire.
+func (h handler) purgeNextExpired(ctx context.Context) (bool, error) {
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		document       DocumentRecord
+		retentionUntil time.Time
+		consentId      *string
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT id, filename, kind, scan_status, created_by, object_key, retention_until, consent_id
+		FROM documents
+		WHERE retention_until <= $1 AND NOT legal_hold AND purged_at IS NULL
+			AND ($2 OR consent_id IN (SELECT id FROM consents WHERE withdrawn_at IS NOT NULL))
+		ORDER BY retention_until
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`,
+		time.Now(),
+		h.config.Retention.Enabled,
+	).Scan(
+		&document.Id,
+		&document.Filename,
+		&document.Kind,
+		&document.ScanStatus,
+		&document.CreatedBy,
+		&document.ObjectKey,
+		&retentionUntil,
+		&consentId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	event := audit.Event{
+		Subject: constant.AUDIT_SUBJECT_RETENTION,
+		Detail: map[string]any{
+			"kind":           document.Kind,
+			"retentionUntil": retentionUntil.UTC(),
+		},
+	}
+	if consentId != nil {
+		event.Detail["consentId"] = *consentId
+	}
+	if err := h.purgeDocument(ctx, tx, document, event); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// purgeDocument crypto-shreds a document locked by tx. Every sealed row
+// derived from it is deleted, and its objects, whose metadata holds the only
+// copies of their EDEKs, are recorded for deletion once tx commits, see
+// deletePurgedObjects. The document row is kept as a tombstone so audit
+// events and cases still resolve it. Buckets with versioning need a
+// lifecycle rule expiring noncurrent versions too. event is completed and
+// appended as the purge record.
+func (h handler) purgeDocument(ctx context.Context, tx pgx.Tx, document DocumentRecord, event audit.Event) error {
+	objectKeys, err := h.purgeableObjectKeys(ctx, tx, document)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, objectKey := range objectKeys {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO purged_objects (object_key, document_id, created_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (object_key) DO NOTHING`,
+			objectKey,
+			document.Id,
+			now,
+		); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range []string{
+		constant.TABLE_DOCUMENT_VARIANTS,
+		constant.TABLE_DOCUMENT_EXTRACTION_EDITS,
+		constant.TABLE_DOCUMENT_EXTRACTIONS,
+		constant.TABLE_DOCUMENT_FINGERPRINTS,
+		constant.TABLE_SUBJECT_IDENTITIES,
+		constant.TABLE_KYC_CASE_FLAGS,
+	} {
+		if _, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE document_id = $1`, document.Id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE documents
+		SET metadata = '{}', scan_signature = NULL, purged_at = $2
+		WHERE id = $1`,
+		document.Id,
+		now,
+	); err != nil {
+		return err
+	}
+	event.Action = constant.AUDIT_ACTION_DOCUMENT_PURGE
+	event.DocumentId = document.Id
+	event.Outcome = constant.AUDIT_OUTCOME_SUCCESS
+	event.Detail["objects"] = len(objectKeys)
+	return audit.Append(ctx, tx, event)
+}
+
+// deletePurgedObjects deletes up to limit objects of purged documents. They
+// are only deleted once the purge committed, and stay recorded until they
+// are gone, so a failed deletion is retried on the next run instead of
+// leaving live documents without their objects.
+func (h handler) deletePurgedObjects(ctx context.Context, limit int) error {
+	rows, err := h.pool.Query(ctx, `
+		SELECT object_key
+		FROM purged_objects
+		ORDER BY created_at
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return err
+	}
+	objectKeys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	for _, objectKey := range objectKeys {
+		if err := h.objects.Delete(ctx, objectKey); err != nil {
+			return err
+		}
+		if _, err := h.pool.Exec(ctx, `DELETE FROM purged_objects WHERE object_key = $1`, objectKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeableObjectKeys lists the objects of a document. Uploads predating
+// versioning were keyed by filename, so while a live document shares its key
+// the objects hold that one's content and are left alone.
+func (h handler) purgeableObjectKeys(ctx context.Context, tx pgx.Tx, document DocumentRecord) ([]string, error) {
+	var shared bool
+	if err := tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM documents
+			WHERE object_key = $1 AND id <> $2 AND purged_at IS NULL
+		)`,
+		document.ObjectKey,
+		document.Id,
+	).Scan(&shared); err != nil {
+		return nil, err
+	}
+	if shared {
+		return nil, nil
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT object_key
+		FROM document_variants
+		WHERE document_id = $1`,
+		document.Id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	variantKeys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{document.ObjectKey}, variantKeys...), nil
+}
@@ -0,0 +1,48 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+func TestPurgeDeletesObjectsAfterCommit(t *testing.T) {
+	h := newDocumentHandler(t)
+	ctx := asSubject(context.Background(), "subject-a")
+	files, err := h.ingest(ctx, []upload{{Filename: "ktp.png", Kind: constant.DOCUMENT_KIND_KTP, Content: testPng(t, 64, 40)}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.pool.Exec(ctx, `UPDATE documents SET retention_until = $2 WHERE id = $1`, files[0].Id, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	stored := storedKeys(t, h, "")
+
+	purged, err := h.purgeNextExpired(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !purged {
+		t.Fatal("expired document was not purged")
+	}
+	// the purge only records its objects, to be deleted once it committed
+	if keys := storedKeys(t, h, ""); len(keys) != len(stored) {
+		t.Fatalf("purge deleted objects before it committed, left %v", keys)
+	}
+
+	if err := h.deletePurgedObjects(ctx, purgeDefaultBatchSize); err != nil {
+		t.Fatal(err)
+	}
+	if keys := storedKeys(t, h, ""); len(keys) != 0 {
+		t.Fatalf("objects of the purged document are left behind: %v", keys)
+	}
+	var pending int
+	if err := h.pool.QueryRow(ctx, `SELECT count(*) FROM purged_objects`).Scan(&pending); err != nil {
+		t.Fatal(err)
+	}
+	if pending != 0 {
+		t.Fatalf("%d deleted objects are still pending", pending)
+	}
+}
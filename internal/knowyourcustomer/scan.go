@@ -0,0 +1,33 @@
+package knowyourcustomer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/scanner"
+	"github.com/rs/zerolog/log"
+)
+
+func quarantineObjectKey(filename string) string {
+	return fmt.Sprintf("%s/%s", constant.QUARANTINE_OBJECT_PREFIX, filename)
+}
+
+// scan runs the configured scanner over plaintext. A scanner failure either
+// refuses the upload or, when failing open, lets it through marked as errored.
+func (h handler) scan(ctx context.Context, plaintext []byte) (scanner.Verdict, error) {
+	verdict, err := h.scanner.Scan(ctx, bytes.NewReader(plaintext))
+	if err == nil {
+		return verdict, nil
+	}
+
+	if !h.config.Scanner.FailOpen {
+		log.Error().Err(err).Msg("scanner: refusing upload, content scan failed")
+		return scanner.Verdict{}, huma.Error503ServiceUnavailable("content scanner unavailable")
+	}
+	log.Warn().Err(err).Msg("scanner: failing open, content scan failed")
+	return scanner.Verdict{Status: constant.SCAN_STATUS_ERROR, ScannedAt: time.Now()}, nil
+}
@@ -0,0 +1,45 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/scanner"
+)
+
+// unreachableClamd points at a socket nobody listens on.
+func unreachableClamd(t *testing.T) scanner.Scanner {
+	return scanner.NewClamd("unix", filepath.Join(t.TempDir(), "clamd.sock"), time.Second)
+}
+
+func TestScanFailsClosed(t *testing.T) {
+	h := handler{scanner: unreachableClamd(t)}
+
+	_, err := h.scan(context.Background(), []byte("content"))
+	var status huma.StatusError
+	if !errors.As(err, &status) || status.GetStatus() != http.StatusServiceUnavailable {
+		t.Fatalf("err = %v, want 503", err)
+	}
+}
+
+func TestScanFailsOpen(t *testing.T) {
+	h := handler{
+		config:  config.Config{Scanner: config.Scanner{FailOpen: true}},
+		scanner: unreachableClamd(t),
+	}
+
+	verdict, err := h.scan(context.Background(), []byte("content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verdict.Status != constant.SCAN_STATUS_ERROR {
+		t.Fatalf("status = %q, want %q", verdict.Status, constant.SCAN_STATUS_ERROR)
+	}
+}
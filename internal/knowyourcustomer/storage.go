@@ -0,0 +1,128 @@
+package knowyourcustomer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/cryptography"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/keyservice"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/objectstore"
+)
+
+// putEncrypted seals plaintext with the given DEK as a segmented stream and
+// stores it under objectKey, carrying the EDEK and DEK digest as object
+// metadata.
+func (h handler) putEncrypted(
+	ctx context.Context,
+	objectKey string,
+	plaintext []byte,
+	key keyservice.SecretKey,
+	metadata map[string]string,
+) error {
+	ciphertext, err := cryptography.EncryptStream(key.Data, plaintext)
+	if err != nil {
+		return err
+	}
+
+	objectMetadata := map[string]string{
+		constant.EDEK_HEADER:       key.CiphertextEncoded,
+		constant.DEK_DIGEST:        key.DigestEncoded,
+		constant.ENCRYPTION_FORMAT: constant.ENCRYPTION_FORMAT_STREAM,
+	}
+	maps.Copy(objectMetadata, metadata)
+
+	return h.objects.Put(ctx, objectKey, bytes.NewReader(ciphertext), int64(len(ciphertext)), objectstore.PutOptions{
+		Metadata: objectMetadata,
+	})
+}
+
+// getDecrypted fetches objectKey and opens it with the DEK unwrapped from its
+// stored EDEK.
+func (h handler) getDecrypted(ctx context.Context, objectKey string) ([]byte, error) {
+	plaintext, err := h.openDecrypted(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	defer plaintext.Close()
+	return io.ReadAll(plaintext)
+}
+
+// openDecrypted fetches objectKey for reading its plaintext. Segmented
+// streams are decrypted as they are read, objects in the former single
+// message format are decrypted whole upfront.
+func (h handler) openDecrypted(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	obj, err := h.objects.Get(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	edek, ok := obj.Metadata[constant.EDEK_HEADER]
+	if !ok {
+		obj.Body.Close()
+		return nil, errors.New("missing stored edek in object metadata")
+	}
+	dek, err := h.keyservice.DecryptDataKey(ctx, edek, obj.Metadata[constant.DEK_DIGEST])
+	if err != nil {
+		obj.Body.Close()
+		return nil, err
+	}
+
+	if obj.Metadata[constant.ENCRYPTION_FORMAT] == constant.ENCRYPTION_FORMAT_STREAM {
+		reader, err := cryptography.NewStreamReader(dek, obj.Body)
+		if err != nil {
+			obj.Body.Close()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{reader, obj.Body}, nil
+	}
+
+	defer obj.Body.Close()
+	ciphertext, err := io.ReadAll(obj.Body)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := cryptography.DecryptAesGcm(dek, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(plaintext)), nil
+}
+
+// sealJson encrypts the JSON encoding of v under a fresh DEK, for encrypted
+// columns stored next to their EDEK and DEK digest.
+func (h handler) sealJson(ctx context.Context, v any) ([]byte, keyservice.SecretKey, error) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return nil, keyservice.SecretKey{}, err
+	}
+	keys, err := h.keyservice.GenerateDataKeys(ctx, 1)
+	if err != nil {
+		return nil, keyservice.SecretKey{}, err
+	}
+	ciphertext, err := cryptography.EncryptAesGcm(keys[0].Data, plaintext)
+	if err != nil {
+		return nil, keyservice.SecretKey{}, err
+	}
+	return ciphertext, keys[0], nil
+}
+
+// openJson reverses sealJson into v.
+func (h handler) openJson(ctx context.Context, ciphertext []byte, edek, digest string, v any) error {
+	dek, err := h.keyservice.DecryptDataKey(ctx, edek, digest)
+	if err != nil {
+		return err
+	}
+	plaintext, err := cryptography.DecryptAesGcm(dek, ciphertext)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, v)
+}
@@ -0,0 +1,176 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/extractor"
+)
+
+// Blind index domains, one per searchable column.
+const (
+	identityNikDomain  = "subject_identities.nik"
+	identityNameDomain = "subject_identities.name"
+)
+
+// identityAad binds a sealed identity value to its column and subject.
+func identityAad(domain, subject string) []byte {
+	return []byte(domain + ":" + subject)
+}
+
+func normalizeName(name string) string {
+	return strings.Join(nameWords(name), " ")
+}
+
+// recordIdentity keeps the NIK and name read from the subject's latest KTP,
+// encrypted, next to blind indexes reviewers can look them up by.
+func (h handler) recordIdentity(ctx context.Context, q querier, documentId string, fields extractor.Fields) error {
+	if !h.config.FieldEncryption.Enabled {
+		return nil
+	}
+	nik, ok := fields[extractor.KTP_FIELD_NIK]
+	if !ok {
+		return nil
+	}
+
+	var subject, kind string
+	if err := q.QueryRow(ctx, `
+		SELECT created_by, kind
+		FROM documents
+		WHERE id = $1`,
+		documentId,
+	).Scan(&subject, &kind); err != nil {
+		return err
+	}
+	if kind != constant.DOCUMENT_KIND_KTP {
+		return nil
+	}
+
+	sealedNik, err := h.fieldCipher.Encrypt([]byte(nik.Value), identityAad(identityNikDomain, subject))
+	if err != nil {
+		return err
+	}
+	var sealedName, nameIndex []byte
+	if name, ok := fields[extractor.KTP_FIELD_NAME]; ok {
+		normalized := normalizeName(name.Value)
+		sealedName, err = h.fieldCipher.Encrypt([]byte(normalized), identityAad(identityNameDomain, subject))
+		if err != nil {
+			return err
+		}
+		nameIndex = h.fieldCipher.BlindIndex(identityNameDomain, []byte(normalized))
+	}
+
+	_, err = q.Exec(ctx, `
+		INSERT INTO subject_identities (subject, document_id, nik, nik_index, name, name_index, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (subject) DO UPDATE
+		SET document_id = EXCLUDED.document_id, nik = EXCLUDED.nik, nik_index = EXCLUDED.nik_index,
+			name = EXCLUDED.name, name_index = EXCLUDED.name_index, updated_at = EXCLUDED.updated_at`,
+		subject,
+		documentId,
+		sealedNik,
+		h.fieldCipher.BlindIndex(identityNikDomain, []byte(nik.Value)),
+		sealedName,
+		nameIndex,
+		time.Now(),
+	)
+	return err
+}
+
+// scanIdentity reads a subject_identities row, unsealing its values.
+func (h handler) scanIdentity(row pgx.Row) (SubjectIdentity, error) {
+	var (
+		identity   SubjectIdentity
+		sealedNik  []byte
+		sealedName []byte
+	)
+	if err := row.Scan(&identity.Subject, &identity.DocumentId, &sealedNik, &sealedName, &identity.UpdatedAt); err != nil {
+		return SubjectIdentity{}, err
+	}
+	nik, err := h.fieldCipher.Decrypt(sealedNik, identityAad(identityNikDomain, identity.Subject))
+	if err != nil {
+		return SubjectIdentity{}, err
+	}
+	identity.Nik = string(nik)
+	if sealedName != nil {
+		name, err := h.fieldCipher.Decrypt(sealedName, identityAad(identityNameDomain, identity.Subject))
+		if err != nil {
+			return SubjectIdentity{}, err
+		}
+		identity.Name = string(name)
+	}
+	return identity, nil
+}
+
+// subjectIdentity loads the recorded identity of subject, pgx.ErrNoRows when
+// none was recorded.
+func (h handler) subjectIdentity(ctx context.Context, subject string) (SubjectIdentity, error) {
+	return h.scanIdentity(h.pool.QueryRow(ctx, `
+		SELECT subject, document_id, nik, name, updated_at
+		FROM subject_identities
+		WHERE subject = $1`,
+		subject,
+	))
+}
+
+// LookupSubjects finds subjects by the exact NIK or name on their KTP. The
+// search terms travel in the body so they stay out of access logs.
+func (h handler) LookupSubjects(ctx context.Context, request *struct {
+	Body SubjectLookupRequest
+}) (_ *struct {
+	Body []SubjectIdentity
+}, err error) {
+	event := &audit.Event{
+		Action: constant.AUDIT_ACTION_SUBJECT_LOOKUP,
+		Detail: make(map[string]any),
+	}
+	defer func() { err = audit.RecordAccess(ctx, h.pool, event, err) }()
+
+	// matches may belong to anyone, so a purpose is always due
+	if err := h.justifyAccess(ctx, "", request.Body.AccessJustification, event); err != nil {
+		return nil, err
+	}
+	if !h.config.FieldEncryption.Enabled {
+		return nil, huma.Error404NotFound("subject identities are not recorded")
+	}
+
+	var (
+		column string
+		index  []byte
+	)
+	switch {
+	case request.Body.Nik != "":
+		event.Detail["by"] = "nik"
+		column, index = "nik_index", h.fieldCipher.BlindIndex(identityNikDomain, []byte(request.Body.Nik))
+	case normalizeName(request.Body.Name) != "":
+		event.Detail["by"] = "name"
+		column, index = "name_index", h.fieldCipher.BlindIndex(identityNameDomain, []byte(normalizeName(request.Body.Name)))
+	default:
+		return nil, huma.Error422UnprocessableEntity("either nik or name is required")
+	}
+
+	// column is one of the two constants above
+	rows, err := h.pool.Query(ctx, `
+		SELECT subject, document_id, nik, name, updated_at
+		FROM subject_identities
+		WHERE `+column+` = $1
+		ORDER BY subject`,
+		index,
+	)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (SubjectIdentity, error) {
+		return h.scanIdentity(row)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body []SubjectIdentity }{Body: identities}, nil
+}
@@ -0,0 +1,677 @@
+package knowyourcustomer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/cryptography"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/objectstore"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// tusPartSize is the least S3 takes for every multipart part but the last
+	tusPartSize = 5 * 1024 * 1024
+	// tusLease is how long a PATCH holds an upload, it is renewed with
+	// every part stored
+	tusLease         = 5 * time.Minute
+	tusSweepInterval = 15 * time.Minute
+)
+
+// tusPart is a stored part of the multipart upload behind a tus upload.
+type tusPart struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// tusUpload is the state of a resumable upload. The document is sealed as a
+// segmented stream while it arrives: Pending holds sealed segments waiting
+// to fill a part, Tail the plaintext of an incomplete segment, sealed on its
+// own until the segment completes.
+type tusUpload struct {
+	stagedUpload
+	Status      string
+	MultipartId string
+	Header      []byte
+	Offset      int64
+	Parts       []tusPart
+	Pending     []byte
+	Tail        []byte
+	ExpiresAt   time.Time
+}
+
+const tusUploadColumns = `id, status, filename, kind, length, consent_id, edek, dek_digest, object_key,
+	multipart_id, header, upload_offset, parts, pending, tail, expires_at`
+
+func scanTusUpload(row pgx.Row) (tusUpload, error) {
+	var upload tusUpload
+	err := row.Scan(
+		&upload.Id,
+		&upload.Status,
+		&upload.Filename,
+		&upload.Kind,
+		&upload.Size,
+		&upload.ConsentId,
+		&upload.Edek,
+		&upload.DekDigest,
+		&upload.ObjectKey,
+		&upload.MultipartId,
+		&upload.Header,
+		&upload.Offset,
+		&upload.Parts,
+		&upload.Pending,
+		&upload.Tail,
+		&upload.ExpiresAt,
+	)
+	return upload, err
+}
+
+// tusProtocol answers every tus request with the protocol version, and
+// refuses requests made for any other version than the one supported.
+func tusProtocol(api huma.API) func(huma.Context, func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		ctx.SetHeader("Tus-Resumable", constant.TUS_VERSION)
+		if ctx.Method() != http.MethodOptions && ctx.Header("Tus-Resumable") != constant.TUS_VERSION {
+			ctx.SetHeader("Tus-Version", constant.TUS_VERSION)
+			huma.WriteErr(api, ctx, http.StatusPreconditionFailed, fmt.Sprintf("only tus %s is supported", constant.TUS_VERSION))
+			return
+		}
+		next(ctx)
+	}
+}
+
+// parseTusMetadata reads the Upload-Metadata header, comma separated keys
+// each followed by a space and its base64 encoded value, if any.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for pair := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("metadata %s is not base64 encoded", key)
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata, nil
+}
+
+func (h handler) DescribeTus(ctx context.Context, _ *struct{}) (*struct {
+	TusVersion   string `header:"Tus-Version"`
+	TusExtension string `header:"Tus-Extension"`
+	TusMaxSize   int64  `header:"Tus-Max-Size"`
+}, error) {
+	if !h.config.Tus.Enabled {
+		return nil, huma.Error404NotFound("resumable uploads are not available")
+	}
+	return &struct {
+		TusVersion   string `header:"Tus-Version"`
+		TusExtension string `header:"Tus-Extension"`
+		TusMaxSize   int64  `header:"Tus-Max-Size"`
+	}{
+		TusVersion:   constant.TUS_VERSION,
+		TusExtension: constant.TUS_EXTENSIONS,
+		TusMaxSize:   h.config.Tus.MaxSize,
+	}, nil
+}
+
+// CreateTusUpload starts a resumable upload, of a length known upfront, and
+// the multipart upload its sealed segments go to.
+func (h handler) CreateTusUpload(ctx context.Context, request *struct {
+	UploadLength   int64  `header:"Upload-Length" required:"true" minimum:"8"`
+	UploadMetadata string `header:"Upload-Metadata"`
+}) (*struct {
+	Location      string `header:"Location"`
+	UploadExpires string `header:"Upload-Expires"`
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+	if !h.config.Tus.Enabled {
+		return nil, huma.Error404NotFound("resumable uploads are not available")
+	}
+	if request.UploadLength > h.config.Tus.MaxSize {
+		return nil, huma.NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("documents may not exceed %d bytes", h.config.Tus.MaxSize))
+	}
+	metadata, err := parseTusMetadata(request.UploadMetadata)
+	if err != nil {
+		return nil, huma.Error400BadRequest(err.Error())
+	}
+	filename := metadata[constant.TUS_METADATA_FILENAME]
+	if filename == "" || len(filename) > 255 || strings.ContainsAny(filename, `/\`) {
+		return nil, huma.Error400BadRequest("metadata filename must be a file name")
+	}
+	kind := metadata[constant.TUS_METADATA_KIND]
+	if kind == "" {
+		kind = constant.DOCUMENT_KIND_UNKNOWN
+	}
+	if !slices.Contains(constant.DOCUMENT_KINDS, kind) {
+		return nil, huma.Error400BadRequest(fmt.Sprintf("unknown document kind %q", kind))
+	}
+	consentId := metadata[constant.TUS_METADATA_CONSENT]
+	if err := h.precheckConsent(ctx, consentId); err != nil {
+		return nil, err
+	}
+
+	keys, err := h.keyservice.GenerateDataKeys(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	header, err := cryptography.NewStreamHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	id := ulid.Make().String()
+	objectKey := fmt.Sprintf("%s/%s", constant.UPLOAD_OBJECT_PREFIX, id)
+	multipartId, err := h.objects.CreateMultipart(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(h.config.Tus.Ttl) * time.Second)
+	if _, err := h.pool.Exec(ctx, `
+		INSERT INTO tus_uploads (
+			id, subject, status, filename, kind, length, consent_id, edek, dek_digest, object_key,
+			multipart_id, header, pending, created_at, expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		id,
+		principal.Subject,
+		constant.TUS_STATUS_UPLOADING,
+		filename,
+		kind,
+		request.UploadLength,
+		nullableString(consentId),
+		keys[0].CiphertextEncoded,
+		keys[0].DigestEncoded,
+		objectKey,
+		multipartId,
+		header,
+		// the first part opens with the stream header
+		header,
+		now,
+		expiresAt,
+	); err != nil {
+		return nil, err
+	}
+
+	return &struct {
+		Location      string `header:"Location"`
+		UploadExpires string `header:"Upload-Expires"`
+	}{
+		Location:      "/tus/" + id,
+		UploadExpires: expiresAt.UTC().Format(http.TimeFormat),
+	}, nil
+}
+
+// findTusUpload loads an unexpired upload of subject.
+func (h handler) findTusUpload(ctx context.Context, id, subject string) (tusUpload, error) {
+	upload, err := scanTusUpload(h.pool.QueryRow(ctx, `
+		SELECT `+tusUploadColumns+`
+		FROM tus_uploads
+		WHERE id = $1 AND subject = $2`,
+		id,
+		subject,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return upload, huma.Error404NotFound("no such upload")
+	}
+	if err != nil {
+		return upload, err
+	}
+	if upload.Status == constant.TUS_STATUS_UPLOADING && !upload.ExpiresAt.After(time.Now()) {
+		return upload, huma.Error410Gone("upload expired")
+	}
+	return upload, nil
+}
+
+func (h handler) HeadTusUpload(ctx context.Context, request *struct {
+	Id string `path:"id"`
+}) (*struct {
+	UploadOffset  int64  `header:"Upload-Offset"`
+	UploadLength  int64  `header:"Upload-Length"`
+	UploadExpires string `header:"Upload-Expires"`
+	CacheControl  string `header:"Cache-Control"`
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	upload, err := h.findTusUpload(ctx, request.Id, principal.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct {
+		UploadOffset  int64  `header:"Upload-Offset"`
+		UploadLength  int64  `header:"Upload-Length"`
+		UploadExpires string `header:"Upload-Expires"`
+		CacheControl  string `header:"Cache-Control"`
+	}{
+		UploadOffset:  upload.Offset,
+		UploadLength:  upload.Size,
+		UploadExpires: upload.ExpiresAt.UTC().Format(http.TimeFormat),
+		CacheControl:  "no-store",
+	}, nil
+}
+
+// tusChunk is a PATCH request, whose body is read as it arrives rather than
+// buffered whole.
+type tusChunk struct {
+	Id           string `path:"id"`
+	UploadOffset int64  `header:"Upload-Offset" required:"true" minimum:"0"`
+	ContentType  string `header:"Content-Type"`
+
+	body io.Reader
+}
+
+func (c *tusChunk) Resolve(ctx huma.Context) []error {
+	c.body = ctx.BodyReader()
+	return nil
+}
+
+// PatchTusUpload appends a chunk at the offset the upload is at. Whatever
+// arrived of a chunk is kept when the connection drops. Once the last byte
+// is in, the object is assembled and registered like a direct upload, which
+// a PATCH with no data at the final offset retries if that failed.
+func (h handler) PatchTusUpload(ctx context.Context, request *tusChunk) (_ *struct {
+	UploadOffset  int64  `header:"Upload-Offset"`
+	UploadExpires string `header:"Upload-Expires"`
+}, err error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+	if request.ContentType != constant.TUS_CONTENT_TYPE {
+		return nil, huma.Error415UnsupportedMediaType(fmt.Sprintf("chunks must be sent as %s", constant.TUS_CONTENT_TYPE))
+	}
+
+	if _, err := h.findTusUpload(ctx, request.Id, principal.Subject); err != nil {
+		return nil, err
+	}
+	lease, err := h.leaseTusUpload(ctx, request.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer h.releaseTusUpload(ctx, request.Id, lease)
+
+	// read again, an earlier PATCH may have moved it on until the lease
+	upload, err := h.findTusUpload(ctx, request.Id, principal.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if request.UploadOffset != upload.Offset {
+		return nil, huma.Error409Conflict(fmt.Sprintf("upload is at offset %d", upload.Offset))
+	}
+
+	var received error
+	switch upload.Status {
+	case constant.TUS_STATUS_UPLOADING:
+		received = h.receiveTusChunk(ctx, &upload, lease, request.body)
+		if upload.Status != constant.TUS_STATUS_UPLOADED {
+			break
+		}
+		fallthrough
+	case constant.TUS_STATUS_UPLOADED:
+		// successful uploads are audited per document along with their rows
+		defer func() {
+			if err != nil {
+				err = audit.RecordAccess(ctx, h.pool, &audit.Event{
+					Action: constant.AUDIT_ACTION_DOCUMENT_UPLOAD,
+					Detail: map[string]any{"tusUploadId": upload.Id},
+				}, err)
+			}
+		}()
+		if err := h.completeTusUpload(ctx, upload); err != nil {
+			return nil, err
+		}
+	case constant.TUS_STATUS_FAILED:
+		return nil, huma.Error422UnprocessableEntity("upload was refused")
+	}
+	if received != nil {
+		return nil, received
+	}
+
+	return &struct {
+		UploadOffset  int64  `header:"Upload-Offset"`
+		UploadExpires string `header:"Upload-Expires"`
+	}{
+		UploadOffset:  upload.Offset,
+		UploadExpires: upload.ExpiresAt.UTC().Format(http.TimeFormat),
+	}, nil
+}
+
+// leaseTusUpload keeps concurrent PATCH requests of an upload apart without
+// holding a connection for as long as a chunk takes to arrive. The returned
+// lease id identifies the holder, a lease that ran out can be taken over.
+func (h handler) leaseTusUpload(ctx context.Context, id string) (string, error) {
+	lease := ulid.Make().String()
+	now := time.Now()
+	tag, err := h.pool.Exec(ctx, `
+		UPDATE tus_uploads
+		SET locked_until = $2, lease_id = $3
+		WHERE id = $1 AND (locked_until IS NULL OR locked_until < $4)`,
+		id,
+		now.Add(tusLease),
+		lease,
+		now,
+	)
+	if err != nil {
+		return "", err
+	}
+	if tag.RowsAffected() == 0 {
+		return "", huma.Error409Conflict("upload is being written by another request")
+	}
+	return lease, nil
+}
+
+// releaseTusUpload gives up a lease, unless it was taken over meanwhile.
+func (h handler) releaseTusUpload(ctx context.Context, id, lease string) {
+	if _, err := h.pool.Exec(ctx, `
+		UPDATE tus_uploads
+		SET locked_until = NULL, lease_id = NULL
+		WHERE id = $1 AND lease_id = $2`,
+		id,
+		lease,
+	); err != nil {
+		log.Error().Err(err).Str("upload", id).Msg("tus: failed to release upload")
+	}
+}
+
+// receiveTusChunk seals the chunk segment by segment, storing a part every
+// time enough sealed segments piled up, and saving progress along with it.
+// The last part is stored and the multipart upload completed when the final
+// segment is sealed.
+func (h handler) receiveTusChunk(ctx context.Context, upload *tusUpload, lease string, body io.Reader) error {
+	dek, err := h.keyservice.DecryptDataKey(ctx, upload.Edek, upload.DekDigest)
+	if err != nil {
+		return err
+	}
+	sealer, err := cryptography.NewStreamSealer(dek, upload.Header)
+	if err != nil {
+		return err
+	}
+
+	segment := make([]byte, cryptography.StreamSegmentSize)
+	fill := 0
+	if upload.Tail != nil {
+		tail, err := cryptography.DecryptAesGcm(dek, upload.Tail)
+		if err != nil {
+			return err
+		}
+		fill = copy(segment, tail)
+	}
+	counter := uint32((upload.Offset - int64(fill)) / cryptography.StreamSegmentSize)
+
+	save := func() error {
+		upload.Tail = nil
+		if fill > 0 {
+			upload.Tail, err = cryptography.EncryptAesGcm(dek, segment[:fill])
+			if err != nil {
+				return err
+			}
+		}
+		return h.saveTusUpload(ctx, *upload, lease)
+	}
+
+	var received error
+	for upload.Offset < upload.Size {
+		want := min(int64(len(segment)-fill), upload.Size-upload.Offset)
+		n, err := io.ReadFull(body, segment[fill:fill+int(want)])
+		fill += n
+		upload.Offset += int64(n)
+
+		if fill == len(segment) || upload.Offset == upload.Size {
+			final := upload.Offset == upload.Size
+			upload.Pending = sealer.Seal(upload.Pending, counter, final, segment[:fill])
+			counter++
+			fill = 0
+			if len(upload.Pending) >= tusPartSize || final {
+				if err := h.storeTusPart(ctx, upload); err != nil {
+					return err
+				}
+				if !final {
+					if err := save(); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			received = huma.Error400BadRequest(fmt.Sprintf("chunk interrupted at offset %d", upload.Offset))
+			break
+		}
+	}
+
+	if upload.Offset == upload.Size {
+		if err := h.objects.CompleteMultipart(ctx, upload.ObjectKey, upload.MultipartId, completedParts(upload.Parts)); err != nil {
+			return err
+		}
+		upload.Status = constant.TUS_STATUS_UPLOADED
+	}
+	if err := save(); err != nil {
+		return err
+	}
+	return received
+}
+
+func (h handler) storeTusPart(ctx context.Context, upload *tusUpload) error {
+	number := int32(len(upload.Parts) + 1)
+	part, err := h.objects.UploadPart(
+		ctx,
+		upload.ObjectKey,
+		upload.MultipartId,
+		number,
+		bytes.NewReader(upload.Pending),
+		int64(len(upload.Pending)),
+	)
+	if err != nil {
+		return err
+	}
+	upload.Parts = append(upload.Parts, tusPart{Number: part.Number, ETag: part.ETag})
+	upload.Pending = []byte{}
+	return nil
+}
+
+func completedParts(parts []tusPart) []objectstore.Part {
+	completed := make([]objectstore.Part, len(parts))
+	for i, part := range parts {
+		completed[i] = objectstore.Part{Number: part.Number, ETag: part.ETag}
+	}
+	return completed
+}
+
+// saveTusUpload records progress, renewing the lease of the PATCH making it.
+// A PATCH whose lease was taken over records nothing, the progress of the
+// new holder prevails.
+func (h handler) saveTusUpload(ctx context.Context, upload tusUpload, lease string) error {
+	tag, err := h.pool.Exec(ctx, `
+		UPDATE tus_uploads
+		SET status = $2, upload_offset = $3, parts = $4, pending = $5, tail = $6, locked_until = $7
+		WHERE id = $1 AND lease_id = $8`,
+		upload.Id,
+		upload.Status,
+		upload.Offset,
+		upload.Parts,
+		upload.Pending,
+		upload.Tail,
+		time.Now().Add(tusLease),
+		lease,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return huma.Error409Conflict("upload was taken over by another request")
+	}
+	return nil
+}
+
+// completeTusUpload registers an assembled upload. A faulty document fails
+// the upload for good, other errors leave it to be retried.
+func (h handler) completeTusUpload(ctx context.Context, upload tusUpload) error {
+	files, err := h.finalizeStaged(ctx, upload.stagedUpload)
+	if err != nil {
+		var status huma.StatusError
+		if errors.As(err, &status) && status.GetStatus() == http.StatusUnprocessableEntity {
+			if _, err := h.pool.Exec(ctx, `
+				UPDATE tus_uploads
+				SET status = $2, error = $3, completed_at = $4
+				WHERE id = $1`,
+				upload.Id,
+				constant.TUS_STATUS_FAILED,
+				err.Error(),
+				time.Now(),
+			); err != nil {
+				log.Error().Err(err).Str("upload", upload.Id).Msg("tus: failed to fail upload")
+			}
+			h.removeStaged(ctx, upload.stagedUpload)
+		}
+		return err
+	}
+
+	if _, err := h.pool.Exec(ctx, `
+		UPDATE tus_uploads
+		SET status = $2, document_id = $3, pending = '', tail = NULL, completed_at = $4
+		WHERE id = $1`,
+		upload.Id,
+		constant.TUS_STATUS_COMPLETED,
+		files[0].Id,
+		time.Now(),
+	); err != nil {
+		return err
+	}
+	h.removeStaged(ctx, upload.stagedUpload)
+	return quarantineError(files)
+}
+
+// TerminateTusUpload abandons an upload along with whatever was stored of
+// it. Documents it already became are left alone.
+func (h handler) TerminateTusUpload(ctx context.Context, request *struct {
+	Id string `path:"id"`
+}) (*struct{}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	// expired uploads can be terminated still, to free what they hold
+	upload, err := h.findTusUpload(ctx, request.Id, principal.Subject)
+	var status huma.StatusError
+	if err != nil && (!errors.As(err, &status) || status.GetStatus() != http.StatusGone) {
+		return nil, err
+	}
+	lease, err := h.leaseTusUpload(ctx, upload.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.discardTusUpload(ctx, upload, lease); err != nil {
+		h.releaseTusUpload(ctx, upload.Id, lease)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// discardTusUpload frees what is stored of a leased upload and deletes it.
+func (h handler) discardTusUpload(ctx context.Context, upload tusUpload, lease string) error {
+	switch upload.Status {
+	case constant.TUS_STATUS_UPLOADING:
+		err := h.objects.AbortMultipart(ctx, upload.ObjectKey, upload.MultipartId)
+		if err != nil && !errors.Is(err, objectstore.ErrNotFound) {
+			return err
+		}
+	case constant.TUS_STATUS_UPLOADED:
+		h.removeStaged(ctx, upload.stagedUpload)
+	}
+
+	_, err := h.pool.Exec(ctx, `DELETE FROM tus_uploads WHERE id = $1 AND lease_id = $2`, upload.Id, lease)
+	return err
+}
+
+// startTusSweeper discards expired uploads in the background, for clients
+// that never finish nor terminate them.
+func (h handler) startTusSweeper(ctx context.Context) {
+	if !h.config.Tus.Enabled {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(tusSweepInterval)
+		defer ticker.Stop()
+
+		for {
+			for {
+				swept, err := h.sweepNextTusUpload(ctx)
+				if err != nil {
+					log.Error().Err(err).Msg("tus: failed to discard expired upload")
+				}
+				if !swept {
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sweepNextTusUpload leases one expired upload no PATCH holds and discards
+// it. It reports whether an upload was discarded.
+func (h handler) sweepNextTusUpload(ctx context.Context) (bool, error) {
+	lease := ulid.Make().String()
+	now := time.Now()
+	upload, err := scanTusUpload(h.pool.QueryRow(ctx, `
+		UPDATE tus_uploads
+		SET locked_until = $2, lease_id = $3
+		WHERE id = (
+			SELECT id
+			FROM tus_uploads
+			WHERE expires_at <= $1 AND (locked_until IS NULL OR locked_until < $1)
+			ORDER BY expires_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+tusUploadColumns,
+		now,
+		now.Add(tusLease),
+		lease,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := h.discardTusUpload(ctx, upload, lease); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,236 @@
+package knowyourcustomer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/objectstore"
+)
+
+// newTusHandler builds a handler taking resumable uploads into memory, with
+// its state in the test database.
+func newTusHandler(t *testing.T) handler {
+	t.Helper()
+	h := newTestHandler(t, config.Config{
+		Tus: config.Tus{Enabled: true, Ttl: 3600, MaxSize: 16 * 1024 * 1024},
+	})
+	h.pool = testDatabase(t)
+	return h
+}
+
+func createTusUpload(t *testing.T, h handler, ctx context.Context, length int) string {
+	t.Helper()
+	created, err := h.CreateTusUpload(ctx, &struct {
+		UploadLength   int64  `header:"Upload-Length" required:"true" minimum:"8"`
+		UploadMetadata string `header:"Upload-Metadata"`
+	}{
+		UploadLength: int64(length),
+		UploadMetadata: strings.Join([]string{
+			constant.TUS_METADATA_FILENAME + " " + base64.StdEncoding.EncodeToString([]byte("ktp.png")),
+			constant.TUS_METADATA_KIND + " " + base64.StdEncoding.EncodeToString([]byte(constant.DOCUMENT_KIND_KTP)),
+		}, ","),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimPrefix(created.Location, "/tus/")
+}
+
+func patchTusUpload(h handler, ctx context.Context, id string, offset int64, body io.Reader) (int64, error) {
+	patched, err := h.PatchTusUpload(ctx, &tusChunk{
+		Id:           id,
+		UploadOffset: offset,
+		ContentType:  constant.TUS_CONTENT_TYPE,
+		body:         body,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return patched.UploadOffset, nil
+}
+
+func headTusUpload(h handler, ctx context.Context, id string) (int64, error) {
+	head, err := h.HeadTusUpload(ctx, &struct {
+		Id string `path:"id"`
+	}{Id: id})
+	if err != nil {
+		return 0, err
+	}
+	return head.UploadOffset, nil
+}
+
+func multipartIdOf(t *testing.T, h handler, id string) string {
+	t.Helper()
+	var multipartId string
+	if err := h.pool.QueryRow(context.Background(), `SELECT multipart_id FROM tus_uploads WHERE id = $1`, id).Scan(&multipartId); err != nil {
+		t.Fatal(err)
+	}
+	return multipartId
+}
+
+func TestTusUploadResumesAfterInterruption(t *testing.T) {
+	h := newTusHandler(t)
+	ctx := asSubject(context.Background(), "subject-a")
+	// larger than a part, so it is stored in more than one
+	content := testPng(t, 1400, 1300)
+	if len(content) <= tusPartSize {
+		t.Fatalf("content of %d bytes fits a single part", len(content))
+	}
+	id := createTusUpload(t, h, ctx, len(content))
+
+	// the connection drops amid the second segment
+	const dropped = 70_000
+	_, err := patchTusUpload(h, ctx, id, 0, io.MultiReader(
+		bytes.NewReader(content[:dropped]),
+		iotest.ErrReader(errors.New("connection reset")),
+	))
+	requireStatus(t, err, http.StatusBadRequest)
+	offset, err := headTusUpload(h, ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != dropped {
+		t.Fatalf("offset = %d, want what arrived %d", offset, dropped)
+	}
+
+	offset, err = patchTusUpload(h, ctx, id, offset, bytes.NewReader(content[offset:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != int64(len(content)) {
+		t.Fatalf("offset = %d, want %d", offset, len(content))
+	}
+
+	var (
+		status     string
+		documentId string
+	)
+	if err := h.pool.QueryRow(ctx, `SELECT status, document_id FROM tus_uploads WHERE id = $1`, id).Scan(&status, &documentId); err != nil {
+		t.Fatal(err)
+	}
+	if status != constant.TUS_STATUS_COMPLETED {
+		t.Fatalf("status = %q, want %q", status, constant.TUS_STATUS_COMPLETED)
+	}
+	if keys := storedKeys(t, h, constant.UPLOAD_OBJECT_PREFIX); len(keys) != 0 {
+		t.Fatalf("staged objects are left behind: %v", keys)
+	}
+	if downloaded := downloadAsset(t, h, ctx, documentId); !bytes.Equal(downloaded, content) {
+		t.Fatal("document does not download as uploaded")
+	}
+}
+
+func TestTusPatchAtAnotherOffset(t *testing.T) {
+	h := newTusHandler(t)
+	ctx := asSubject(context.Background(), "subject-a")
+	content := testPng(t, 16, 16)
+	id := createTusUpload(t, h, ctx, len(content))
+
+	_, err := patchTusUpload(h, ctx, id, 8, bytes.NewReader(content[8:]))
+	requireStatus(t, err, http.StatusConflict)
+}
+
+func TestTusUploadOfAnotherSubject(t *testing.T) {
+	h := newTusHandler(t)
+	content := testPng(t, 16, 16)
+	id := createTusUpload(t, h, asSubject(context.Background(), "subject-a"), len(content))
+
+	_, err := patchTusUpload(h, asSubject(context.Background(), "subject-b"), id, 0, bytes.NewReader(content))
+	requireStatus(t, err, http.StatusNotFound)
+}
+
+func TestTerminateTusUpload(t *testing.T) {
+	h := newTusHandler(t)
+	ctx := asSubject(context.Background(), "subject-a")
+	content := testPng(t, 160, 120)
+	id := createTusUpload(t, h, ctx, len(content))
+	multipartId := multipartIdOf(t, h, id)
+	if _, err := patchTusUpload(h, ctx, id, 0, iotest.HalfReader(bytes.NewReader(content[:1000]))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.TerminateTusUpload(ctx, &struct {
+		Id string `path:"id"`
+	}{Id: id}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := headTusUpload(h, ctx, id)
+	requireStatus(t, err, http.StatusNotFound)
+	if err := h.objects.AbortMultipart(ctx, constant.UPLOAD_OBJECT_PREFIX+"/"+id, multipartId); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("multipart upload is left open: %v", err)
+	}
+}
+
+func TestTusSweeperDiscardsExpiredUploads(t *testing.T) {
+	h := newTusHandler(t)
+	ctx := asSubject(context.Background(), "subject-a")
+	content := testPng(t, 16, 16)
+	expired := createTusUpload(t, h, ctx, len(content))
+	fresh := createTusUpload(t, h, ctx, len(content))
+	multipartId := multipartIdOf(t, h, expired)
+	if _, err := h.pool.Exec(ctx, `UPDATE tus_uploads SET expires_at = $2 WHERE id = $1`, expired, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	swept, err := h.sweepNextTusUpload(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !swept {
+		t.Fatal("expired upload was not swept")
+	}
+	swept, err = h.sweepNextTusUpload(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swept {
+		t.Fatal("unexpired upload was swept")
+	}
+
+	_, err = headTusUpload(h, ctx, expired)
+	requireStatus(t, err, http.StatusNotFound)
+	if err := h.objects.AbortMultipart(ctx, constant.UPLOAD_OBJECT_PREFIX+"/"+expired, multipartId); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("multipart upload is left open: %v", err)
+	}
+	if _, err := headTusUpload(h, ctx, fresh); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTusSweeperSkipsLeasedUploads(t *testing.T) {
+	h := newTusHandler(t)
+	ctx := asSubject(context.Background(), "subject-a")
+	id := createTusUpload(t, h, ctx, 1024)
+	if _, err := h.pool.Exec(ctx, `UPDATE tus_uploads SET expires_at = $2 WHERE id = $1`, id, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	lease, err := h.leaseTusUpload(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	swept, err := h.sweepNextTusUpload(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swept {
+		t.Fatal("upload was swept under a PATCH")
+	}
+	// the PATCH holding it still saves its progress
+	upload, err := scanTusUpload(h.pool.QueryRow(ctx, `SELECT `+tusUploadColumns+` FROM tus_uploads WHERE id = $1`, id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.saveTusUpload(ctx, upload, lease); err != nil {
+		t.Fatal(err)
+	}
+}
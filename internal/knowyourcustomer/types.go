@@ -1,25 +1,304 @@
 package knowyourcustomer
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/extractor"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/scanner"
+)
 
 type File struct {
-	Filename string
-	Metadata json.RawMessage
+	Id          string
+	Filename    string
+	Kind        string
+	ObjectKey   string
+	LineageId   string
+	PreviousId  *string
+	Version     int
+	IsCurrent   bool
+	Metadata    json.RawMessage
+	Variants    []Variant
+	Scan        scanner.Verdict
+	Fingerprint *Fingerprint
+}
+
+// Fingerprint identifies an upload without being reversible to its content.
+type Fingerprint struct {
+	ContentHmac  string
+	PHash, DHash *uint64
+}
+
+type Variant struct {
+	Id,
+	Variant,
+	ObjectKey string
+}
+
+type Rendition struct {
+	Variant string
+	Content []byte
+}
+
+type Document struct {
+	Id         string    `json:"id"`
+	Filename   string    `json:"filename"`
+	Kind       string    `json:"kind"`
+	Status     string    `json:"status"`
+	ScanStatus string    `json:"scanStatus"`
+	CreatedBy  string    `json:"createdBy"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type DocumentPage struct {
+	Items      []Document `json:"items"`
+	NextCursor string     `json:"nextCursor,omitempty" doc:"Pass as cursor to fetch the next page, absent on the last page"`
+}
+
+type DocumentRecord struct {
+	Id,
+	Filename,
+	Kind,
+	Status,
+	ScanStatus,
+	CreatedBy string
+	Metadata  json.RawMessage
+	CreatedAt time.Time
+	// ObjectKey is where the original upload is stored, flagged uploads live
+	// under the quarantine prefix.
+	ObjectKey  string
+	LineageId  string
+	PreviousId *string
+	Version    int
+	IsCurrent  bool
+}
+
+// DocumentVersion is one upload in the replacement history of a document.
+type DocumentVersion struct {
+	Id         string     `json:"id"`
+	Version    int        `json:"version"`
+	IsCurrent  bool       `json:"isCurrent"`
+	PreviousId *string    `json:"previousId,omitempty" doc:"Version this one replaced"`
+	Filename   string     `json:"filename"`
+	Kind       string     `json:"kind"`
+	Status     string     `json:"status"`
+	ScanStatus string     `json:"scanStatus"`
+	CreatedBy  string     `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	PurgedAt   *time.Time `json:"purgedAt,omitempty"`
+}
+
+type DocumentMetadata struct {
+	Id         string         `json:"id"`
+	Filename   string         `json:"filename"`
+	Kind       string         `json:"kind"`
+	Status     string         `json:"status"`
+	ScanStatus string         `json:"scanStatus"`
+	MimeType   string         `json:"mimeType"`
+	Size       int64          `json:"size" doc:"Plaintext size in bytes"`
+	CreatedBy  string         `json:"createdBy"`
+	UploadedAt time.Time      `json:"uploadedAt"`
+	Metadata   map[string]any `json:"metadata" doc:"Sanitized subset of the extracted file metadata"`
+}
+
+type DocumentHeaders struct {
+	ContentType    string    `header:"Content-Type"`
+	ContentLength  int64     `header:"Content-Length"`
+	LastModified   time.Time `header:"Last-Modified"`
+	Kind           string    `header:"X-Document-Kind"`
+	DocumentStatus string    `header:"X-Document-Status"`
+	ScanStatus     string    `header:"X-Document-Scan-Status"`
+}
+
+type Case struct {
+	Id          string           `json:"id"`
+	Subject     string           `json:"subject"`
+	State       string           `json:"state"`
+	Reviewer    *string          `json:"reviewer,omitempty"`
+	ReasonCode  *string          `json:"reasonCode,omitempty"`
+	ReasonNote  *string          `json:"reasonNote,omitempty"`
+	DocumentIds []string         `json:"documentIds"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	UpdatedAt   time.Time        `json:"updatedAt"`
+	SubmittedAt *time.Time       `json:"submittedAt,omitempty"`
+	ClaimedAt   *time.Time       `json:"claimedAt,omitempty"`
+	LeaseUntil  *time.Time       `json:"leaseUntil,omitempty"`
+	DecidedAt   *time.Time       `json:"decidedAt,omitempty"`
+	History     []CaseTransition `json:"history,omitempty"`
+	Flags       []CaseFlag       `json:"flags,omitempty"`
+}
+
+// CaseFlag is a discrepancy raised on a case for reviewers to look into.
+type CaseFlag struct {
+	Id         string          `json:"id"`
+	DocumentId *string         `json:"documentId,omitempty"`
+	Source     string          `json:"source"`
+	Code       string          `json:"code"`
+	Detail     json.RawMessage `json:"detail"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+type CaseTransition struct {
+	FromState  string    `json:"fromState"`
+	ToState    string    `json:"toState"`
+	Actor      string    `json:"actor"`
+	ReasonCode *string   `json:"reasonCode,omitempty"`
+	ReasonNote *string   `json:"reasonNote,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type CasePage struct {
+	Items      []Case `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty" doc:"Pass as cursor to fetch the next page, absent on the last page"`
+}
+
+type CaseDocumentsRequest struct {
+	DocumentIds []string `json:"documentIds" minItems:"1" maxItems:"20"`
+}
+
+type CaseDecisionRequest struct {
+	Decision   string `json:"decision" enum:"approved,rejected,needs_resubmission"`
+	ReasonCode string `json:"reasonCode,omitempty" enum:"document_unreadable,document_expired,document_mismatch,incomplete_submission,suspected_fraud,other" doc:"Required unless approving"`
+	ReasonNote string `json:"reasonNote,omitempty" maxLength:"1024"`
+}
+
+type QueueStats struct {
+	Depth              int            `json:"depth" doc:"Cases waiting to be claimed, including those with expired leases"`
+	Submitted          int            `json:"submitted"`
+	ExpiredLeases      int            `json:"expiredLeases"`
+	InReview           int            `json:"inReview" doc:"Cases held under an active lease"`
+	OldestWaitingSince *time.Time     `json:"oldestWaitingSince,omitempty"`
+	Reviewers          []ReviewerLoad `json:"reviewers"`
+}
+
+type ReviewerLoad struct {
+	Reviewer     string `json:"reviewer"`
+	ActiveClaims int    `json:"activeClaims"`
+}
+
+type DocumentExtraction struct {
+	DocumentId  string           `json:"documentId"`
+	Status      string           `json:"status"`
+	Attempts    int              `json:"attempts"`
+	Extractor   *string          `json:"extractor,omitempty"`
+	Fields      extractor.Fields `json:"fields,omitempty"`
+	Error       *string          `json:"error,omitempty"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	CompletedAt *time.Time       `json:"completedAt,omitempty"`
+	Edits       []ExtractionEdit `json:"edits,omitempty"`
+}
+
+type ExtractionOverrideRequest struct {
+	Fields map[string]string `json:"fields" minProperties:"1" doc:"New value by field name, an empty value removes the field"`
+	Note   string            `json:"note,omitempty" maxLength:"512"`
+}
+
+// ExtractionEdit is one reviewer override of extracted fields.
+type ExtractionEdit struct {
+	Id        string                 `json:"id"`
+	Editor    string                 `json:"editor"`
+	Note      *string                `json:"note,omitempty"`
+	Changes   map[string]FieldChange `json:"changes"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+type FieldChange struct {
+	From *string `json:"from,omitempty"`
+	To   *string `json:"to,omitempty"`
+}
+
+type SubjectLookupRequest struct {
+	Nik  string `json:"nik,omitempty" pattern:"^[0-9]{16}$"`
+	Name string `json:"name,omitempty" maxLength:"256"`
+	AccessJustification
+}
+
+type DownloadLinkRequest struct {
+	Variant string `json:"variant,omitempty" enum:"original,normalised,preview" default:"original" doc:"Rendition of the document the link downloads"`
+	AccessJustification
+}
+
+// DownloadLink is redeemable once, by anyone holding it, until it expires.
+type DownloadLink struct {
+	Url       string    `json:"url"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// AccessJustification states why a caller reads data of another subject.
+type AccessJustification struct {
+	Purpose string `query:"purpose" json:"purpose,omitempty" maxLength:"64" doc:"Reason for the access, one of the configured access purposes. Required unless the caller owns the data"`
+	Ticket  string `query:"ticket" json:"ticket,omitempty" maxLength:"128" doc:"Reference of the ticket or request the access serves"`
+}
+
+type SubjectIdentity struct {
+	Subject    string    `json:"subject"`
+	Nik        string    `json:"nik"`
+	Name       string    `json:"name,omitempty"`
+	DocumentId *string   `json:"documentId,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+type Consent struct {
+	Id               string     `json:"id"`
+	Subject          string     `json:"subject"`
+	NoticeVersion    string     `json:"noticeVersion"`
+	Channel          string     `json:"channel"`
+	GrantedAt        time.Time  `json:"grantedAt"`
+	WithdrawnAt      *time.Time `json:"withdrawnAt,omitempty"`
+	WithdrawalReason *string    `json:"withdrawalReason,omitempty"`
+}
+
+type ConsentGrantRequest struct {
+	NoticeVersion string `json:"noticeVersion" doc:"Version of the privacy notice the customer accepted"`
+	Channel       string `json:"channel" enum:"web,mobile,branch"`
+}
+
+type ConsentWithdrawalRequest struct {
+	Reason string `json:"reason,omitempty" maxLength:"1024"`
+}
+
+type SubjectExportRequest struct {
+	Password  string `json:"password,omitempty" minLength:"12" maxLength:"256" doc:"Password the archive is encrypted with"`
+	PublicKey string `json:"publicKey,omitempty" maxLength:"8192" doc:"PEM encoded RSA public key of at least 2048 bits the archive password is encrypted to, instead of a password"`
 }
 
-type TransitEncryptRequest struct {
-	Plaintext string `json:"plaintext"`
+type SubjectExport struct {
+	Id              string     `json:"id"`
+	Status          string     `json:"status" enum:"pending,processing,ready,failed,expired"`
+	Recipient       string     `json:"recipient" enum:"password,public_key"`
+	WrappedPassword *string    `json:"wrappedPassword,omitempty" doc:"Base64 encoded archive password, encrypted to the public key with RSA-OAEP and SHA-256"`
+	Size            *int64     `json:"size,omitempty"`
+	Error           *string    `json:"error,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	CompletedAt     *time.Time `json:"completedAt,omitempty"`
+	ExpiresAt       *time.Time `json:"expiresAt,omitempty"`
 }
 
-type TransitEncryptResponse struct {
-	Ciphertext string `json:"ciphertext"`
-	KeyVersion string `json:"key_version"`
-	Reference  string `json:"reference"`
+type UploadSessionRequest struct {
+	Filename  string `json:"filename" minLength:"1" maxLength:"255" pattern:"^[^/\\\\]+$"`
+	Kind      string `json:"kind" enum:"ktp,salary_slip,unknown"`
+	Size      int64  `json:"size" minimum:"8" doc:"Size of the document before encryption, in bytes"`
+	ConsentId string `json:"consentId,omitempty" doc:"Active consent the document is uploaded under"`
+	PublicKey string `json:"publicKey" maxLength:"8192" doc:"PEM encoded RSA public key of at least 2048 bits the data key is encrypted to"`
 }
 
-type SecretKey struct {
-	Data []byte
-	Encoded,
-	DigestEncoded,
-	CiphertextEncoded string
+// UploadSession is a direct upload. The upload URL and wrapped data key are
+// only handed out when the session is opened.
+type UploadSession struct {
+	Id            string            `json:"id"`
+	Status        string            `json:"status" enum:"pending,finalizing,completed,failed"`
+	Filename      string            `json:"filename"`
+	Kind          string            `json:"kind"`
+	Size          int64             `json:"size"`
+	EncryptedSize int64             `json:"encryptedSize" doc:"Size the encrypted object must have"`
+	SegmentSize   int               `json:"segmentSize,omitempty"`
+	WrappedKey    string            `json:"wrappedKey,omitempty" doc:"Base64 encoded AES-256 data key, encrypted to the public key with RSA-OAEP and SHA-256"`
+	UploadUrl     string            `json:"uploadUrl,omitempty" doc:"URL to PUT the encrypted object to"`
+	UploadHeaders map[string]string `json:"uploadHeaders,omitempty" doc:"Headers the PUT must carry as is"`
+	DocumentId    *string           `json:"documentId,omitempty"`
+	Error         *string           `json:"error,omitempty"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	ExpiresAt     time.Time         `json:"expiresAt"`
+	CompletedAt   *time.Time        `json:"completedAt,omitempty"`
 }
@@ -0,0 +1,386 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/cryptography"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/keyservice"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/objectstore"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// UploadEnvelopeFormat documents how clients encrypt directly uploaded
+// documents, it is the format putEncrypted writes.
+const UploadEnvelopeFormat = `The document is encrypted under the session data key, unwrapped with the private key, as a segmented AES-256-GCM stream:
+
+- a 15 bytes header: the ASCII magic "MRS1", the segment size as a big endian uint32, which must be segmentSize, and a random 7 bytes nonce prefix
+- the document cut in segments of segmentSize bytes, the last one possibly shorter and an empty document being a single empty segment, each sealed with no additional data under a 12 bytes nonce made of the nonce prefix, the segment index as a big endian uint32 counting from zero, and a byte set to 1 for the last segment and 0 otherwise
+- every sealed segment, with its 16 bytes tag, following the header in order
+
+The encrypted object must be encryptedSize bytes long.`
+
+const uploadSessionColumns = `id, status, filename, kind, size, document_id, error, created_at, expires_at, completed_at`
+
+func scanUploadSession(row pgx.Row) (UploadSession, error) {
+	var session UploadSession
+	err := row.Scan(
+		&session.Id,
+		&session.Status,
+		&session.Filename,
+		&session.Kind,
+		&session.Size,
+		&session.DocumentId,
+		&session.Error,
+		&session.CreatedAt,
+		&session.ExpiresAt,
+		&session.CompletedAt,
+	)
+	session.EncryptedSize = cryptography.StreamCiphertextSize(session.Size)
+	return session, err
+}
+
+// stagedUpload is an upload session being finalized.
+type stagedUpload struct {
+	Id        string
+	Filename  string
+	Kind      string
+	Size      int64
+	ConsentId *string
+	Edek      string
+	DekDigest string
+	ObjectKey string
+}
+
+// OpenUploadSession hands out a data key, wrapped to the client's public
+// key, and a presigned URL to PUT the document encrypted under it.
+func (h handler) OpenUploadSession(ctx context.Context, request *struct {
+	Body UploadSessionRequest
+}) (_ *struct {
+	Body UploadSession
+}, err error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+	// only stores clients reach directly support direct uploads
+	presigner, ok := h.objects.(objectstore.Presigner)
+	if !h.config.Uploads.Enabled || !ok {
+		return nil, huma.Error404NotFound("direct uploads are not available")
+	}
+	if request.Body.Size > h.config.Uploads.MaxSize {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("documents may not exceed %d bytes", h.config.Uploads.MaxSize))
+	}
+	recipient, err := cryptography.ParseRecipientKey([]byte(request.Body.PublicKey))
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("unusable public key: %s", err))
+	}
+	if err := h.precheckConsent(ctx, request.Body.ConsentId); err != nil {
+		return nil, err
+	}
+
+	keys, err := h.keyservice.GenerateDataKeys(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := cryptography.WrapForRecipient(recipient, keys[0].Data)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ttl := time.Duration(h.config.Uploads.Ttl) * time.Second
+	session := UploadSession{
+		Id:            ulid.Make().String(),
+		Status:        constant.UPLOAD_STATUS_PENDING,
+		Filename:      request.Body.Filename,
+		Kind:          request.Body.Kind,
+		Size:          request.Body.Size,
+		EncryptedSize: cryptography.StreamCiphertextSize(request.Body.Size),
+		SegmentSize:   cryptography.StreamSegmentSize,
+		WrappedKey:    base64.StdEncoding.EncodeToString(wrapped),
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(ttl),
+	}
+	objectKey := fmt.Sprintf("%s/%s", constant.UPLOAD_OBJECT_PREFIX, session.Id)
+
+	// the signed content length holds the client to the announced size
+	presigned, err := presigner.PresignPut(ctx, objectKey, session.EncryptedSize, ttl)
+	if err != nil {
+		return nil, err
+	}
+	session.UploadUrl = presigned.Url
+	session.UploadHeaders = presigned.Headers
+
+	if _, err := h.pool.Exec(ctx, `
+		INSERT INTO upload_sessions (
+			id, subject, status, filename, kind, size, consent_id, edek, dek_digest, object_key, created_at, expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		session.Id,
+		principal.Subject,
+		session.Status,
+		session.Filename,
+		session.Kind,
+		session.Size,
+		nullableString(request.Body.ConsentId),
+		keys[0].CiphertextEncoded,
+		keys[0].DigestEncoded,
+		objectKey,
+		session.CreatedAt,
+		session.ExpiresAt,
+	); err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body UploadSession }{Body: session}, nil
+}
+
+func (h handler) GetUploadSession(ctx context.Context, request *struct {
+	Id string `path:"id"`
+}) (*struct {
+	Body UploadSession
+}, error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+
+	session, err := scanUploadSession(h.pool.QueryRow(ctx, `
+		SELECT `+uploadSessionColumns+`
+		FROM upload_sessions
+		WHERE id = $1 AND subject = $2`,
+		request.Id,
+		principal.Subject,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, huma.Error404NotFound("no such upload session")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body UploadSession }{Body: session}, nil
+}
+
+// FinalizeUploadSession verifies the object put by the client, which must
+// have the announced size and open under the session key, and then runs it
+// through the same pipeline as a regular upload. A session whose object is
+// found faulty fails for good, other errors leave it open for a retry.
+func (h handler) FinalizeUploadSession(ctx context.Context, request *struct {
+	Id string `path:"id"`
+}) (_ *struct {
+	Body UploadSession
+}, err error) {
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+	// successful uploads are audited per document along with their rows
+	defer func() {
+		if err != nil {
+			err = audit.RecordAccess(ctx, h.pool, &audit.Event{
+				Action: constant.AUDIT_ACTION_DOCUMENT_UPLOAD,
+				Detail: map[string]any{"uploadSessionId": request.Id},
+			}, err)
+		}
+	}()
+
+	staged, err := h.claimUploadSession(ctx, request.Id, principal.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := h.finalizeStaged(ctx, staged)
+	if err != nil {
+		var status huma.StatusError
+		if errors.As(err, &status) && status.GetStatus() == http.StatusUnprocessableEntity {
+			h.failUploadSession(ctx, staged, err)
+		} else {
+			h.releaseUploadSession(ctx, staged)
+		}
+		return nil, err
+	}
+
+	session, err := scanUploadSession(h.pool.QueryRow(ctx, `
+		UPDATE upload_sessions
+		SET status = $2, document_id = $3, completed_at = $4
+		WHERE id = $1
+		RETURNING `+uploadSessionColumns,
+		staged.Id,
+		constant.UPLOAD_STATUS_COMPLETED,
+		files[0].Id,
+		time.Now(),
+	))
+	if err != nil {
+		return nil, err
+	}
+	h.removeStaged(ctx, staged)
+	if err := quarantineError(files); err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body UploadSession }{Body: session}, nil
+}
+
+// claimUploadSession moves an open session of subject to finalizing, so
+// concurrent finalize calls do not register the document twice.
+func (h handler) claimUploadSession(ctx context.Context, id, subject string) (stagedUpload, error) {
+	staged := stagedUpload{Id: id}
+	err := h.pool.QueryRow(ctx, `
+		UPDATE upload_sessions
+		SET status = $3
+		WHERE id = $1 AND subject = $2 AND status = $4 AND expires_at > $5
+		RETURNING filename, kind, size, consent_id, edek, dek_digest, object_key`,
+		id,
+		subject,
+		constant.UPLOAD_STATUS_FINALIZING,
+		constant.UPLOAD_STATUS_PENDING,
+		time.Now(),
+	).Scan(
+		&staged.Filename,
+		&staged.Kind,
+		&staged.Size,
+		&staged.ConsentId,
+		&staged.Edek,
+		&staged.DekDigest,
+		&staged.ObjectKey,
+	)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return staged, err
+	}
+
+	var (
+		status    string
+		expiresAt time.Time
+	)
+	err = h.pool.QueryRow(ctx, `
+		SELECT status, expires_at
+		FROM upload_sessions
+		WHERE id = $1 AND subject = $2`,
+		id,
+		subject,
+	).Scan(&status, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return staged, huma.Error404NotFound("no such upload session")
+	}
+	if err != nil {
+		return staged, err
+	}
+	if status == constant.UPLOAD_STATUS_PENDING {
+		return staged, huma.Error410Gone("upload session expired")
+	}
+	return staged, huma.Error409Conflict(fmt.Sprintf("upload session is %s", status))
+}
+
+func (h handler) finalizeStaged(ctx context.Context, staged stagedUpload) ([]File, error) {
+	head, err := h.objects.Head(ctx, staged.ObjectKey)
+	if errors.Is(err, objectstore.ErrNotFound) {
+		return nil, huma.Error409Conflict("the document was not uploaded yet")
+	}
+	if err != nil {
+		return nil, err
+	}
+	encryptedSize := cryptography.StreamCiphertextSize(staged.Size)
+	if head.Size != encryptedSize {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf(
+			"uploaded object is %d bytes, expected %d", head.Size, encryptedSize,
+		))
+	}
+
+	dek, err := h.keyservice.DecryptDataKey(ctx, staged.Edek, staged.DekDigest)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := h.objects.Get(ctx, staged.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+
+	reader, err := cryptography.NewStreamReader(dek, io.LimitReader(obj.Body, encryptedSize))
+	if errors.Is(err, cryptography.ErrStreamCorrupted) {
+		return nil, huma.Error422UnprocessableEntity("uploaded object does not follow the envelope format")
+	}
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(reader)
+	if errors.Is(err, cryptography.ErrStreamCorrupted) {
+		return nil, huma.Error422UnprocessableEntity("uploaded object does not open under the session key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) != staged.Size {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf(
+			"uploaded document is %d bytes, announced %d", len(content), staged.Size,
+		))
+	}
+	if !acceptedSignature(staged.Kind, content) {
+		return nil, huma.Error422UnprocessableEntity("invalid file bytes signature")
+	}
+
+	var consentId string
+	if staged.ConsentId != nil {
+		consentId = *staged.ConsentId
+	}
+	return h.ingest(ctx, []upload{{
+		Filename: staged.Filename,
+		Kind:     staged.Kind,
+		Content:  content,
+		Staged:   staged.ObjectKey,
+		Key: &keyservice.SecretKey{
+			Data:              dek,
+			CiphertextEncoded: staged.Edek,
+			DigestEncoded:     staged.DekDigest,
+		},
+	}}, consentId)
+}
+
+// failUploadSession gives up on a session whose object is faulty, along with
+// the object.
+func (h handler) failUploadSession(ctx context.Context, staged stagedUpload, cause error) {
+	if _, err := h.pool.Exec(ctx, `
+		UPDATE upload_sessions
+		SET status = $2, error = $3, completed_at = $4
+		WHERE id = $1`,
+		staged.Id,
+		constant.UPLOAD_STATUS_FAILED,
+		cause.Error(),
+		time.Now(),
+	); err != nil {
+		log.Error().Err(err).Str("session", staged.Id).Msg("upload: failed to fail session")
+	}
+	h.removeStaged(ctx, staged)
+}
+
+func (h handler) removeStaged(ctx context.Context, staged stagedUpload) {
+	if err := h.objects.Delete(ctx, staged.ObjectKey); err != nil {
+		log.Warn().Err(err).Str("key", staged.ObjectKey).Msg("upload: failed to remove staged object")
+	}
+}
+
+func (h handler) releaseUploadSession(ctx context.Context, staged stagedUpload) {
+	if _, err := h.pool.Exec(ctx, `
+		UPDATE upload_sessions
+		SET status = $2
+		WHERE id = $1 AND status = $3`,
+		staged.Id,
+		constant.UPLOAD_STATUS_PENDING,
+		constant.UPLOAD_STATUS_FINALIZING,
+	); err != nil {
+		log.Error().Err(err).Str("session", staged.Id).Msg("upload: failed to release session")
+	}
+}
@@ -0,0 +1,141 @@
+package knowyourcustomer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/config"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/cryptography"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/objectstore"
+	"github.com/oklog/ulid/v2"
+)
+
+// stageSealed seals content the way clients do for direct uploads, under a
+// fresh session key, and stores it through a multipart upload of partSize
+// parts as tus does. It returns the session the object was staged for.
+func stageSealed(t *testing.T, h handler, content []byte, partSize int) stagedUpload {
+	t.Helper()
+	ctx := context.Background()
+	keys, err := h.keyservice.GenerateDataKeys(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := cryptography.NewStreamHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealer, err := cryptography.NewStreamSealer(keys[0].Data, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := header
+	for counter := 0; counter*cryptography.StreamSegmentSize < len(content); counter++ {
+		start := counter * cryptography.StreamSegmentSize
+		end := min(start+cryptography.StreamSegmentSize, len(content))
+		sealed = sealer.Seal(sealed, uint32(counter), end == len(content), content[start:end])
+	}
+
+	staged := stagedUpload{
+		Id:        ulid.Make().String(),
+		Filename:  "ktp.png",
+		Kind:      constant.DOCUMENT_KIND_KTP,
+		Size:      int64(len(content)),
+		Edek:      keys[0].CiphertextEncoded,
+		DekDigest: keys[0].DigestEncoded,
+	}
+	staged.ObjectKey = constant.UPLOAD_OBJECT_PREFIX + "/" + staged.Id
+
+	multipartId, err := h.objects.CreateMultipart(ctx, staged.ObjectKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make([]objectstore.Part, 0)
+	for start := 0; start < len(sealed); start += partSize {
+		part := sealed[start:min(start+partSize, len(sealed))]
+		stored, err := h.objects.UploadPart(ctx, staged.ObjectKey, multipartId, int32(len(parts)+1), bytes.NewReader(part), int64(len(part)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, stored)
+	}
+	if err := h.objects.CompleteMultipart(ctx, staged.ObjectKey, multipartId, parts); err != nil {
+		t.Fatal(err)
+	}
+	return staged
+}
+
+func requireStatus(t *testing.T, err error, want int) {
+	t.Helper()
+	var status huma.StatusError
+	if !errors.As(err, &status) || status.GetStatus() != want {
+		t.Fatalf("err = %v, want %d", err, want)
+	}
+}
+
+func TestFinalizeStagedUpload(t *testing.T) {
+	h := newTestHandler(t, config.Config{})
+	// spans several segments, split into parts across segment boundaries
+	content := testPng(t, 160, 120)
+	staged := stageSealed(t, h, content, 100_000)
+
+	files, err := h.finalizeStaged(context.Background(), staged)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the client's ciphertext is copied into place, not sealed again
+	stored, metadata := storedObject(t, h, files[0].ObjectKey)
+	uploaded, _ := storedObject(t, h, staged.ObjectKey)
+	if !bytes.Equal(stored, uploaded) || metadata[constant.EDEK_HEADER] != staged.Edek {
+		t.Fatal("document is not the staged ciphertext under the session key")
+	}
+	plaintext, err := h.getDecrypted(context.Background(), files[0].ObjectKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, content) {
+		t.Fatal("document does not decrypt to the upload")
+	}
+}
+
+func TestFinalizeStagedRefusesTamperedObject(t *testing.T) {
+	h := newTestHandler(t, config.Config{})
+	staged := stageSealed(t, h, testPng(t, 160, 120), 100_000)
+
+	sealed, metadata := storedObject(t, h, staged.ObjectKey)
+	sealed[len(sealed)/2] ^= 0x01
+	if err := h.objects.Put(context.Background(), staged.ObjectKey, bytes.NewReader(sealed), int64(len(sealed)), objectstore.PutOptions{
+		Metadata: metadata,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := h.finalizeStaged(context.Background(), staged)
+	requireStatus(t, err, http.StatusUnprocessableEntity)
+	if keys := storedKeys(t, h, constant.DOCUMENT_OBJECT_PREFIX); len(keys) != 0 {
+		t.Fatalf("tampered upload was stored as %v", keys)
+	}
+}
+
+func TestFinalizeStagedRefusesOtherSize(t *testing.T) {
+	h := newTestHandler(t, config.Config{})
+	staged := stageSealed(t, h, testPng(t, 160, 120), 100_000)
+	staged.Size--
+
+	_, err := h.finalizeStaged(context.Background(), staged)
+	requireStatus(t, err, http.StatusUnprocessableEntity)
+}
+
+func TestFinalizeStagedBeforeUpload(t *testing.T) {
+	h := newTestHandler(t, config.Config{})
+	staged := stageSealed(t, h, testPng(t, 16, 16), 100_000)
+	h.removeStaged(context.Background(), staged)
+
+	_, err := h.finalizeStaged(context.Background(), staged)
+	requireStatus(t, err, http.StatusConflict)
+}
@@ -0,0 +1,54 @@
+package knowyourcustomer
+
+import (
+	"fmt"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/imaging"
+)
+
+// renditionVariants are produced in this order for every uploaded image, each
+// sealed with its own DEK.
+var renditionVariants = []string{constant.VARIANT_NORMALISED, constant.VARIANT_PREVIEW}
+
+func variantObjectKey(variant, filename string) string {
+	return fmt.Sprintf("%s/%s/%s", constant.VARIANT_OBJECT_PREFIX, variant, filename)
+}
+
+// renderVariants builds the normalised rendition (upright, size-capped and
+// re-encoded, which also drops every embedded metadata chunk) and the
+// watermarked preview from the original upload.
+func (h handler) renderVariants(raw []byte, exifFields map[string]interface{}) ([]Rendition, error) {
+	img, err := imaging.Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	img = imaging.Orient(img, imaging.ParseOrientation(exifFields["Orientation"]))
+
+	normalised, err := imaging.Fit(img, h.config.Variants.MaxDimension)
+	if err != nil {
+		return nil, err
+	}
+	normalisedRaw, err := imaging.EncodePNG(normalised)
+	if err != nil {
+		return nil, err
+	}
+
+	preview, err := imaging.Fit(normalised, h.config.Variants.PreviewDimension)
+	if err != nil {
+		return nil, err
+	}
+	preview, err = imaging.Watermark(preview, h.config.Variants.PreviewWatermark)
+	if err != nil {
+		return nil, err
+	}
+	previewRaw, err := imaging.EncodePNG(preview)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Rendition{
+		{Variant: constant.VARIANT_NORMALISED, Content: normalisedRaw},
+		{Variant: constant.VARIANT_PREVIEW, Content: previewRaw},
+	}, nil
+}
@@ -0,0 +1,160 @@
+package knowyourcustomer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/audit"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+)
+
+// ReplaceAsset uploads a new version of a document, e.g. a sharper photo of
+// the same KTP. Replaced versions stay stored, encrypted, for the record.
+func (h handler) ReplaceAsset(ctx context.Context, request *struct {
+	Id      string `path:"id" doc:"Document id, or the filename of its latest upload"`
+	RawBody multipart.Form
+}) (_ *struct {
+	Body DocumentVersion
+}, err error) {
+	// successful replacements are audited along with their rows
+	defer func() {
+		if err != nil {
+			err = audit.RecordAccess(ctx, h.pool, &audit.Event{
+				Action: constant.AUDIT_ACTION_DOCUMENT_REPLACE,
+				Detail: map[string]any{"reference": request.Id},
+			}, err)
+		}
+	}()
+
+	principal, ok := ctx.Value(constant.CONTEXT_KEY_PRINCIPAL).(*oidc.IDToken)
+	if !ok {
+		return nil, errors.New("missing principal token in context")
+	}
+	document, err := h.findDocument(ctx, request.Id)
+	if err != nil {
+		return nil, err
+	}
+	// only uploaders replace their documents, reviewers ask them to
+	if document.CreatedBy != principal.Subject {
+		return nil, huma.Error404NotFound(fmt.Sprintf("no document %s", request.Id))
+	}
+	if !document.IsCurrent {
+		return nil, huma.Error409Conflict(fmt.Sprintf("document %s was already replaced", document.Id))
+	}
+
+	attachments := request.RawBody.File[constant.MULTIPART_KEY_ATTACHMENTS]
+	if len(attachments) != 1 {
+		return nil, huma.Error400BadRequest(fmt.Sprintf("expected exactly one %s file", constant.MULTIPART_KEY_ATTACHMENTS))
+	}
+	var consentId string
+	if values := request.RawBody.Value[constant.MULTIPART_KEY_CONSENT]; len(values) > 0 {
+		consentId = values[0]
+	}
+	if err := h.precheckConsent(ctx, consentId); err != nil {
+		return nil, err
+	}
+
+	file, err := attachments[0].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	content := new(bytes.Buffer)
+	if _, err := io.Copy(content, file); err != nil {
+		return nil, err
+	}
+
+	files, err := h.ingest(ctx, []upload{{
+		Filename: attachments[0].Filename,
+		Kind:     document.Kind,
+		Content:  content.Bytes(),
+		Replaces: &document,
+	}}, consentId)
+	if err != nil {
+		return nil, err
+	}
+	if err := quarantineError(files); err != nil {
+		return nil, err
+	}
+
+	replacement, err := h.findDocument(ctx, files[0].Id)
+	if err != nil {
+		return nil, err
+	}
+	return &struct{ Body DocumentVersion }{Body: DocumentVersion{
+		Id:         replacement.Id,
+		Version:    replacement.Version,
+		IsCurrent:  replacement.IsCurrent,
+		PreviousId: replacement.PreviousId,
+		Filename:   replacement.Filename,
+		Kind:       replacement.Kind,
+		Status:     replacement.Status,
+		ScanStatus: replacement.ScanStatus,
+		CreatedBy:  replacement.CreatedBy,
+		CreatedAt:  replacement.CreatedAt,
+	}}, nil
+}
+
+// ListAssetVersions lists every version of a document, latest first,
+// whichever of them is referenced.
+func (h handler) ListAssetVersions(ctx context.Context, request *struct {
+	Id string `path:"id" doc:"Id of any version of the document, or the filename of its latest upload"`
+}) (_ *struct {
+	Body []DocumentVersion
+}, err error) {
+	event := &audit.Event{
+		Action: constant.AUDIT_ACTION_DOCUMENT_VERSIONS,
+		Detail: map[string]any{"reference": request.Id},
+	}
+	defer func() { err = audit.RecordAccess(ctx, h.pool, event, err) }()
+
+	document, err := h.findDocument(ctx, request.Id)
+	if err != nil {
+		return nil, err
+	}
+	event.DocumentId = document.Id
+	if err := h.authorizeOwnerOrReviewer(ctx, document); err != nil {
+		return nil, err
+	}
+
+	rows, err := h.pool.Query(ctx, `
+		SELECT id, version, is_current, previous_id, filename, kind, status, scan_status,
+			created_by, created_at, purged_at
+		FROM documents
+		WHERE lineage_id = $1
+		ORDER BY version DESC`,
+		document.LineageId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (DocumentVersion, error) {
+		var version DocumentVersion
+		err := row.Scan(
+			&version.Id,
+			&version.Version,
+			&version.IsCurrent,
+			&version.PreviousId,
+			&version.Filename,
+			&version.Kind,
+			&version.Status,
+			&version.ScanStatus,
+			&version.CreatedBy,
+			&version.CreatedAt,
+			&version.PurgedAt,
+		)
+		return version, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &struct{ Body []DocumentVersion }{Body: versions}, nil
+}
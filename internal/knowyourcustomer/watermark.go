@@ -0,0 +1,107 @@
+package knowyourcustomer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/constant"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/extractor"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/imaging"
+	"github.com/mirzahilmi/modalrakyat-hardened/internal/common/middleware"
+	"github.com/oklog/ulid/v2"
+)
+
+func (h handler) mustWatermark(ctx context.Context) bool {
+	if !h.config.Watermark.Visible && !h.config.Watermark.Invisible {
+		return false
+	}
+	return middleware.HasRole(ctx, h.config.Watermark.Roles...)
+}
+
+// watermarkCopy marks a decrypted document for the subject it is handed to
+// and records the issued watermark, whose ULID is what the invisible
+// identifier carries, so a leaked copy can be traced back to this download.
+// It returns the marked copy and the watermark id, for the download's audit
+// event to carry.
+func (h handler) watermarkCopy(
+	ctx context.Context,
+	documentId,
+	variant,
+	requestedBy,
+	purpose string,
+	plaintext []byte,
+) ([]byte, string, error) {
+	if purpose == "" {
+		purpose = "unspecified"
+	}
+
+	id := ulid.Make()
+	now := time.Now()
+
+	var (
+		marked []byte
+		err    error
+	)
+	if extractor.IsPdf(plaintext) {
+		marked = markPdf(plaintext, id)
+	} else {
+		marked, err = h.markImage(plaintext, id, requestedBy, now, purpose)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if _, err := h.pool.Exec(ctx, `
+		INSERT INTO document_watermarks (id, document_id, variant, requested_by, purpose, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		id.String(),
+		documentId,
+		variant,
+		requestedBy,
+		purpose,
+		now,
+	); err != nil {
+		return nil, "", err
+	}
+
+	return marked, id.String(), nil
+}
+
+func (h handler) markImage(plaintext []byte, id ulid.ULID, subject string, now time.Time, purpose string) ([]byte, error) {
+	img, err := imaging.Decode(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("watermark: unsupported document format: %w", err)
+	}
+
+	if h.config.Watermark.Visible {
+		img, err = imaging.Watermark(img,
+			subject,
+			now.UTC().Format(time.RFC3339),
+			fmt.Sprintf("purpose: %s", purpose),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if h.config.Watermark.Invisible {
+		img, err = imaging.EmbedIdentifier(img, id.Bytes())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return imaging.EncodePNG(img)
+}
+
+// markPdf appends the watermark ULID as a comment after the end of the PDF,
+// which readers ignore. Overlaying visible text would mean rewriting the page
+// content streams, so PDFs only ever carry this trailing identifier.
+func markPdf(plaintext []byte, id ulid.ULID) []byte {
+	marked := make([]byte, 0, len(plaintext)+len(constant.PDF_WATERMARK_COMMENT)+ulid.EncodedSize+2)
+	marked = append(marked, plaintext...)
+	marked = append(marked, '\n')
+	marked = append(marked, constant.PDF_WATERMARK_COMMENT...)
+	marked = append(marked, id.String()...)
+	return append(marked, '\n')
+}
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE document_variants
+(
+    id          TEXT PRIMARY KEY NOT NULL,
+    document_id TEXT             NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    variant     TEXT             NOT NULL,
+    object_key  TEXT             NOT NULL,
+    created_at  TIMESTAMP        NOT NULL,
+    UNIQUE (document_id, variant)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE document_variants;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE document_watermarks
+(
+    id           TEXT PRIMARY KEY NOT NULL,
+    document_id  TEXT             NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    variant      TEXT             NOT NULL,
+    requested_by TEXT             NOT NULL,
+    purpose      TEXT             NOT NULL,
+    created_at   TIMESTAMP        NOT NULL
+);
+CREATE INDEX document_watermarks_document_id_idx ON document_watermarks (document_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE document_watermarks;
+-- +goose StatementEnd
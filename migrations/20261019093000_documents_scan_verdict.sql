@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE documents
+    ADD COLUMN scan_status    TEXT NOT NULL DEFAULT 'unscanned',
+    ADD COLUMN scan_signature TEXT,
+    ADD COLUMN scanned_at     TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+ALTER TABLE documents
+    DROP COLUMN scan_status,
+    DROP COLUMN scan_signature,
+    DROP COLUMN scanned_at;
+-- +goose StatementEnd
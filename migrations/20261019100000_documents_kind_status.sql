@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE documents
+    ADD COLUMN kind   TEXT NOT NULL DEFAULT 'unknown',
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'pending';
+CREATE INDEX documents_created_by_id_idx ON documents (created_by, id DESC);
+CREATE INDEX documents_kind_status_idx ON documents (kind, status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX documents_kind_status_idx;
+DROP INDEX documents_created_by_id_idx;
+ALTER TABLE documents
+    DROP COLUMN kind,
+    DROP COLUMN status;
+-- +goose StatementEnd
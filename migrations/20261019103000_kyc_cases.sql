@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE kyc_cases
+(
+    id           TEXT PRIMARY KEY NOT NULL,
+    subject      TEXT UNIQUE      NOT NULL,
+    state        TEXT             NOT NULL,
+    reviewer     TEXT,
+    reason_code  TEXT,
+    reason_note  TEXT,
+    created_at   TIMESTAMP        NOT NULL,
+    updated_at   TIMESTAMP        NOT NULL,
+    submitted_at TIMESTAMP,
+    claimed_at   TIMESTAMP,
+    decided_at   TIMESTAMP
+);
+CREATE INDEX kyc_cases_state_submitted_at_idx ON kyc_cases (state, submitted_at);
+
+CREATE TABLE kyc_case_documents
+(
+    case_id     TEXT NOT NULL REFERENCES kyc_cases (id) ON DELETE CASCADE,
+    document_id TEXT NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    PRIMARY KEY (case_id, document_id)
+);
+
+CREATE TABLE kyc_case_transitions
+(
+    id          TEXT PRIMARY KEY NOT NULL,
+    case_id     TEXT             NOT NULL REFERENCES kyc_cases (id) ON DELETE CASCADE,
+    from_state  TEXT             NOT NULL,
+    to_state    TEXT             NOT NULL,
+    actor       TEXT             NOT NULL,
+    reason_code TEXT,
+    reason_note TEXT,
+    created_at  TIMESTAMP        NOT NULL
+);
+CREATE INDEX kyc_case_transitions_case_id_idx ON kyc_case_transitions (case_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE kyc_case_transitions;
+DROP TABLE kyc_case_documents;
+DROP TABLE kyc_cases;
+-- +goose StatementEnd
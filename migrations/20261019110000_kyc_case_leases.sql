@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE kyc_cases
+    ADD COLUMN lease_expires_at TIMESTAMP;
+CREATE INDEX kyc_cases_reviewer_lease_idx ON kyc_cases (reviewer, lease_expires_at) WHERE state = 'in_review';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX kyc_cases_reviewer_lease_idx;
+ALTER TABLE kyc_cases
+    DROP COLUMN lease_expires_at;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE document_extractions
+(
+    document_id  TEXT PRIMARY KEY NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    status       TEXT             NOT NULL,
+    attempts     INTEGER          NOT NULL DEFAULT 0,
+    extractor    TEXT,
+    fields       BYTEA,
+    edek         TEXT,
+    dek_digest   TEXT,
+    error        TEXT,
+    created_at   TIMESTAMP        NOT NULL,
+    started_at   TIMESTAMP,
+    completed_at TIMESTAMP
+);
+CREATE INDEX document_extractions_status_created_at_idx ON document_extractions (status, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE document_extractions;
+-- +goose StatementEnd
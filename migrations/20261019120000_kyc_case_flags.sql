@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE kyc_case_flags
+(
+    id          TEXT PRIMARY KEY NOT NULL,
+    case_id     TEXT             NOT NULL REFERENCES kyc_cases (id) ON DELETE CASCADE,
+    document_id TEXT REFERENCES documents (id) ON DELETE CASCADE,
+    source      TEXT             NOT NULL,
+    code        TEXT             NOT NULL,
+    detail      JSONB            NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMP        NOT NULL
+);
+CREATE INDEX kyc_case_flags_case_id_idx ON kyc_case_flags (case_id, source);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE kyc_case_flags;
+-- +goose StatementEnd
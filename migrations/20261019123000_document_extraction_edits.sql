@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE document_extraction_edits
+(
+    id          TEXT PRIMARY KEY NOT NULL,
+    document_id TEXT             NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    editor      TEXT             NOT NULL,
+    note        TEXT,
+    changes     BYTEA            NOT NULL,
+    edek        TEXT             NOT NULL,
+    dek_digest  TEXT             NOT NULL,
+    created_at  TIMESTAMP        NOT NULL
+);
+CREATE INDEX document_extraction_edits_document_id_idx ON document_extraction_edits (document_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE document_extraction_edits;
+-- +goose StatementEnd
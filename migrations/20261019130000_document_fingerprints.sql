@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE document_fingerprints
+(
+    document_id  TEXT PRIMARY KEY NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    created_by   TEXT             NOT NULL,
+    content_hmac TEXT             NOT NULL,
+    phash        BIGINT,
+    dhash        BIGINT,
+    phash_bands  INTEGER[],
+    created_at   TIMESTAMP        NOT NULL
+);
+CREATE INDEX document_fingerprints_content_hmac_idx ON document_fingerprints (content_hmac);
+CREATE INDEX document_fingerprints_phash_bands_idx ON document_fingerprints USING GIN (phash_bands);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE document_fingerprints;
+-- +goose StatementEnd
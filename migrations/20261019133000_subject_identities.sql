@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE subject_identities
+(
+    subject     TEXT PRIMARY KEY NOT NULL,
+    document_id TEXT REFERENCES documents (id) ON DELETE SET NULL,
+    nik         BYTEA            NOT NULL,
+    nik_index   BYTEA            NOT NULL,
+    name        BYTEA,
+    name_index  BYTEA,
+    updated_at  TIMESTAMP        NOT NULL
+);
+CREATE INDEX subject_identities_nik_index_idx ON subject_identities (nik_index);
+CREATE INDEX subject_identities_name_index_idx ON subject_identities (name_index);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE subject_identities;
+-- +goose StatementEnd
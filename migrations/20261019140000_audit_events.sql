@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE audit_events
+(
+    seq          BIGINT PRIMARY KEY NOT NULL,
+    id           TEXT UNIQUE        NOT NULL,
+    action       TEXT               NOT NULL,
+    subject      TEXT,
+    client_ip    TEXT,
+    user_agent   TEXT,
+    operation_id TEXT,
+    document_id  TEXT,
+    case_id      TEXT,
+    outcome      TEXT               NOT NULL,
+    purpose      TEXT,
+    detail       TEXT,
+    created_at   TIMESTAMP          NOT NULL,
+    prev_hash    BYTEA              NOT NULL,
+    hash         BYTEA              NOT NULL
+);
+CREATE INDEX audit_events_document_id_idx ON audit_events (document_id, seq);
+CREATE INDEX audit_events_subject_idx ON audit_events (subject, seq);
+
+CREATE FUNCTION audit_events_append_only() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE
+    ON audit_events
+    FOR EACH STATEMENT
+EXECUTE FUNCTION audit_events_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only;
+-- +goose StatementEnd
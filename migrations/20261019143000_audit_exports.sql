@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE audit_exports
+(
+    id           TEXT PRIMARY KEY NOT NULL,
+    requested_by TEXT             NOT NULL,
+    format       TEXT             NOT NULL,
+    manifest     TEXT             NOT NULL,
+    signature    TEXT             NOT NULL,
+    created_at   TIMESTAMP        NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE audit_exports;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE documents
+    ADD COLUMN retention_until   TIMESTAMP,
+    ADD COLUMN legal_hold        BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN legal_hold_reason TEXT,
+    ADD COLUMN legal_hold_by     TEXT,
+    ADD COLUMN legal_hold_at     TIMESTAMP,
+    ADD COLUMN purged_at         TIMESTAMP;
+CREATE INDEX documents_retention_until_idx ON documents (retention_until)
+    WHERE NOT legal_hold AND purged_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX documents_retention_until_idx;
+ALTER TABLE documents
+    DROP COLUMN retention_until,
+    DROP COLUMN legal_hold,
+    DROP COLUMN legal_hold_reason,
+    DROP COLUMN legal_hold_by,
+    DROP COLUMN legal_hold_at,
+    DROP COLUMN purged_at;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE consents
+(
+    id                TEXT PRIMARY KEY NOT NULL,
+    subject           TEXT             NOT NULL,
+    notice_version    TEXT             NOT NULL,
+    channel           TEXT             NOT NULL,
+    granted_at        TIMESTAMP        NOT NULL,
+    withdrawn_at      TIMESTAMP,
+    withdrawal_reason TEXT
+);
+CREATE INDEX consents_subject_id_idx ON consents (subject, id DESC);
+
+ALTER TABLE documents
+    ADD COLUMN consent_id TEXT REFERENCES consents (id);
+CREATE INDEX documents_consent_id_idx ON documents (consent_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX documents_consent_id_idx;
+ALTER TABLE documents
+    DROP COLUMN consent_id;
+DROP TABLE consents;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE subject_exports
+(
+    id               TEXT PRIMARY KEY NOT NULL,
+    subject          TEXT             NOT NULL,
+    status           TEXT             NOT NULL,
+    recipient        TEXT             NOT NULL,
+    password         BYTEA,
+    edek             TEXT,
+    dek_digest       TEXT,
+    public_key       TEXT,
+    wrapped_password TEXT,
+    object_key       TEXT,
+    size             BIGINT,
+    attempts         INTEGER          NOT NULL DEFAULT 0,
+    error            TEXT,
+    created_at       TIMESTAMP        NOT NULL,
+    started_at       TIMESTAMP,
+    completed_at     TIMESTAMP,
+    expires_at       TIMESTAMP
+);
+CREATE INDEX subject_exports_subject_id_idx ON subject_exports (subject, id DESC);
+CREATE INDEX subject_exports_status_created_at_idx ON subject_exports (status, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE subject_exports;
+-- +goose StatementEnd
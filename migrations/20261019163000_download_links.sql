@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE download_links
+(
+    id          TEXT PRIMARY KEY NOT NULL,
+    document_id TEXT             NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    variant     TEXT             NOT NULL,
+    created_by  TEXT             NOT NULL,
+    purpose     TEXT,
+    ticket      TEXT,
+    watermark   BOOLEAN          NOT NULL,
+    created_at  TIMESTAMP        NOT NULL,
+    expires_at  TIMESTAMP        NOT NULL,
+    redeemed_at TIMESTAMP
+);
+CREATE INDEX download_links_document_id_idx ON download_links (document_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE download_links;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE upload_sessions
+(
+    id           TEXT PRIMARY KEY NOT NULL,
+    subject      TEXT             NOT NULL,
+    status       TEXT             NOT NULL,
+    filename     TEXT             NOT NULL,
+    kind         TEXT             NOT NULL,
+    size         BIGINT           NOT NULL,
+    consent_id   TEXT,
+    edek         TEXT             NOT NULL,
+    dek_digest   TEXT             NOT NULL,
+    object_key   TEXT             NOT NULL,
+    document_id  TEXT,
+    error        TEXT,
+    created_at   TIMESTAMP        NOT NULL,
+    expires_at   TIMESTAMP        NOT NULL,
+    completed_at TIMESTAMP
+);
+CREATE INDEX upload_sessions_subject_id_idx ON upload_sessions (subject, id DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE upload_sessions;
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE tus_uploads
+(
+    id            TEXT PRIMARY KEY NOT NULL,
+    subject       TEXT             NOT NULL,
+    status        TEXT             NOT NULL,
+    filename      TEXT             NOT NULL,
+    kind          TEXT             NOT NULL,
+    length        BIGINT           NOT NULL,
+    consent_id    TEXT,
+    edek          TEXT             NOT NULL,
+    dek_digest    TEXT             NOT NULL,
+    object_key    TEXT             NOT NULL,
+    multipart_id  TEXT             NOT NULL,
+    header        BYTEA            NOT NULL,
+    upload_offset BIGINT           NOT NULL DEFAULT 0,
+    parts         JSONB            NOT NULL DEFAULT '[]',
+    pending       BYTEA            NOT NULL,
+    tail          BYTEA,
+    locked_until  TIMESTAMP,
+    lease_id      TEXT,
+    document_id   TEXT,
+    error         TEXT,
+    created_at    TIMESTAMP        NOT NULL,
+    expires_at    TIMESTAMP        NOT NULL,
+    completed_at  TIMESTAMP
+);
+CREATE INDEX tus_uploads_expires_at_idx ON tus_uploads (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE tus_uploads;
+-- +goose StatementEnd
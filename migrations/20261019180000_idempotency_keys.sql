@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE idempotency_keys
+(
+    subject          TEXT      NOT NULL,
+    key              TEXT      NOT NULL,
+    operation_id     TEXT      NOT NULL,
+    fingerprint      BYTEA     NOT NULL,
+    response_status  INT,
+    response_headers JSONB,
+    response_body    BYTEA,
+    created_at       TIMESTAMP NOT NULL,
+    expires_at       TIMESTAMP NOT NULL,
+    PRIMARY KEY (subject, key)
+);
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE idempotency_keys;
+-- +goose StatementEnd
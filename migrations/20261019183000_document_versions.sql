@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+ALTER TABLE documents
+    ADD COLUMN object_key  TEXT,
+    ADD COLUMN lineage_id  TEXT,
+    ADD COLUMN previous_id TEXT REFERENCES documents (id),
+    ADD COLUMN version     INT     NOT NULL DEFAULT 1,
+    ADD COLUMN is_current  BOOLEAN NOT NULL DEFAULT true;
+-- uploads so far were keyed by filename, later ones overwriting earlier ones
+UPDATE documents
+SET object_key = CASE WHEN scan_status = 'infected' THEN 'quarantine/' || filename ELSE filename END,
+    lineage_id = id;
+ALTER TABLE documents
+    ALTER COLUMN object_key SET NOT NULL,
+    ALTER COLUMN lineage_id SET NOT NULL;
+CREATE UNIQUE INDEX documents_lineage_version_idx ON documents (lineage_id, version);
+CREATE UNIQUE INDEX documents_lineage_current_idx ON documents (lineage_id) WHERE is_current;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP INDEX documents_lineage_current_idx;
+DROP INDEX documents_lineage_version_idx;
+ALTER TABLE documents
+    DROP COLUMN object_key,
+    DROP COLUMN lineage_id,
+    DROP COLUMN previous_id,
+    DROP COLUMN version,
+    DROP COLUMN is_current;
+-- +goose StatementEnd
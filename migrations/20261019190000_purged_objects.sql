@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+CREATE TABLE purged_objects
+(
+    object_key  TEXT PRIMARY KEY NOT NULL,
+    document_id TEXT             NOT NULL REFERENCES documents (id),
+    created_at  TIMESTAMP        NOT NULL
+);
+CREATE INDEX purged_objects_created_at_idx ON purged_objects (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+DROP TABLE purged_objects;
+-- +goose StatementEnd